@@ -21,6 +21,7 @@ package builder
 
 import (
 	"bytes"
+	"container/heap"
 	"fmt"
 
 	"mynewt.apache.org/newt/newt/resolve"
@@ -89,11 +90,14 @@ func revdepGraph(rs *resolve.ResolveSet) (DepGraph, error) {
 	return graphMapToDepGraph(revGm), nil
 }
 
-func depString(dep *resolve.ResolveDep) string {
+func DepString(dep *resolve.ResolveDep) string {
 	s := fmt.Sprintf("%s", dep.Rpkg.Lpkg.FullName())
 	if dep.Api != "" {
 		s += fmt.Sprintf("(api:%s)", dep.Api)
 	}
+	if dep.Feature != "" {
+		s += fmt.Sprintf("(syscfg:%s)", dep.Feature)
+	}
 
 	return s
 }
@@ -115,7 +119,7 @@ func DepGraphText(graph DepGraph) string {
 			if i != 0 {
 				fmt.Fprintf(buffer, " ")
 			}
-			fmt.Fprintf(buffer, "%s", depString(child))
+			fmt.Fprintf(buffer, "%s", DepString(child))
 		}
 		fmt.Fprintf(buffer, "]")
 	}
@@ -140,7 +144,7 @@ func RevdepGraphText(graph DepGraph) string {
 			if i != 0 {
 				fmt.Fprintf(buffer, " ")
 			}
-			fmt.Fprintf(buffer, "%s", depString(child))
+			fmt.Fprintf(buffer, "%s", DepString(child))
 		}
 		fmt.Fprintf(buffer, "]")
 	}
@@ -172,3 +176,166 @@ func FilterDepGraph(dg DepGraph, parents []*resolve.ResolvePackage) (
 
 	return newDg, missing
 }
+
+// A chain of dependencies leading from a root package (one that nothing
+// depends on) to some other package.
+type DepPath struct {
+	Root *resolve.ResolvePackage
+	Deps []*resolve.ResolveDep
+}
+
+func (dp DepPath) String() string {
+	buffer := bytes.NewBufferString(dp.Root.Lpkg.FullName())
+	for _, dep := range dp.Deps {
+		fmt.Fprintf(buffer, " --> %s", DepString(dep))
+	}
+
+	return buffer.String()
+}
+
+// A partially explored path in a DepPaths() search.
+type depPathCand struct {
+	path DepPath
+	cur  *resolve.ResolvePackage
+
+	// Lower bound on the length of any complete path through this candidate.
+	bound int
+
+	// Insertion order; keeps the search deterministic.
+	seq int
+}
+
+type depPathQueue []*depPathCand
+
+func (q depPathQueue) Len() int {
+	return len(q)
+}
+func (q depPathQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+func (q depPathQueue) Less(i, j int) bool {
+	if q[i].bound != q[j].bound {
+		return q[i].bound < q[j].bound
+	}
+	return q[i].seq < q[j].seq
+}
+func (q *depPathQueue) Push(x interface{}) {
+	*q = append(*q, x.(*depPathCand))
+}
+func (q *depPathQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+// Calculates the length of the shortest path from each package to dst.
+// Packages that cannot reach dst are absent from the result.
+func depDistances(dg DepGraph,
+	dst *resolve.ResolvePackage) map[*resolve.ResolvePackage]int {
+
+	dependers := map[*resolve.ResolvePackage][]*resolve.ResolvePackage{}
+	for parent, children := range dg {
+		for _, child := range children {
+			dependers[child.Rpkg] = append(dependers[child.Rpkg], parent)
+		}
+	}
+
+	dist := map[*resolve.ResolvePackage]int{dst: 0}
+	queue := []*resolve.ResolvePackage{dst}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		for _, parent := range dependers[cur] {
+			if _, ok := dist[parent]; !ok {
+				dist[parent] = dist[cur] + 1
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	return dist
+}
+
+// Finds the acyclic paths through the dependency graph that lead from a root
+// package to the specified package, shortest first.  Only packages that can
+// reach the destination are explored.
+//
+// @param dg                    The dependency graph to search.
+// @param dst                   The package to find paths to.
+// @param max                   Maximum number of paths to collect (0=all).
+//
+// @return []DepPath            The paths, sorted by length.
+func DepPaths(dg DepGraph, dst *resolve.ResolvePackage, max int) []DepPath {
+	hasDepender := map[*resolve.ResolvePackage]bool{}
+	for _, children := range dg {
+		for _, child := range children {
+			hasDepender[child.Rpkg] = true
+		}
+	}
+
+	dist := depDistances(dg, dst)
+
+	roots := []*resolve.ResolvePackage{}
+	for parent, _ := range dg {
+		if _, ok := dist[parent]; ok && !hasDepender[parent] {
+			roots = append(roots, parent)
+		}
+	}
+	roots = resolve.SortResolvePkgs(roots)
+
+	// Best-first search.  A candidate's bound is its current length plus the
+	// distance remaining to dst, so complete paths are found in order of
+	// length.
+	q := &depPathQueue{}
+	seq := 0
+	push := func(c *depPathCand) {
+		c.bound = len(c.path.Deps) + dist[c.cur]
+		c.seq = seq
+		seq++
+		heap.Push(q, c)
+	}
+
+	for _, root := range roots {
+		push(&depPathCand{
+			path: DepPath{Root: root},
+			cur:  root,
+		})
+	}
+
+	paths := []DepPath{}
+	for q.Len() > 0 {
+		if max > 0 && len(paths) >= max {
+			break
+		}
+
+		c := heap.Pop(q).(*depPathCand)
+		if c.cur == dst {
+			paths = append(paths, c.path)
+			continue
+		}
+
+		onPath := map[*resolve.ResolvePackage]bool{c.path.Root: true}
+		for _, dep := range c.path.Deps {
+			onPath[dep.Rpkg] = true
+		}
+
+		for _, child := range resolve.SortResolveDeps(dg[c.cur]) {
+			if _, ok := dist[child.Rpkg]; !ok || onPath[child.Rpkg] {
+				continue
+			}
+
+			deps := make([]*resolve.ResolveDep, len(c.path.Deps)+1)
+			copy(deps, c.path.Deps)
+			deps[len(deps)-1] = child
+
+			push(&depPathCand{
+				path: DepPath{Root: c.path.Root, Deps: deps},
+				cur:  child.Rpkg,
+			})
+		}
+	}
+
+	return paths
+}
@@ -0,0 +1,348 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/resolve"
+	"mynewt.apache.org/newt/util"
+)
+
+const DEPGRAPH_FORMAT_TEXT = "text"
+const DEPGRAPH_FORMAT_DOT = "dot"
+const DEPGRAPH_FORMAT_GRAPHML = "graphml"
+const DEPGRAPH_FORMAT_JSON = "json"
+
+// Special collapse specifier: merge all packages in a repo into one node.
+const DEPGRAPH_COLLAPSE_REPO = "repo"
+
+// Node type assigned to nodes that represent several packages.
+const DEPGRAPH_NODE_TYPE_GROUP = "group"
+
+var depGraphTypeColors = map[string]string{
+	"compiler":               "gray80",
+	"mfg":                    "gray80",
+	"sdk":                    "khaki",
+	"generated":              "gray80",
+	"lib":                    "lightblue",
+	"bsp":                    "palegreen",
+	"unittest":               "plum",
+	"app":                    "orange",
+	"target":                 "salmon",
+	DEPGRAPH_NODE_TYPE_GROUP: "white",
+}
+
+var depGraphRepoColors = []string{
+	"black", "blue", "darkgreen", "red", "purple", "brown", "darkorange",
+	"navy",
+}
+
+type ExportNode struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Repo string `json:"repo"`
+}
+
+type ExportEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// APIs that generated this dependency; empty for a hard dependency.
+	Apis []string `json:"apis,omitempty"`
+
+	// Syscfg settings that enabled this dependency; empty if unconditional.
+	Settings []string `json:"syscfg,omitempty"`
+}
+
+// A package-agnostic representation of a dependency graph, suitable for
+// export to external tools.  Several packages may be collapsed into a single
+// node.
+type ExportGraph struct {
+	Nodes []*ExportNode `json:"nodes"`
+	Edges []*ExportEdge `json:"edges"`
+}
+
+// Determines the name of the node that represents the specified package.
+//
+// @param rpkg                  The package to look up.
+// @param collapse              DEPGRAPH_COLLAPSE_REPO or name prefixes.
+//
+// @return string, bool         The node name; true if the node is a group.
+func exportNodeName(rpkg *resolve.ResolvePackage,
+	collapse []string) (string, bool) {
+
+	for _, c := range collapse {
+		if c == DEPGRAPH_COLLAPSE_REPO {
+			return "@" + rpkg.Lpkg.Repo().Name(), true
+		}
+	}
+
+	// A prefix may include a repo ("@apache-mynewt-core/hw/mcu") or not
+	// ("hw/mcu"); the latter matches packages in any repo.
+	name := rpkg.Lpkg.FullName()
+	for _, c := range collapse {
+		prefix := strings.TrimSuffix(c, "/")
+		for _, n := range []string{name, rpkg.Lpkg.Name()} {
+			if n == prefix || strings.HasPrefix(n, prefix+"/") {
+				return prefix, true
+			}
+		}
+	}
+
+	return name, false
+}
+
+// Converts a dependency graph to an export graph.  Packages matching a
+// collapse specifier are merged into a single node; dependencies among merged
+// packages are discarded.
+func NewExportGraph(dg DepGraph, collapse []string) *ExportGraph {
+	nodeMap := map[string]*ExportNode{}
+	edgeMap := map[string]*ExportEdge{}
+
+	addNode := func(rpkg *resolve.ResolvePackage) string {
+		name, group := exportNodeName(rpkg, collapse)
+		if nodeMap[name] == nil {
+			node := &ExportNode{
+				Name: name,
+				Type: pkg.PackageTypeNames[rpkg.Lpkg.Type()],
+				Repo: rpkg.Lpkg.Repo().Name(),
+			}
+			if group {
+				node.Type = DEPGRAPH_NODE_TYPE_GROUP
+			}
+			nodeMap[name] = node
+		}
+
+		return name
+	}
+
+	for parent, children := range dg {
+		from := addNode(parent)
+		for _, child := range children {
+			to := addNode(child.Rpkg)
+			if from == to {
+				continue
+			}
+
+			key := from + "\x00" + to
+			edge := edgeMap[key]
+			if edge == nil {
+				edge = &ExportEdge{From: from, To: to}
+				edgeMap[key] = edge
+			}
+			if child.Api != "" {
+				edge.Apis = append(edge.Apis, child.Api)
+			}
+			if child.Feature != "" {
+				edge.Settings = append(edge.Settings, child.Feature)
+			}
+		}
+	}
+
+	eg := &ExportGraph{}
+
+	nodeNames := make([]string, 0, len(nodeMap))
+	for name, _ := range nodeMap {
+		nodeNames = append(nodeNames, name)
+	}
+	sort.Strings(nodeNames)
+	for _, name := range nodeNames {
+		eg.Nodes = append(eg.Nodes, nodeMap[name])
+	}
+
+	edgeKeys := make([]string, 0, len(edgeMap))
+	for key, _ := range edgeMap {
+		edgeKeys = append(edgeKeys, key)
+	}
+	sort.Strings(edgeKeys)
+	for _, key := range edgeKeys {
+		edge := edgeMap[key]
+		edge.Apis = util.UniqueStrings(edge.Apis)
+		sort.Strings(edge.Apis)
+		edge.Settings = util.UniqueStrings(edge.Settings)
+		sort.Strings(edge.Settings)
+		eg.Edges = append(eg.Edges, edge)
+	}
+
+	return eg
+}
+
+func (eg *ExportGraph) repoColors() map[string]string {
+	repoNames := []string{}
+	for _, node := range eg.Nodes {
+		repoNames = append(repoNames, node.Repo)
+	}
+	repoNames = util.UniqueStrings(repoNames)
+	sort.Strings(repoNames)
+
+	colors := map[string]string{}
+	for i, name := range repoNames {
+		colors[name] = depGraphRepoColors[i%len(depGraphRepoColors)]
+	}
+
+	return colors
+}
+
+func (edge *ExportEdge) label() string {
+	parts := []string{}
+	for _, api := range edge.Apis {
+		parts = append(parts, "api:"+api)
+	}
+	for _, setting := range edge.Settings {
+		parts = append(parts, "syscfg:"+setting)
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// Produces a Graphviz representation of the graph.  Node fill color indicates
+// package type; node outline color indicates repo.
+func (eg *ExportGraph) Dot() string {
+	repoColors := eg.repoColors()
+
+	buffer := bytes.NewBufferString("")
+
+	fmt.Fprintf(buffer, "digraph deps {\n")
+	fmt.Fprintf(buffer, "    node [shape=box style=filled];\n")
+	for _, node := range eg.Nodes {
+		fmt.Fprintf(buffer,
+			"    %q [fillcolor=%q color=%q tooltip=%q];\n",
+			node.Name, depGraphTypeColors[node.Type], repoColors[node.Repo],
+			node.Type+" @"+node.Repo)
+	}
+
+	for _, edge := range eg.Edges {
+		fmt.Fprintf(buffer, "    %q -> %q", edge.From, edge.To)
+		if label := edge.label(); label != "" {
+			fmt.Fprintf(buffer, " [label=%q style=dashed]", label)
+		}
+		fmt.Fprintf(buffer, ";\n")
+	}
+	fmt.Fprintf(buffer, "}\n")
+
+	return buffer.String()
+}
+
+func xmlEscape(s string) string {
+	buffer := bytes.NewBufferString("")
+	xml.EscapeText(buffer, []byte(s))
+	return buffer.String()
+}
+
+// Produces a GraphML representation of the graph.
+func (eg *ExportGraph) Graphml() string {
+	repoColors := eg.repoColors()
+
+	buffer := bytes.NewBufferString("")
+
+	fmt.Fprintf(buffer, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(buffer, "<graphml "+
+		"xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n")
+	for _, key := range []struct {
+		id     string
+		domain string
+	}{
+		{"type", "node"},
+		{"repo", "node"},
+		{"color", "node"},
+		{"repocolor", "node"},
+		{"apis", "edge"},
+		{"syscfg", "edge"},
+	} {
+		fmt.Fprintf(buffer, "  <key id=\"%s\" for=\"%s\" attr.name=\"%s\" "+
+			"attr.type=\"string\"/>\n", key.id, key.domain, key.id)
+	}
+
+	fmt.Fprintf(buffer, "  <graph id=\"deps\" edgedefault=\"directed\">\n")
+	for _, node := range eg.Nodes {
+		fmt.Fprintf(buffer, "    <node id=\"%s\">\n", xmlEscape(node.Name))
+		fmt.Fprintf(buffer, "      <data key=\"type\">%s</data>\n",
+			xmlEscape(node.Type))
+		fmt.Fprintf(buffer, "      <data key=\"repo\">%s</data>\n",
+			xmlEscape(node.Repo))
+		fmt.Fprintf(buffer, "      <data key=\"color\">%s</data>\n",
+			depGraphTypeColors[node.Type])
+		fmt.Fprintf(buffer, "      <data key=\"repocolor\">%s</data>\n",
+			repoColors[node.Repo])
+		fmt.Fprintf(buffer, "    </node>\n")
+	}
+
+	for _, edge := range eg.Edges {
+		fmt.Fprintf(buffer, "    <edge source=\"%s\" target=\"%s\">\n",
+			xmlEscape(edge.From), xmlEscape(edge.To))
+		if len(edge.Apis) > 0 {
+			fmt.Fprintf(buffer, "      <data key=\"apis\">%s</data>\n",
+				xmlEscape(strings.Join(edge.Apis, " ")))
+		}
+		if len(edge.Settings) > 0 {
+			fmt.Fprintf(buffer, "      <data key=\"syscfg\">%s</data>\n",
+				xmlEscape(strings.Join(edge.Settings, " ")))
+		}
+		fmt.Fprintf(buffer, "    </edge>\n")
+	}
+	fmt.Fprintf(buffer, "  </graph>\n")
+	fmt.Fprintf(buffer, "</graphml>\n")
+
+	return buffer.String()
+}
+
+// Produces a JSON representation of the graph.
+func (eg *ExportGraph) Json() (string, error) {
+	buffer, err := json.MarshalIndent(eg, "", "  ")
+	if err != nil {
+		return "", util.FmtNewtError(
+			"Cannot encode dependency graph: %s", err.Error())
+	}
+
+	return string(buffer) + "\n", nil
+}
+
+// Renders a dependency graph in the specified format.
+//
+// @param dg                    The dependency graph to render.
+// @param format                One of the DEPGRAPH_FORMAT_[...] constants.
+// @param collapse              Collapse specifiers; see NewExportGraph.
+func DepGraphExport(dg DepGraph, format string,
+	collapse []string) (string, error) {
+
+	eg := NewExportGraph(dg, collapse)
+
+	switch format {
+	case DEPGRAPH_FORMAT_DOT:
+		return eg.Dot(), nil
+	case DEPGRAPH_FORMAT_GRAPHML:
+		return eg.Graphml(), nil
+	case DEPGRAPH_FORMAT_JSON:
+		return eg.Json()
+	default:
+		return "", util.FmtNewtError(
+			"Invalid dependency graph format: \"%s\"; must be one of: "+
+				"%s, %s, %s, %s", format, DEPGRAPH_FORMAT_TEXT,
+			DEPGRAPH_FORMAT_DOT, DEPGRAPH_FORMAT_GRAPHML,
+			DEPGRAPH_FORMAT_JSON)
+	}
+}
@@ -0,0 +1,262 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/syscfg"
+)
+
+// The most recently built image occupying a flash area.
+type FlashAreaImage struct {
+	Path string
+	Size int
+
+	// The number of bytes in the area available to the image (i.e., the area
+	// size minus any reserved boot trailer).
+	Capacity int
+}
+
+type FlashMapReport struct {
+	FlashMap flash.FlashMap
+
+	// Area name --> names of flash_owner settings that claim the area.
+	Owners map[string][]string
+
+	// Area name --> image built into the area.
+	Images map[string]FlashAreaImage
+
+	// Text describing flash_owner settings that do not resolve to a single
+	// area.
+	OwnerErrors []string
+
+	// Image slots and scratch areas too small for the boot trailer.
+	TrailerErrors []string
+}
+
+func fileSize(path string) (int, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+
+	return int(info.Size()), true
+}
+
+// Determines which built images occupy which areas.  For split images, the
+// loader resides in slot 0 and the app in slot 1; otherwise the app resides in
+// slot 0.  A target without an image (e.g., a boot loader) is written directly
+// to the boot loader area.
+func (t *TargetBuilder) flashMapImages() map[string]FlashAreaImage {
+	images := map[string]FlashAreaImage{}
+	if t.appPkg == nil {
+		return images
+	}
+
+	maxSizes := t.maxImgSizes()
+	tgtName := t.target.Name()
+
+	addImg := func(areaName string, path string, capacity int) bool {
+		size, ok := fileSize(path)
+		if !ok {
+			return false
+		}
+		images[areaName] = FlashAreaImage{
+			Path:     path,
+			Size:     size,
+			Capacity: capacity,
+		}
+		return true
+	}
+
+	if t.loaderPkg != nil {
+		addImg(flash.FLASH_AREA_NAME_IMAGE_0,
+			AppImgPath(tgtName, BUILD_NAME_LOADER, t.loaderPkg.Name()),
+			maxSizes[0])
+		addImg(flash.FLASH_AREA_NAME_IMAGE_1,
+			AppImgPath(tgtName, BUILD_NAME_APP, t.appPkg.Name()),
+			maxSizes[1])
+		return images
+	}
+
+	if addImg(flash.FLASH_AREA_NAME_IMAGE_0,
+		AppImgPath(tgtName, BUILD_NAME_APP, t.appPkg.Name()),
+		maxSizes[0]) {
+
+		return images
+	}
+
+	bootArea := t.bspPkg.FlashMap.Areas[flash.FLASH_AREA_NAME_BOOTLOADER]
+	addImg(flash.FLASH_AREA_NAME_BOOTLOADER,
+		AppBinPath(tgtName, BUILD_NAME_APP, t.appPkg.Name()),
+		bootArea.Size)
+
+	return images
+}
+
+// Gathers the information displayed by `newt target flashmap`: the BSP's flash
+// map, the settings that own each area, and the images occupying each slot.
+func (t *TargetBuilder) FlashMapReport() (FlashMapReport, error) {
+	report := FlashMapReport{
+		FlashMap: t.bspPkg.FlashMap,
+		Owners:   map[string][]string{},
+	}
+
+	res, err := t.Resolve()
+	if err != nil {
+		return report, err
+	}
+
+	for name, entry := range res.Cfg.Settings {
+		if entry.SettingType == syscfg.CFG_SETTING_TYPE_FLASH_OWNER &&
+			entry.Value != "" {
+
+			report.Owners[entry.Value] =
+				append(report.Owners[entry.Value], name)
+		}
+	}
+	for _, owners := range report.Owners {
+		sort.Strings(owners)
+	}
+
+	for _, conflict := range res.Cfg.FlashConflicts {
+		text := res.Cfg.FlashConflictErrorText(conflict)
+		report.OwnerErrors = append(report.OwnerErrors,
+			strings.TrimSpace(text))
+	}
+
+	report.Images = t.flashMapImages()
+	report.TrailerErrors = t.trailerErrors()
+
+	return report, nil
+}
+
+func (img FlashAreaImage) Text() string {
+	if img.Capacity <= 0 {
+		return fmt.Sprintf("%s: %s", filepath.Base(img.Path),
+			flash.SizeText(img.Size))
+	}
+
+	return fmt.Sprintf("%s: %d/%d bytes (%d%%)", filepath.Base(img.Path),
+		img.Size,
+		img.Capacity, img.Size*100/img.Capacity)
+}
+
+func (img FlashAreaImage) Overflows() bool {
+	return img.Capacity > 0 && img.Size > img.Capacity
+}
+
+// Lists every problem detected in the flash map.
+func (r FlashMapReport) Problems() []string {
+	problems := []string{}
+
+	if text := r.FlashMap.ErrorText(); text != "" {
+		problems = append(problems, strings.TrimSpace(text))
+	}
+
+	problems = append(problems, r.TrailerErrors...)
+	problems = append(problems, r.OwnerErrors...)
+
+	for _, area := range r.FlashMap.SortedAreas() {
+		if img, ok := r.Images[area.Name]; ok && img.Overflows() {
+			problems = append(problems, fmt.Sprintf(
+				"%s overflows %s by %d bytes",
+				img.Path, area.Name, img.Size-img.Capacity))
+		}
+	}
+
+	return problems
+}
+
+// Produces a table of areas followed by an ASCII layout of each device.
+func (r FlashMapReport) Text() string {
+	buf := ""
+
+	for _, device := range r.FlashMap.DeviceIds() {
+		dev := r.FlashMap.Device(device)
+
+		buf += fmt.Sprintf("Device %d", device)
+		if dev.HasSectors() {
+			buf += " (" + dev.SectorText() + ")"
+		}
+		buf += ":\n"
+
+		buf += fmt.Sprintf("    %-28s %4s %-10s %-10s %-9s %s\n",
+			"AREA", "ID", "OFFSET", "END", "SIZE", "OWNER / CONTENTS")
+
+		for _, span := range r.FlashMap.DeviceSpans(device) {
+			end := span.Offset + span.Size
+			if span.Area == nil {
+				buf += fmt.Sprintf("    %-28s %4s 0x%08x 0x%08x %s\n",
+					"(gap)", "", span.Offset, end,
+					flash.SizeText(span.Size))
+				continue
+			}
+
+			notes := []string{}
+			notes = append(notes, r.Owners[span.Area.Name]...)
+			if img, ok := r.Images[span.Area.Name]; ok {
+				notes = append(notes, img.Text())
+			}
+
+			line := fmt.Sprintf("    %-28s %4d 0x%08x 0x%08x %-9s %s",
+				span.Area.Name, span.Area.Id, span.Offset, end,
+				flash.SizeText(span.Size), strings.Join(notes, "; "))
+			buf += strings.TrimRight(line, " ") + "\n"
+		}
+
+		buf += "\n" + r.FlashMap.LayoutText(device, 64) + "\n"
+	}
+
+	problems := r.Problems()
+	if len(problems) == 0 {
+		buf += "No flash map problems detected.\n"
+	} else {
+		buf += "Problems:\n"
+		for _, p := range problems {
+			buf += "    * " + strings.Replace(p, "\n", "\n      ", -1) + "\n"
+		}
+	}
+
+	return buf
+}
+
+// Writes an SVG drawing of the flash map, labelling each area with its owners
+// and contents.
+func (r FlashMapReport) WriteSvg(w io.Writer) {
+	labels := map[string]string{}
+	for _, area := range r.FlashMap.SortedAreas() {
+		notes := []string{}
+		notes = append(notes, r.Owners[area.Name]...)
+		if img, ok := r.Images[area.Name]; ok {
+			notes = append(notes, img.Text())
+		}
+		labels[area.Name] = strings.Join(notes, "; ")
+	}
+
+	r.FlashMap.WriteLayoutSvg(w, labels)
+}
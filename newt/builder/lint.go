@@ -0,0 +1,301 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/resolve"
+	"mynewt.apache.org/newt/newt/syscfg"
+	"mynewt.apache.org/newt/util"
+)
+
+// Source files that get scanned for setting references.
+var lintSrcExts = map[string]bool{
+	".c":   true,
+	".h":   true,
+	".cc":  true,
+	".cpp": true,
+	".hpp": true,
+	".s":   true,
+	".S":   true,
+	".ld":  true,
+}
+
+var lintSettingRefRe = regexp.MustCompile(
+	`MYNEWT_VAL(?:\(\s*([A-Za-z0-9_]+)\s*\)|_([A-Za-z0-9_]+))`)
+
+// A target override that sets a setting to its default value.
+type LintOverride struct {
+	Name  string
+	Point syscfg.CfgPoint
+}
+
+// Collects every setting name referenced by a package's source files.  Nested
+// packages are not scanned; they are scanned separately if they are part of
+// the build.
+func lintScanPkgSrc(lpkg *pkg.LocalPackage, refs map[string]bool) error {
+	basePath := lpkg.BasePath()
+
+	return filepath.Walk(basePath,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+
+			if info.IsDir() {
+				if path != basePath &&
+					(util.NodeExist(path+"/"+pkg.PACKAGE_FILE_NAME) ||
+						info.Name() == "bin") {
+
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if !lintSrcExts[filepath.Ext(path)] {
+				return nil
+			}
+
+			contents, err := ioutil.ReadFile(path)
+			if err != nil {
+				return util.NewNewtError(err.Error())
+			}
+
+			for _, m := range lintSettingRefRe.FindAllStringSubmatch(
+				string(contents), -1) {
+
+				refs[m[1]+m[2]] = true
+			}
+
+			return nil
+		})
+}
+
+// Collects every setting name used as a feature by a set of configuration
+// keys (e.g., "pkg.deps.SETTING" or "syscfg.vals.SETTING.OTHER_SETTING").
+// Configuration keys are case-insensitive, so the collected names are
+// lowercase.
+//
+// @param keys                  The fully-qualified configuration keys.
+// @param minParts              Minimum key length for a feature key.
+// @param refs                  The map to add feature names to.
+func lintScanCfgKeys(keys []string, minParts int, refs map[string]bool) {
+	for _, key := range keys {
+		parts := strings.Split(key, ".")
+		if len(parts) >= minParts {
+			refs[strings.ToLower(parts[2])] = true
+		}
+	}
+}
+
+func lintScanPkgCfg(lpkg *pkg.LocalPackage, refs map[string]bool) {
+	pkgKeys := []string{}
+	for _, key := range lpkg.PkgV.AllKeys() {
+		// Init and down function names are not features.
+		if !strings.HasPrefix(key, "pkg.init.") &&
+			!strings.HasPrefix(key, "pkg.down.") {
+
+			pkgKeys = append(pkgKeys, key)
+		}
+	}
+	lintScanCfgKeys(pkgKeys, 3, refs)
+
+	// syscfg.vals.FEATURE.SETTING
+	// syscfg.defs.FEATURE.SETTING.FIELD
+	valKeys := []string{}
+	defKeys := []string{}
+	for _, key := range lpkg.SyscfgV.AllKeys() {
+		if strings.HasPrefix(key, "syscfg.vals.") {
+			valKeys = append(valKeys, key)
+		} else if strings.HasPrefix(key, "syscfg.defs.") {
+			defKeys = append(defKeys, key)
+		}
+	}
+	lintScanCfgKeys(valKeys, 4, refs)
+	lintScanCfgKeys(defKeys, 5, refs)
+}
+
+// Determines which settings defined by packages in the build are never
+// referenced by any source file, configuration file, or setting restriction
+// of a package in the build.
+func (t *TargetBuilder) UnreferencedSettings() ([]string, error) {
+	if err := t.ensureResolved(); err != nil {
+		return nil, err
+	}
+
+	srcRefs := map[string]bool{}
+	cfgRefs := map[string]bool{}
+	for _, rpkg := range t.res.MasterSet.Rpkgs {
+		if err := lintScanPkgSrc(rpkg.Lpkg, srcRefs); err != nil {
+			return nil, err
+		}
+		lintScanPkgCfg(rpkg.Lpkg, cfgRefs)
+	}
+	lintScanCfgKeys(t.bspPkg.BspV.AllKeys(), 3, cfgRefs)
+
+	for _, entry := range t.res.Cfg.Settings {
+		for _, r := range entry.Restrictions {
+			if r.Code == syscfg.CFG_RESTRICTION_CODE_EXPR {
+				srcRefs[r.Expr.ReqSetting] = true
+			}
+		}
+	}
+
+	names := []string{}
+	for name, entry := range t.res.Cfg.Settings {
+		// Skip injected settings and settings that newt consumes itself.
+		if entry.PackageDef == nil ||
+			entry.SettingType == syscfg.CFG_SETTING_TYPE_FLASH_OWNER {
+
+			continue
+		}
+
+		if !srcRefs[name] && !cfgRefs[strings.ToLower(name)] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Finds target overrides that set a setting to its default value.
+func (t *TargetBuilder) RedundantOverrides() ([]LintOverride, error) {
+	if err := t.ensureResolved(); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(t.res.Cfg.Settings))
+	for name, _ := range t.res.Cfg.Settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	overrides := []LintOverride{}
+	for _, name := range names {
+		entry := t.res.Cfg.Settings[name]
+		for _, point := range entry.History[1:] {
+			if point.Source != nil &&
+				point.Source.Type() == pkg.PACKAGE_TYPE_TARGET &&
+				point.Value == entry.History[0].Value {
+
+				overrides = append(overrides, LintOverride{
+					Name:  name,
+					Point: point,
+				})
+			}
+		}
+	}
+
+	return overrides, nil
+}
+
+// Determines which of a builder's packages produced an archive that
+// contributes no symbols to the linked ELF file.  The builder's app must
+// already be linked.
+func (b *Builder) emptyPackages() ([]*resolve.ResolvePackage, error) {
+	elfPath := b.AppElfPath()
+	if util.NodeNotExist(elfPath) {
+		return nil, util.FmtNewtError(
+			"ELF file not found: %s; build the target first", elfPath)
+	}
+
+	err, elfSyms := b.ParseObjectElf(elfPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rpkgs := []*resolve.ResolvePackage{}
+	for _, bpkg := range b.sortedBuildPackages() {
+		if util.NodeNotExist(b.ArchivePath(bpkg)) {
+			continue
+		}
+
+		err, libSyms := b.ParseObjectLibrary(bpkg)
+		if err != nil {
+			return nil, err
+		}
+
+		used := false
+		for name, _ := range *libSyms {
+			if _, ok := (*elfSyms)[name]; ok {
+				used = true
+				break
+			}
+		}
+
+		if !used {
+			rpkgs = append(rpkgs, bpkg.rpkg)
+		}
+	}
+
+	return rpkgs, nil
+}
+
+// Determines which packages produced an archive that contributes no symbols
+// to the target's linked images.  The target must already be built.
+func (t *TargetBuilder) EmptyPackages() ([]*resolve.ResolvePackage, error) {
+	if err := t.PrepBuild(); err != nil {
+		return nil, err
+	}
+
+	rpkgs, err := t.AppBuilder.emptyPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	if t.LoaderBuilder != nil {
+		loaderRpkgs, err := t.LoaderBuilder.emptyPackages()
+		if err != nil {
+			return nil, err
+		}
+
+		// A package is only unused if no image uses it.
+		appEmpty := map[*resolve.ResolvePackage]bool{}
+		for _, rpkg := range rpkgs {
+			appEmpty[rpkg] = true
+		}
+		loaderEmpty := map[*resolve.ResolvePackage]bool{}
+		for _, rpkg := range loaderRpkgs {
+			loaderEmpty[rpkg] = true
+		}
+
+		rpkgs = []*resolve.ResolvePackage{}
+		for rpkg, _ := range appEmpty {
+			if loaderEmpty[rpkg] || t.LoaderBuilder.PkgMap[rpkg] == nil {
+				rpkgs = append(rpkgs, rpkg)
+			}
+		}
+		for rpkg, _ := range loaderEmpty {
+			if t.AppBuilder.PkgMap[rpkg] == nil {
+				rpkgs = append(rpkgs, rpkg)
+			}
+		}
+	}
+
+	return resolve.SortResolvePkgs(rpkgs), nil
+}
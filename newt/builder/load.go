@@ -21,13 +21,16 @@ package builder
 
 import (
 	"fmt"
-	"os"
 	"sort"
-	"strconv"
 	"strings"
 
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/flasher"
+	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/target"
 	"mynewt.apache.org/newt/util"
 )
 
@@ -51,51 +54,88 @@ func (t *TargetBuilder) Load(extraJtagCmd string) error {
 	return err
 }
 
-func Load(binBaseName string, bspPkg *pkg.BspPackage,
-	extraEnvSettings map[string]string) error {
-
-	if bspPkg.DownloadScript == "" {
-		return nil
+// Constructs the backend used to write images to the specified BSP's flash
+// and to debug them.  The backend and its settings are read from the BSP
+// (bsp.flasher, bsp.flasher_settings.<backend>), then overridden by the
+// user's newtrc (flasher, flasher_settings.<backend>), then by the target
+// (target.flasher, target.flasher.<backend>.<setting>).  tgt may be nil.
+func NewFlasher(bspPkg *pkg.BspPackage,
+	tgt *target.Target) (flasher.Flasher, error) {
+
+	backend := bspPkg.Flasher
+	settings := map[string]map[string]interface{}{}
+
+	mergeSettings := func(ymlSettings map[string]interface{}) {
+		for name, v := range ymlSettings {
+			if settings[name] == nil {
+				settings[name] = map[string]interface{}{}
+			}
+			for k, val := range cast.ToStringMap(v) {
+				settings[name][k] = val
+			}
+		}
 	}
 
-	bspPath := bspPkg.BasePath()
+	mergeSettings(bspPkg.FlasherSettings)
 
-	sortedKeys := make([]string, 0, len(extraEnvSettings))
-	for k, _ := range extraEnvSettings {
-		sortedKeys = append(sortedKeys, k)
+	newtrc := newtutil.Newtrc()
+	if name := newtrc.GetString("flasher"); name != "" {
+		backend = name
 	}
-	sort.Strings(sortedKeys)
+	mergeSettings(cast.ToStringMap(newtrc.Get("flasher_settings")))
 
-	env := []string{}
-	for _, key := range sortedKeys {
-		env = append(env, fmt.Sprintf("%s=%s", key, extraEnvSettings[key]))
+	if tgt != nil {
+		if name := tgt.Vars["target.flasher"]; name != "" {
+			backend = name
+		}
+		for k, v := range tgt.Vars {
+			if !strings.HasPrefix(k, "target.flasher.") {
+				continue
+			}
+			parts := strings.SplitN(
+				strings.TrimPrefix(k, "target.flasher."), ".", 2)
+			if len(parts) != 2 {
+				return nil, util.FmtNewtError(
+					"target %s: invalid flasher setting \"%s\"; expected "+
+						"target.flasher.<flasher>.<setting>", tgt.Name(), k)
+			}
+			mergeSettings(map[string]interface{}{
+				parts[0]: map[string]interface{}{parts[1]: v},
+			})
+		}
 	}
 
-	coreRepo := project.GetProject().FindRepo("apache-mynewt-core")
-	env = append(env, fmt.Sprintf("CORE_PATH=%s", coreRepo.Path()))
-	env = append(env, fmt.Sprintf("BSP_PATH=%s", bspPath))
-	env = append(env, fmt.Sprintf("BIN_BASENAME=%s", binBaseName))
-
-	// bspPath, binBaseName are passed in command line for backwards
-	// compatibility
-	cmd := []string{
-		bspPkg.DownloadScript,
-		bspPath,
-		binBaseName,
+	if backend == "" {
+		backend = flasher.FLASHER_SCRIPT
 	}
 
-	util.StatusMessage(util.VERBOSITY_VERBOSE, "Load command: %s\n",
-		strings.Join(cmd, " "))
-	util.StatusMessage(util.VERBOSITY_VERBOSE, "Environment:\n")
-	for _, v := range env {
-		util.StatusMessage(util.VERBOSITY_VERBOSE, "* %s\n", v)
-	}
-	if _, err := util.ShellCommand(cmd, env); err != nil {
-		return err
+	corePath := ""
+	if coreRepo := project.GetProject().FindRepo(
+		"apache-mynewt-core"); coreRepo != nil {
+
+		corePath = coreRepo.Path()
 	}
-	util.StatusMessage(util.VERBOSITY_VERBOSE, "Successfully loaded image.\n")
 
-	return nil
+	addressed := []int{}
+	for id, dev := range bspPkg.FlashMap.Devices {
+		if dev.HasBase {
+			addressed = append(addressed, id)
+		}
+	}
+	sort.Ints(addressed)
+
+	return flasher.New(flasher.Config{
+		Backend:          backend,
+		Settings:         settings[backend],
+		ProjectPath:      project.GetProject().Path(),
+		BspName:          bspPkg.FullName(),
+		BspPath:          bspPkg.BasePath(),
+		CorePath:         corePath,
+		DownloadScript:   bspPkg.DownloadScript,
+		DebugScript:      bspPkg.DebugScript,
+		DownloadDevices:  bspPkg.DownloadDevices,
+		AddressedDevices: addressed,
+	})
 }
 
 func (b *Builder) Load(imageSlot int, extraJtagCmd string) error {
@@ -110,16 +150,13 @@ func (b *Builder) Load(imageSlot int, extraJtagCmd string) error {
 	}
 
 	envSettings := map[string]string{
-		"IMAGE_SLOT": strconv.Itoa(imageSlot),
-		"FEATURES":   b.FeatureString(),
-	}
-	if extraJtagCmd != "" {
-		envSettings["EXTRA_JTAG_CMD"] = extraJtagCmd
+		"FEATURES": b.FeatureString(),
 	}
 	features := b.cfg.Features()
 
 	var flashTargetArea string
-	if _, ok := features["BOOT_LOADER"]; ok {
+	_, bootLoader := features["BOOT_LOADER"]
+	if bootLoader {
 		envSettings["BOOT_LOADER"] = "1"
 
 		flashTargetArea = "FLASH_AREA_BOOTLOADER"
@@ -141,15 +178,33 @@ func (b *Builder) Load(imageSlot int, extraJtagCmd string) error {
 		return util.NewNewtError(fmt.Sprintf("No flash target area %s\n",
 			flashTargetArea))
 	}
-	envSettings["FLASH_OFFSET"] = "0x" + strconv.FormatInt(int64(tgtArea.Offset), 16)
-
-	if err := Load(b.AppBinBasePath(), b.targetBuilder.bspPkg,
-		envSettings); err != nil {
 
+	f, err := NewFlasher(bspPkg, b.targetBuilder.target)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	binBaseName := b.AppBinBasePath()
+	imgPath := binBaseName + ".img"
+	if bootLoader {
+		imgPath = binBaseName + ".elf.bin"
+	}
+
+	devBase := bspPkg.FlashMap.Device(tgtArea.Device).Base
+
+	args := flasher.LoadArgs{
+		ImagePath:   imgPath,
+		BinBaseName: binBaseName,
+		Device:      tgtArea.Device,
+		Offset:      tgtArea.Offset,
+		Address:     devBase + tgtArea.Offset,
+		Slot:        imageSlot,
+		BootLoader:  bootLoader,
+		ExtraCmd:    extraJtagCmd,
+		Env:         envSettings,
+	}
+
+	return flasher.Load(f, args)
 }
 
 func (t *TargetBuilder) Debug(extraJtagCmd string, reset bool, noGDB bool) error {
@@ -173,38 +228,23 @@ func (b *Builder) debugBin(binPath string, extraJtagCmd string, reset bool,
 		return err
 	}
 
-	bspPath := b.bspPkg.rpkg.Lpkg.BasePath()
-	binBaseName := binPath
-	featureString := b.FeatureString()
-
-	coreRepo := project.GetProject().FindRepo("apache-mynewt-core")
-	envSettings := []string{
-		fmt.Sprintf("CORE_PATH=%s", coreRepo.Path()),
-		fmt.Sprintf("BSP_PATH=%s", bspPath),
-		fmt.Sprintf("BIN_BASENAME=%s", binBaseName),
-		fmt.Sprintf("FEATURES=%s", featureString),
-	}
-	if extraJtagCmd != "" {
-		envSettings = append(envSettings,
-			fmt.Sprintf("EXTRA_JTAG_CMD=%s", extraJtagCmd))
-	}
-	if reset == true {
-		envSettings = append(envSettings, fmt.Sprintf("RESET=true"))
-	}
-	if noGDB == true {
-		envSettings = append(envSettings, fmt.Sprintf("NO_GDB=1"))
+	f, err := NewFlasher(b.targetBuilder.bspPkg, b.targetBuilder.target)
+	if err != nil {
+		return err
 	}
 
-	os.Chdir(project.GetProject().Path())
-
-	// bspPath, binBaseName are passed in command line for backwards
-	// compatibility
-	cmdLine := []string{
-		b.targetBuilder.bspPkg.DebugScript, bspPath, binBaseName,
+	args := flasher.DebugArgs{
+		ElfPath:     binPath + ".elf",
+		BinBaseName: binPath,
+		Reset:       reset,
+		NoGdb:       noGDB,
+		ExtraCmd:    extraJtagCmd,
+		Env: map[string]string{
+			"FEATURES": b.FeatureString(),
+		},
 	}
 
-	fmt.Printf("%s\n", cmdLine)
-	return util.ShellInteractiveCommand(cmdLine, envSettings)
+	return flasher.Debug(f, args)
 }
 
 func (b *Builder) Debug(extraJtagCmd string, reset bool, noGDB bool) error {
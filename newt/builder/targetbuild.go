@@ -215,13 +215,29 @@ func (t *TargetBuilder) generateSysinit() error {
 
 	if t.res.LoaderSet != nil {
 		lpkgs := resolve.RpkgSliceToLpkgSlice(t.res.LoaderSet.Rpkgs)
-		sysinit.EnsureWritten(lpkgs, srcDir,
-			pkg.ShortName(t.target.Package()), true)
+		if err := sysinit.EnsureWritten(lpkgs, srcDir,
+			pkg.ShortName(t.target.Package()), true); err != nil {
+
+			return err
+		}
+		if err := sysinit.EnsureSysdownWritten(lpkgs, srcDir,
+			pkg.ShortName(t.target.Package()), true); err != nil {
+
+			return err
+		}
 	}
 
 	lpkgs := resolve.RpkgSliceToLpkgSlice(t.res.AppSet.Rpkgs)
-	sysinit.EnsureWritten(lpkgs, srcDir,
-		pkg.ShortName(t.target.Package()), false)
+	if err := sysinit.EnsureWritten(lpkgs, srcDir,
+		pkg.ShortName(t.target.Package()), false); err != nil {
+
+		return err
+	}
+	if err := sysinit.EnsureSysdownWritten(lpkgs, srcDir,
+		pkg.ShortName(t.target.Package()), false); err != nil {
+
+		return err
+	}
 
 	return nil
 }
@@ -255,6 +271,10 @@ func (t *TargetBuilder) PrepBuild() error {
 		return util.NewNewtError(flashErrText)
 	}
 
+	if errs := t.trailerErrors(); len(errs) > 0 {
+		return util.NewNewtError(strings.Join(errs, "\n"))
+	}
+
 	if err := t.validateAndWriteCfg(); err != nil {
 		return err
 	}
@@ -708,6 +728,17 @@ func (t *TargetBuilder) bootTrailerSize() int {
 	return tsize
 }
 
+// Verifies that the boot trailer fits in the image slots and scratch area.
+// This check is only performed for BSPs that describe the sector layout of
+// their image slots.
+func (t *TargetBuilder) trailerErrors() []string {
+	if t.bspPkg.FlashMap.ImageSectorCount() == 0 {
+		return nil
+	}
+
+	return t.bspPkg.FlashMap.TrailerErrors(t.bootTrailerSize())
+}
+
 // Calculates the size of the largest image that can be written to each image
 // slot.
 func (t *TargetBuilder) maxImgSizes() []int {
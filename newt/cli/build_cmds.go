@@ -424,13 +424,24 @@ func AddBuildCommands(cmd *cobra.Command) {
 		return append(testablePkgList(), "all", "allexcept")
 	})
 
-	loadHelpText := "Load application image on to the board for <target-name>"
+	loadHelpText := "Load application image on to the board for " +
+		"<target-name>.  The image is written by the flasher that the BSP " +
+		"selects (bsp.flasher: script, openocd, jlink, or pyocd; default: " +
+		"script, which runs bsp.downloadscript).  The flasher and its " +
+		"settings can be overridden in ~/.newt/newtrc.yml (flasher, " +
+		"flasher_settings.<flasher>.<setting>) or in the target " +
+		"(target.flasher, target.flasher.<flasher>.<setting>)."
+	loadHelpEx := "  newt load my_target1\n"
+	loadHelpEx += "  newt target set my_target1 flasher=jlink " +
+		"flasher.jlink.serial=123456\n"
+	loadHelpEx += "  newt load my_target1"
 
 	loadCmd := &cobra.Command{
-		Use:   "load <target-name>",
-		Short: "Load built target to board",
-		Long:  loadHelpText,
-		Run:   loadRunCmd,
+		Use:     "load <target-name>",
+		Short:   "Load built target to board",
+		Long:    loadHelpText,
+		Example: loadHelpEx,
+		Run:     loadRunCmd,
 	}
 
 	cmd.AddCommand(loadCmd)
@@ -439,7 +450,9 @@ func AddBuildCommands(cmd *cobra.Command) {
 	loadCmd.PersistentFlags().StringVarP(&extraJtagCmd, "extrajtagcmd", "", "",
 		"Extra commands to send to JTAG software")
 
-	debugHelpText := "Open a debugger session for <target-name>"
+	debugHelpText := "Open a debugger session for <target-name>.  The " +
+		"session is started by the target's flasher (see \"newt load " +
+		"--help\")."
 
 	debugCmd := &cobra.Command{
 		Use:   "debug <target-name>",
@@ -28,6 +28,11 @@ import (
 	"mynewt.apache.org/newt/util"
 )
 
+var mfgRecordsPath string
+var mfgInspectUnit string
+var mfgFormat string
+var mfgLoadUnit string
+
 func ResolveMfgPkg(pkgName string) (*pkg.LocalPackage, error) {
 	proj := TryGetProject()
 
@@ -74,13 +79,26 @@ func mfgCreate(mi *mfg.MfgImage) {
 }
 
 func mfgLoad(mi *mfg.MfgImage) {
-	binPath, err := mi.Upload()
+	unitId := ""
+	if mfgLoadUnit != "" {
+		var err error
+		unitId, err = mfg.CleanUnitId(mfgLoadUnit)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+	}
+
+	binPaths, err := mi.Upload(unitId)
 	if err != nil {
 		NewtUsage(nil, err)
 	}
 
+	pathStr := ""
+	for _, path := range binPaths {
+		pathStr += "    * " + path + "\n"
+	}
 	util.StatusMessage(util.VERBOSITY_DEFAULT,
-		"Uploaded manufacturing image: %s\n", binPath)
+		"Uploaded manufacturing image:\n%s", pathStr)
 }
 
 func mfgCreateRunCmd(cmd *cobra.Command, args []string) {
@@ -106,6 +124,14 @@ func mfgCreateRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(nil, err)
 	}
 
+	if err := mi.LoadRecords(mfgRecordsPath); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if err := mi.SetFormat(mfgFormat); err != nil {
+		NewtUsage(cmd, err)
+	}
+
 	mi.SetVersion(ver)
 	mfgCreate(mi)
 }
@@ -154,12 +180,61 @@ func mfgDeployRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(nil, err)
 	}
 
+	if err := mi.LoadRecords(mfgRecordsPath); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if err := mi.SetFormat(mfgFormat); err != nil {
+		NewtUsage(cmd, err)
+	}
+
 	mi.SetVersion(ver)
 	mfgCreate(mi)
 
 	mfgLoad(mi)
 }
 
+func mfgInspectRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify a section 0 file or mfg package name"))
+	}
+
+	path := args[0]
+	if util.NodeNotExist(path) || mfgInspectUnit != "" {
+		lpkg, err := ResolveMfgPkg(args[0])
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+
+		if mfgInspectUnit != "" {
+			unitId, err := mfg.CleanUnitId(mfgInspectUnit)
+			if err != nil {
+				NewtUsage(nil, err)
+			}
+			path = mfg.MfgUnitSectionBinPath(lpkg.Name(), unitId, 0)
+		} else {
+			path = mfg.MfgSectionBinPath(lpkg.Name(), 0)
+		}
+		if util.NodeNotExist(path) {
+			NewtUsage(nil, util.FmtNewtError(
+				"%s does not exist; run \"newt mfg create\" first", path))
+		}
+	}
+
+	ins, err := mfg.Inspect(path)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", ins.Text())
+
+	if !ins.Ok() {
+		NewtUsage(nil, util.NewNewtError(
+			"Manufacturing image verification failed"))
+	}
+}
+
 func AddMfgCommands(cmd *cobra.Command) {
 	mfgHelpText := ""
 	mfgHelpEx := ""
@@ -175,27 +250,117 @@ func AddMfgCommands(cmd *cobra.Command) {
 
 	cmd.AddCommand(mfgCmd)
 
+	mfgCreateHelpText := "Create a manufacturing flash image.  If the " +
+		"mfg package defines provisioning fields (mfg.provision), a " +
+		"separate set of sections containing per-device data (serial " +
+		"numbers, MAC addresses, certificates, etc.) is generated for each " +
+		"record in the records file.  Records are read from a CSV file " +
+		"with a header row or from a JSON array of objects; each column or " +
+		"key names a provisioning field.\n\n" +
+		"Example mfg.yml provisioning template:\n\n" +
+		"    mfg.provision:\n" +
+		"        records: units.csv      # Optional; see --records.\n" +
+		"        id_field: serial        # Default: the first field.\n" +
+		"        fields:\n" +
+		"            - name: serial\n" +
+		"              device: 0\n" +
+		"              offset: 0x7c000\n" +
+		"              encoding: ascii\n" +
+		"              size: 16\n" +
+		"              pad: 0x00\n" +
+		"            - name: mac\n" +
+		"              device: 0\n" +
+		"              offset: 0x7c010\n" +
+		"              encoding: hex\n\n" +
+		"Supported encodings: ascii, hex, base64, file (value is a path " +
+		"relative to the records file), u8, u16le, u16be, u32le, u32be, " +
+		"u64le, u64be.  Fields with a size are padded with the pad byte " +
+		"(default 0xff).\n\n" +
+		"Raw .bin sections are always generated.  With --format ihex or " +
+		"--format srec, each section is also written as Intel HEX or " +
+		"Motorola S-records, along with a single file covering every " +
+		"device.  Addresses are computed from the device base addresses " +
+		"declared in the BSP flash map (bsp.flash_map.devices.<id>.base; " +
+		"default 0).  Runs of unwritten flash (0xff) are left out of these " +
+		"files rather than padded." +
+		"\n\n" +
+		"Custom TLVs can be added to the meta region with mfg.meta.tlvs; " +
+		"each entry specifies a type code and one of value (encoded as " +
+		"above), file (optionally reduced with hash: sha256), or syscfg (a " +
+		"setting of the boot loader target).  mfg.meta.max_size limits the " +
+		"size of the meta region."
+
 	mfgCreateCmd := &cobra.Command{
 		Use:   "create <mfg-package-name> <version #.#.#.#>",
 		Short: "Create a manufacturing flash image",
+		Long:  mfgCreateHelpText,
 		Run:   mfgCreateRunCmd,
 	}
+	mfgCreateCmd.PersistentFlags().StringVarP(&mfgRecordsPath, "records", "",
+		"", "CSV or JSON file containing per-device provisioning records")
+	mfgCreateCmd.PersistentFlags().StringVarP(&mfgFormat, "format", "",
+		mfg.MFG_FORMAT_BIN, "Output format: bin, ihex, or srec")
 	mfgCmd.AddCommand(mfgCreateCmd)
 	AddTabCompleteFn(mfgCreateCmd, mfgList)
 
+	mfgLoadHelpText := "Load every section of a manufacturing image onto " +
+		"a device using the BSP's flasher.  Each section is written to its " +
+		"device's base address.  A BSP download script is run once per " +
+		"flash device with MFG_IMAGE=1, MFG_DEVICE=<device id>, " +
+		"FLASH_OFFSET=0x0, and MFG_DEVICE_BASE / FLASH_ADDRESS=<device " +
+		"base address> in its environment; the BSP must list every device " +
+		"its script can program in bsp.download_devices (default: " +
+		"device 0 only).  " +
+		"Other flashers write only to device 0 and to devices that " +
+		"declare a base address in bsp.flash_map.devices.  " +
+		"Nothing is loaded if the image contains data for an unsupported " +
+		"device."
+
 	mfgLoadCmd := &cobra.Command{
 		Use:   "load <mfg-package-name>",
 		Short: "Load a manufacturing flash image onto a device",
+		Long:  mfgLoadHelpText,
 		Run:   mfgLoadRunCmd,
 	}
+	mfgLoadCmd.PersistentFlags().StringVarP(&mfgLoadUnit, "unit", "", "",
+		"Load the sections of the specified provisioned unit")
 	mfgCmd.AddCommand(mfgLoadCmd)
 	AddTabCompleteFn(mfgLoadCmd, mfgList)
 
+	mfgInspectHelpText := "Read back a manufacturing image and verify its " +
+		"contents.  The meta region is located by its magic number at the " +
+		"end of the boot loader area of section 0, and its flash area and " +
+		"hash TLVs are decoded.  The manufacturing hash is recomputed over " +
+		"all sections (files named <mfg>-s<N>.bin next to the section 0 " +
+		"file), and the embedded firmware images are parsed and their " +
+		"hashes verified.  The command fails if any check does not pass."
+	mfgInspectHelpEx := "  newt mfg inspect my_mfg\n"
+	mfgInspectHelpEx += "  newt mfg inspect my_mfg --unit SN001\n"
+	mfgInspectHelpEx += "  newt mfg inspect factory/my_mfg-s0.bin"
+
+	mfgInspectCmd := &cobra.Command{
+		Use:     "inspect <section0.bin | mfg-package-name>",
+		Short:   "Decode and verify a manufacturing image",
+		Long:    mfgInspectHelpText,
+		Example: mfgInspectHelpEx,
+		Run:     mfgInspectRunCmd,
+	}
+	mfgInspectCmd.PersistentFlags().StringVarP(&mfgInspectUnit, "unit", "",
+		"", "Inspect the sections of the specified provisioned unit")
+	mfgCmd.AddCommand(mfgInspectCmd)
+	AddTabCompleteFn(mfgInspectCmd, mfgList)
+
 	mfgDeployCmd := &cobra.Command{
 		Use:   "deploy <mfg-package-name> [version #.#.#.#]",
 		Short: "Build and upload a manufacturing image (create + load)",
 		Run:   mfgDeployRunCmd,
 	}
+	mfgDeployCmd.PersistentFlags().StringVarP(&mfgRecordsPath, "records",
+		"", "", "CSV or JSON file containing per-device provisioning records")
+	mfgDeployCmd.PersistentFlags().StringVarP(&mfgFormat, "format", "",
+		mfg.MFG_FORMAT_BIN, "Output format: bin, ihex, or srec")
+	mfgDeployCmd.PersistentFlags().StringVarP(&mfgLoadUnit, "unit", "", "",
+		"Load the sections of the specified provisioned unit")
 	mfgCmd.AddCommand(mfgDeployCmd)
 	AddTabCompleteFn(mfgDeployCmd, mfgList)
 }
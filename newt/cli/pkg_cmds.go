@@ -31,10 +31,14 @@ import (
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/repo"
 	"mynewt.apache.org/newt/util"
 )
 
 var NewTypeStr = "pkg"
+var NewTemplateStr string
+var NewAuthorStr string
+var NewDescriptionStr string
 
 func pkgNewCmd(cmd *cobra.Command, args []string) {
 
@@ -46,10 +50,36 @@ func pkgNewCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(cmd, util.NewNewtError("Exactly one argument required"))
 	}
 
-	NewTypeStr = strings.ToUpper(NewTypeStr)
+	if NewTemplateStr != "" && cmd.Flags().Changed("type") {
+		NewtUsage(cmd, util.NewNewtError(
+			"Cannot specify both --type and --template"))
+	}
+
+	proj := TryGetProject()
+
+	var tmpl *project.PackageTemplate
+	if NewTemplateStr != "" {
+		var err error
+		tmpl, err = proj.FindPackageTemplate(NewTemplateStr)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+	} else {
+		tmpl = &project.PackageTemplate{
+			Name:   strings.ToLower(NewTypeStr),
+			Source: project.PKG_TEMPLATE_SRC_BUILTIN,
+		}
+	}
+
+	author := NewAuthorStr
+	if author == "" {
+		author = project.DefaultTemplateAuthor()
+	}
 
 	pw := project.NewPackageWriter()
-	if err := pw.ConfigurePackage(NewTypeStr, args[0]); err != nil {
+	if err := pw.ConfigureTemplate(tmpl, args[0], author,
+		NewDescriptionStr); err != nil {
+
 		NewtUsage(cmd, err)
 	}
 	if err := pw.WritePackage(); err != nil {
@@ -57,6 +87,127 @@ func pkgNewCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+func pkgTemplatesCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		NewtUsage(cmd, util.NewNewtError("No arguments expected"))
+	}
+
+	proj := TryGetProject()
+
+	tmpls := proj.PackageTemplates()
+	nameWidth := 0
+	srcWidth := 0
+	for _, tmpl := range tmpls {
+		if len(tmpl.Name) > nameWidth {
+			nameWidth = len(tmpl.Name)
+		}
+		if len(tmpl.Source) > srcWidth {
+			srcWidth = len(tmpl.Source)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, tmpl := range tmpls {
+		// Only the first template with a given name is selectable without a
+		// repo qualifier.
+		selector := ""
+		if seen[strings.ToLower(tmpl.Name)] {
+			if tmpl.Source == project.PKG_TEMPLATE_SRC_BUILTIN {
+				selector = "--type " + tmpl.Name
+			} else {
+				selector = "--template " +
+					strings.TrimPrefix(tmpl.Source, "@") + "@" + tmpl.Name
+			}
+		}
+		seen[strings.ToLower(tmpl.Name)] = true
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    %-*s  %-*s  %s\n",
+			nameWidth, tmpl.Name, srcWidth, tmpl.Source, tmpl.Description)
+		if selector != "" {
+			util.StatusMessage(util.VERBOSITY_VERBOSE,
+				"        (shadowed; select with %s)\n", selector)
+		}
+	}
+}
+
+var pkgSearchRemote bool
+var pkgIndexOutput string
+
+func pkgSearchCmd(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		NewtUsage(cmd, util.NewNewtError("Must specify a search query"))
+	}
+
+	proj := TryGetProject()
+	interfaces.SetProject(proj)
+
+	results, err := proj.SearchPackages(strings.Join(args, " "),
+		pkgSearchRemote)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(results) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "No matching packages.\n")
+		return
+	}
+
+	for _, res := range results {
+		versStrs := make([]string, len(res.Versions))
+		for i, vers := range res.Versions {
+			versStrs[i] = versionText(vers)
+		}
+
+		versText := strings.Join(versStrs, ", ")
+		if !res.Installed {
+			if versText == "" {
+				versText = "not installed"
+			} else {
+				versText = "not installed; versions: " + versText
+			}
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "@%s/%s (%s)",
+			res.Repo, res.Entry.Name, res.Entry.Type)
+		if versText != "" {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, " [%s]", versText)
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "\n")
+
+		if res.Entry.Description != "" {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "    %s\n",
+				res.Entry.Description)
+		}
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "    matched: %s\n",
+			strings.Join(res.Matches, ", "))
+		if len(res.Entry.Apis) > 0 {
+			util.StatusMessage(util.VERBOSITY_VERBOSE, "    apis: %s\n",
+				strings.Join(res.Entry.Apis, ", "))
+		}
+	}
+}
+
+func pkgIndexCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		NewtUsage(cmd, util.NewNewtError("No arguments expected"))
+	}
+
+	proj := TryGetProject()
+
+	path := pkgIndexOutput
+	if path == "" {
+		path = proj.Path() + "/" + repo.PKG_INDEX_FILE_NAME
+	}
+
+	count, err := proj.WritePackageIndex(path)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Wrote index of %d packages to %s\n", count, path)
+}
+
 type dirOperation func(string, string) error
 
 func pkgCopyCmd(cmd *cobra.Command, args []string) {
@@ -231,8 +382,27 @@ func AddPackageCommands(cmd *cobra.Command) {
 	cmd.AddCommand(pkgCmd)
 
 	/* Package new command, create a new package */
-	newCmdHelpText := ""
-	newCmdHelpEx := ""
+	newCmdHelpText := "Create a new package from a template.  A template " +
+		"is either built-in (pkg, bsp, or sdk), a directory in the " +
+		"\"" + project.PKG_TEMPLATE_DIR + "\" directory of the project or " +
+		"of any installed repository, or an arbitrary directory.  Select a " +
+		"template with --template <name>, --template <path>, or --template " +
+		"<repo>@<name>.\n\n" +
+		"The following variables are substituted in the names and contents " +
+		"of a template's files:\n" +
+		"    {{pkg_name}}       Full name of the new package\n" +
+		"    {{pkg_base}}       Last path component of the package name\n" +
+		"    {{c_ident}}        Package base name as a C identifier\n" +
+		"    {{C_IDENT}}        Upper case C identifier\n" +
+		"    {{author}}         Package author (--author)\n" +
+		"    {{description}}    Package description (--description)\n\n" +
+		"A template may contain a " + project.PKG_TEMPLATE_FILE_NAME +
+		" file with a template.description setting; this file is not " +
+		"copied into the new package."
+	newCmdHelpEx := "  newt pkg new -t bsp hw/bsp/myboard\n"
+	newCmdHelpEx += "  newt pkg new --template driver hw/drivers/mydrv\n"
+	newCmdHelpEx += "  newt pkg new --template my-repo@driver hw/drivers/mydrv\n"
+	newCmdHelpEx += "  newt pkg new --template ../templates/lib libs/mylib"
 
 	newCmd := &cobra.Command{
 		Use:     "new <package-name>",
@@ -244,9 +414,29 @@ func AddPackageCommands(cmd *cobra.Command) {
 
 	newCmd.PersistentFlags().StringVarP(&NewTypeStr, "type", "t",
 		"pkg", "Type of package to create: pkg, bsp, sdk.")
+	newCmd.PersistentFlags().StringVarP(&NewTemplateStr, "template", "",
+		"", "Template to create the package from: name, path, or "+
+			"<repo>@<name>")
+	newCmd.PersistentFlags().StringVarP(&NewAuthorStr, "author", "", "",
+		"Package author (default: git user name)")
+	newCmd.PersistentFlags().StringVarP(&NewDescriptionStr, "description",
+		"", "", "Package description")
 
 	pkgCmd.AddCommand(newCmd)
 
+	templatesCmdHelpText := "List the package templates available to " +
+		"\"newt pkg new\".  When several templates share a name, the first " +
+		"one listed is selected by that name."
+
+	templatesCmd := &cobra.Command{
+		Use:   "templates",
+		Short: "List available package templates",
+		Long:  templatesCmdHelpText,
+		Run:   pkgTemplatesCmd,
+	}
+
+	pkgCmd.AddCommand(templatesCmd)
+
 	copyCmdHelpText := "Create a new package <dst-pkg> by cloning <src-pkg>"
 	copyCmdHelpEx := "  newt pkg copy apps/blinky apps/myapp"
 
@@ -273,6 +463,46 @@ func AddPackageCommands(cmd *cobra.Command) {
 
 	pkgCmd.AddCommand(moveCmd)
 
+	searchCmdHelpText := "Search for packages whose name, description, " +
+		"keywords (pkg.keywords), or exported APIs (pkg.apis) contain " +
+		"every word of <query>.  Matching is case insensitive.  By default, " +
+		"only installed repositories are searched; with --remote, " +
+		"repositories that are listed in project.yml but not installed are " +
+		"also searched via the package index (" + repo.PKG_INDEX_FILE_NAME +
+		") they publish next to their repository.yml."
+	searchCmdHelpEx := "  newt pkg search bme280\n"
+	searchCmdHelpEx += "  newt pkg search --remote sensor i2c\n"
+	searchCmdHelpEx += "  newt -v pkg search log"
+
+	searchCmd := &cobra.Command{
+		Use:     "search <query>",
+		Short:   "Search for packages across repositories",
+		Long:    searchCmdHelpText,
+		Example: searchCmdHelpEx,
+		Run:     pkgSearchCmd,
+	}
+	searchCmd.PersistentFlags().BoolVarP(&pkgSearchRemote, "remote", "r",
+		false, "Also search repositories that are not installed")
+
+	pkgCmd.AddCommand(searchCmd)
+
+	indexCmdHelpText := "Write a package index describing the packages in " +
+		"the local project.  A repository publishes its index by " +
+		"committing " + repo.PKG_INDEX_FILE_NAME + " next to its " +
+		"repository.yml; this allows \"newt pkg search --remote\" to find " +
+		"its packages without installing it."
+
+	indexCmd := &cobra.Command{
+		Use:   "index",
+		Short: "Generate a package index for the local project",
+		Long:  indexCmdHelpText,
+		Run:   pkgIndexCmd,
+	}
+	indexCmd.PersistentFlags().StringVarP(&pkgIndexOutput, "output", "",
+		"", "Output file (default: <project>/"+repo.PKG_INDEX_FILE_NAME+")")
+
+	pkgCmd.AddCommand(indexCmd)
+
 	removeCmdHelpText := ""
 	removeCmdHelpEx := ""
 
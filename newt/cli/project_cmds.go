@@ -21,18 +21,41 @@ package cli
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"mynewt.apache.org/newt/newt/compat"
 	"mynewt.apache.org/newt/newt/downloader"
 	"mynewt.apache.org/newt/newt/interfaces"
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/repo"
 	"mynewt.apache.org/newt/util"
 )
 
+var installLocked bool
+var syncRebase bool
+var syncDryRun bool
+var projectMirrorDir string
+
+// Redirects all repository downloads to the mirror directory specified on the
+// command line, if any.  This must be called before the project is loaded.
+func applyMirrorOption() {
+	if projectMirrorDir == "" {
+		return
+	}
+
+	dir, err := filepath.Abs(projectMirrorDir)
+	if err != nil {
+		NewtUsage(nil, util.NewNewtError(err.Error()))
+	}
+	downloader.MirrorDir = filepath.ToSlash(dir)
+}
+
 func newRunCmd(cmd *cobra.Command, args []string) {
 	if len(args) < 1 {
 		NewtUsage(cmd, util.NewNewtError("Must specify "+
@@ -68,20 +91,40 @@ func newRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(cmd, err)
 	}
 
+	// Workspace overrides are developer-specific; keep them out of git.
+	ignorePath := newDir + "/.gitignore"
+	ignore, _ := ioutil.ReadFile(ignorePath)
+	if len(ignore) > 0 && !strings.HasSuffix(string(ignore), "\n") {
+		ignore = append(ignore, '\n')
+	}
+	ignore = append(ignore, []byte(project.PROJECT_OVERRIDE_FILE+"\n")...)
+	if err := ioutil.WriteFile(ignorePath, ignore, 0644); err != nil {
+		NewtUsage(cmd, util.NewNewtError(err.Error()))
+	}
+
 	util.StatusMessage(util.VERBOSITY_DEFAULT,
 		"Project %s successfully created.\n", newDir)
 }
 
 func installRunCmd(cmd *cobra.Command, args []string) {
+	applyMirrorOption()
 	proj := TryGetProject()
 	interfaces.SetProject(proj)
 
+	if installLocked {
+		if err := proj.InstallLocked(newtutil.NewtForce); err != nil {
+			NewtUsage(nil, err)
+		}
+		return
+	}
+
 	if err := proj.Install(false, newtutil.NewtForce); err != nil {
 		NewtUsage(cmd, err)
 	}
 }
 
 func upgradeRunCmd(cmd *cobra.Command, args []string) {
+	applyMirrorOption()
 	proj := TryGetProject()
 	interfaces.SetProject(proj)
 
@@ -149,30 +192,35 @@ func infoRunCmd(cmd *cobra.Command, args []string) {
 }
 
 func syncRunCmd(cmd *cobra.Command, args []string) {
+	applyMirrorOption()
 	proj := TryGetProject()
 	repos := proj.Repos()
 
-	ps, err := project.LoadProjectState()
-	if err != nil {
-		NewtUsage(nil, err)
+	opts := repo.SyncOptions{
+		Force:  newtutil.NewtForce,
+		Rebase: syncRebase,
+		DryRun: syncDryRun,
 	}
 
+	repoNames := []string{}
+	for name, _ := range repos {
+		repoNames = append(repoNames, name)
+	}
+	sort.Strings(repoNames)
+
 	var failedRepos []string
-	for _, repo := range repos {
-		var exists bool
-		var updated bool
-		if repo.IsLocal() {
+	for _, name := range repoNames {
+		r := repos[name]
+		if r.IsLocal() {
 			continue
 		}
-		vers := ps.GetInstalledVersion(repo.Name())
-		if vers == nil {
-			util.StatusMessage(util.VERBOSITY_DEFAULT,
-				"No installed version of %s found, skipping\n\n",
-				repo.Name())
+		exists, updated, err := proj.SyncRepo(r, opts)
+		if err != nil {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "Error: %s\n",
+				err.Error())
 		}
-		exists, updated, err = repo.Sync(vers, newtutil.NewtForce)
-		if exists && !updated {
-			failedRepos = append(failedRepos, repo.Name())
+		if exists && !updated && !opts.DryRun {
+			failedRepos = append(failedRepos, r.Name())
 		}
 	}
 	if len(failedRepos) > 0 {
@@ -180,15 +228,207 @@ func syncRunCmd(cmd *cobra.Command, args []string) {
 		if !newtutil.NewtForce {
 			forceMsg = " To force resync, add the -f (force) option."
 		}
-		err = util.NewNewtError(fmt.Sprintf("Failed for repos: %v."+
-			forceMsg, failedRepos))
+		NewtUsage(nil, util.NewNewtError(fmt.Sprintf(
+			"Failed for repos: %v."+forceMsg, failedRepos)))
+	}
+}
+
+func projectVendorRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify a mirror directory"))
+	}
+
+	dir, err := filepath.Abs(args[0])
+	if err != nil {
+		NewtUsage(nil, util.NewNewtError(err.Error()))
+	}
+
+	// The mirror gets populated from the repositories' real remotes.
+	downloader.MirrorDisabled = true
+
+	proj := TryGetProject()
+	interfaces.SetProject(proj)
+
+	if err := proj.Vendor(filepath.ToSlash(dir)); err != nil {
 		NewtUsage(nil, err)
 	}
 }
 
+func versionText(vers *repo.Version) string {
+	return fmt.Sprintf("%d.%d.%d", vers.Major(), vers.Minor(), vers.Revision())
+}
+
+func printRepoStatus(rs *repo.RepoStatus) {
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "    * @%s\n", rs.Name)
+	if rs.PathOverride {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"        OVERRIDE:  path %s\n", rs.Path)
+	} else if rs.BranchOverride != "" {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"        OVERRIDE:  branch %s\n", rs.BranchOverride)
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "        required:  %s\n",
+		rs.Required)
+
+	if rs.Installed == nil {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"        installed: (none)\n")
+	} else {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "        installed: %s\n",
+			versionText(rs.Installed))
+	}
+
+	if !rs.Exists {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"        checkout:  (missing)\n")
+	} else {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"        checkout:  %s (%s)\n", rs.Branch, rs.Commit)
+
+		state := "clean"
+		if rs.Dirty {
+			state = "dirty"
+		}
+		if rs.Patched {
+			state += " (patched)"
+		}
+		if rs.VersBranch != "" {
+			if rs.Ahead < 0 {
+				state += fmt.Sprintf("; unknown drift from %s", rs.VersBranch)
+			} else if rs.Ahead == 0 && rs.Behind == 0 {
+				state += fmt.Sprintf("; up to date with %s", rs.VersBranch)
+			} else {
+				state += fmt.Sprintf("; %d ahead, %d behind %s", rs.Ahead,
+					rs.Behind, rs.VersBranch)
+			}
+			if rs.Branch != "HEAD" && rs.Branch != rs.VersBranch {
+				state += fmt.Sprintf("; expected branch %s", rs.VersBranch)
+			}
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "        tree:      %s\n",
+			state)
+	}
+
+	compatText := compat.NewtCompatCodeNames[rs.CompatCode]
+	if rs.CompatMsg != "" {
+		compatText += "; " + rs.CompatMsg
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "        newt:      %s\n",
+		compatText)
+}
+
+func projectStatusRunCmd(cmd *cobra.Command, args []string) {
+	proj := TryGetProject()
+
+	ps, err := project.LoadProjectState()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	repoNames := []string{}
+	for name, r := range proj.Repos() {
+		if !r.IsLocal() {
+			repoNames = append(repoNames, name)
+		}
+	}
+	sort.Strings(repoNames)
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Repository status for %s:\n",
+		proj.Name())
+
+	numBad := 0
+	for _, name := range repoNames {
+		r := proj.Repos()[name]
+		rs, err := r.Status(ps.GetInstalledVersion(name),
+			proj.PatchedFiles(r))
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		printRepoStatus(rs)
+
+		if !rs.Exists || rs.Installed == nil || rs.Drifted() ||
+			rs.CompatCode != compat.NEWT_COMPAT_GOOD {
+
+			numBad++
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "\n")
+	if overrides := proj.OverriddenRepoNames(); len(overrides) > 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"WARNING: workspace overrides in %s are active for: %s\n",
+			project.PROJECT_OVERRIDE_FILE, strings.Join(overrides, ", "))
+	}
+	if numBad == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"All %d repositories are up to date.\n", len(repoNames))
+	} else {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"%d of %d repositories need attention.\n", numBad,
+			len(repoNames))
+	}
+}
+
+func projectPatchesStatusRunCmd(cmd *cobra.Command, args []string) {
+	proj := TryGetProject()
+	interfaces.SetProject(proj)
+
+	repoNames := []string{}
+	for name, r := range proj.Repos() {
+		if !r.IsLocal() {
+			repoNames = append(repoNames, name)
+		}
+	}
+	sort.Strings(repoNames)
+
+	numBad := 0
+	for _, name := range repoNames {
+		r := proj.Repos()[name]
+		statuses := proj.PatchStatuses(r)
+		if len(statuses) == 0 {
+			continue
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "@%s:\n", name)
+		if util.NodeNotExist(r.Path()) {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"    (repository not installed)\n")
+			numBad++
+			continue
+		}
+
+		for _, ps := range statuses {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "    * %s: %s",
+				ps.Spec, ps.Status)
+			if ps.Detail != "" {
+				util.StatusMessage(util.VERBOSITY_DEFAULT, " (%s)", ps.Detail)
+			}
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "\n")
+
+			if ps.Status != project.PATCH_STATUS_APPLIED {
+				numBad++
+			}
+		}
+	}
+
+	if numBad == 1 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"\n1 patch needs attention.\n")
+	} else if numBad > 1 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"\n%d patches need attention.\n", numBad)
+	}
+}
+
 func AddProjectCommands(cmd *cobra.Command) {
-	installHelpText := ""
-	installHelpEx := ""
+	installHelpText := "Install the repositories that the project depends " +
+		"on.  The exact commit of each installed repository is recorded in " +
+		project.PROJECT_LOCK_FILE + ".  With --locked, every repository is " +
+		"installed at the commit recorded in " + project.PROJECT_LOCK_FILE +
+		" rather than the latest commit matching project.yml."
+	installHelpEx := "  newt install\n"
+	installHelpEx += "  newt install --locked"
 	installCmd := &cobra.Command{
 		Use:     "install",
 		Short:   "Install project dependencies",
@@ -200,10 +440,18 @@ func AddProjectCommands(cmd *cobra.Command) {
 		"force", "f", false,
 		"Force install of the repositories in project, regardless of what "+
 			"exists in repos directory")
+	installCmd.PersistentFlags().BoolVarP(&installLocked,
+		"locked", "", false,
+		"Install the exact commits recorded in "+project.PROJECT_LOCK_FILE)
+	installCmd.PersistentFlags().StringVarP(&projectMirrorDir,
+		"mirror", "", "",
+		"Download repositories from a directory of bare git mirrors")
 
 	cmd.AddCommand(installCmd)
 
-	upgradeHelpText := ""
+	upgradeHelpText := "Upgrade the repositories that the project depends " +
+		"on to the latest versions matching project.yml, and refresh " +
+		project.PROJECT_LOCK_FILE + " with the resulting commits."
 	upgradeHelpEx := ""
 	upgradeCmd := &cobra.Command{
 		Use:     "upgrade",
@@ -215,11 +463,26 @@ func AddProjectCommands(cmd *cobra.Command) {
 	upgradeCmd.PersistentFlags().BoolVarP(&newtutil.NewtForce,
 		"force", "f", false,
 		"Force upgrade of the repositories to latest state in project.yml")
+	upgradeCmd.PersistentFlags().StringVarP(&projectMirrorDir,
+		"mirror", "", "",
+		"Download repositories from a directory of bare git mirrors")
 
 	cmd.AddCommand(upgradeCmd)
 
-	syncHelpText := ""
-	syncHelpEx := ""
+	syncHelpText := "Bring each installed repository up to date with the " +
+		"branch that its installed version maps to.  Local work is never " +
+		"discarded.  If a repository contains local commits, uncommitted " +
+		"changes, or untracked files, the sync of that repository is " +
+		"refused unless one of the following options is given:\n\n" +
+		"  --rebase  Stash uncommitted changes, rebase local commits onto " +
+		"the new version, and restore the changes.\n" +
+		"  -f        Stash uncommitted changes to refs/newt/stash/<time>, " +
+		"save the current commit to refs/newt/sync/<time>, and check out " +
+		"the new version.\n\n" +
+		"The planned steps for each repository are printed before they " +
+		"are performed; use --dry-run to only print them."
+	syncHelpEx := "  newt sync --dry-run\n" +
+		"  newt sync --rebase"
 	syncCmd := &cobra.Command{
 		Use:     "sync",
 		Short:   "Synchronize project dependencies",
@@ -229,7 +492,16 @@ func AddProjectCommands(cmd *cobra.Command) {
 	}
 	syncCmd.PersistentFlags().BoolVarP(&newtutil.NewtForce,
 		"force", "f", false,
-		"Force overwrite of existing remote repositories.")
+		"Save local work to named refs and check out the new version")
+	syncCmd.PersistentFlags().BoolVarP(&syncRebase,
+		"rebase", "", false,
+		"Rebase local commits onto the new version")
+	syncCmd.PersistentFlags().BoolVarP(&syncDryRun,
+		"dry-run", "", false,
+		"Print the sync plan without changing any repositories")
+	syncCmd.PersistentFlags().StringVarP(&projectMirrorDir,
+		"mirror", "", "",
+		"Download repositories from a directory of bare git mirrors")
 	cmd.AddCommand(syncCmd)
 
 	newHelpText := ""
@@ -256,4 +528,97 @@ func AddProjectCommands(cmd *cobra.Command) {
 	}
 
 	cmd.AddCommand(infoCmd)
+
+	projectHelpText := "Manage the current project"
+
+	projectCmd := &cobra.Command{
+		Use:   "project",
+		Short: projectHelpText,
+		Long:  projectHelpText,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+		},
+	}
+
+	cmd.AddCommand(projectCmd)
+
+	vendorHelpText := "Populate a mirror directory with every repository " +
+		"the project depends on, including dependencies declared by each " +
+		"repository's repository.yml file.  Each repository is stored as a " +
+		"bare git repository named <repo-name>.git containing all of its " +
+		"branches and tags.  If the mirror already exists, it is updated.  " +
+		"Use the mirror with \"newt install --mirror <dir>\" or the " +
+		"mirror.dir setting in ~/.newt/newtrc.yml."
+	vendorHelpEx := "  newt project vendor /srv/newt-mirror"
+
+	vendorCmd := &cobra.Command{
+		Use:     "vendor <dir>",
+		Short:   "Populate a mirror with the project's repositories",
+		Long:    vendorHelpText,
+		Example: vendorHelpEx,
+		Run:     projectVendorRunCmd,
+	}
+
+	projectCmd.AddCommand(vendorCmd)
+
+	statusHelpText := "Display the state of each repository in the " +
+		"project: the required version from project.yml, the installed " +
+		"version from project.state, the checked out branch and commit, " +
+		"whether the working tree has local changes, the number of commits " +
+		"it is ahead of and behind the branch that the installed version " +
+		"maps to, and the repository's compatibility with this version of " +
+		"newt.  Changes made by the patches listed in project.yml are " +
+		"reported as \"patched\" rather than as local changes.  Nothing " +
+		"is downloaded; ahead and behind counts are relative to the most " +
+		"recent fetch."
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Display the state of the project's repositories",
+		Long:  statusHelpText,
+		Run:   projectStatusRunCmd,
+	}
+
+	projectCmd.AddCommand(statusCmd)
+
+	patchesHelpText := "Manage downstream patches to the project's " +
+		"repositories.  Patches are listed per repository in project.yml " +
+		"and are applied to the working tree by \"newt install\", " +
+		"\"newt upgrade\", and \"newt sync\".  Each entry is either the " +
+		"path of a patch file, relative to the project directory, or " +
+		"\"ref:[<url>#]<commit-or-range>\" to apply the changes " +
+		"introduced by git commits, optionally fetched from another " +
+		"repository."
+	patchesHelpEx := "  repository.apache-mynewt-core:\n" +
+		"      type: github\n" +
+		"      vers: 1-latest\n" +
+		"      user: apache\n" +
+		"      repo: mynewt-core\n" +
+		"      patches:\n" +
+		"          - patches/core/0001-fix-uart.patch\n" +
+		"          - ref:https://github.com/me/mynewt-core.git#my-fix"
+
+	patchesCmd := &cobra.Command{
+		Use:     "patches",
+		Short:   "Manage downstream patches to repositories",
+		Long:    patchesHelpText,
+		Example: patchesHelpEx,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+		},
+	}
+
+	projectCmd.AddCommand(patchesCmd)
+
+	patchesStatusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Display the status of each repository patch",
+		Long: "Display whether each patch listed in project.yml is " +
+			"applied, not yet applied, conflicting, or has changed since " +
+			"it was applied.  Applied patches that are no longer listed " +
+			"are also reported.",
+		Run: projectPatchesStatusRunCmd,
+	}
+
+	patchesCmd.AddCommand(patchesStatusCmd)
 }
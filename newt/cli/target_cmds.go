@@ -35,12 +35,20 @@ import (
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/resolve"
 	"mynewt.apache.org/newt/newt/syscfg"
+	"mynewt.apache.org/newt/newt/sysinit"
 	"mynewt.apache.org/newt/newt/target"
 	"mynewt.apache.org/newt/util"
 	"mynewt.apache.org/newt/viper"
 )
 
 var targetForce bool = false
+var targetCfgDiffRev string
+var targetDepFormat string = builder.DEPGRAPH_FORMAT_TEXT
+var targetDepCollapse string
+var targetFlashMapSvg string
+
+// Maximum number of dependency paths displayed by "target why-pkg".
+const targetWhyPkgMaxPaths = 100
 
 func resolveExistingTargetArg(arg string) (*target.Target, error) {
 	t := ResolveTarget(arg)
@@ -487,6 +495,262 @@ func targetConfigShowCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+// Resolves the syscfg of the named target or unittest.  Errors are returned
+// rather than reported so that this function can be called from within
+// WithProjectAtRev(), which must clean up before newt exits.
+func targetBuilderCfg(name string) (string, syscfg.Cfg, error) {
+	b, err := TargetBuilderForTargetOrUnittest(name)
+	if err != nil {
+		return "", syscfg.Cfg{}, err
+	}
+
+	res, err := b.Resolve()
+	if err != nil {
+		return "", syscfg.Cfg{}, err
+	}
+
+	warningText := strings.TrimSpace(res.WarningText())
+	if warningText != "" {
+		for _, line := range strings.Split(warningText, "\n") {
+			log.Warn(line)
+		}
+	}
+
+	return b.GetTarget().FullName(), res.Cfg, nil
+}
+
+func cfgDiffEntryText(entry *syscfg.CfgEntry) string {
+	if entry == nil {
+		return "<undefined>"
+	}
+
+	return fmt.Sprintf("'%s' (set by %s)", entry.Value, entry.Setter().Name())
+}
+
+func printCfgDiff(nameA string, nameB string, diffs []syscfg.CfgDiffEntry) {
+	if len(diffs) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"No syscfg differences between %s and %s\n", nameA, nameB)
+		return
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Syscfg differences (A=%s, B=%s):\n", nameA, nameB)
+
+	sections := []struct {
+		title string
+		match func(de syscfg.CfgDiffEntry) bool
+	}{
+		{
+			title: "Settings with different values",
+			match: func(de syscfg.CfgDiffEntry) bool { return de.IsChange() },
+		},
+		{
+			title: "Settings only in " + nameA,
+			match: func(de syscfg.CfgDiffEntry) bool { return de.EntryB == nil },
+		},
+		{
+			title: "Settings only in " + nameB,
+			match: func(de syscfg.CfgDiffEntry) bool { return de.EntryA == nil },
+		},
+	}
+
+	for _, section := range sections {
+		first := true
+		for _, de := range diffs {
+			if !section.match(de) {
+				continue
+			}
+
+			if first {
+				util.StatusMessage(util.VERBOSITY_DEFAULT, "\n* %s:\n",
+					section.title)
+				first = false
+			}
+
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"  * Setting: %s\n", de.Name)
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"    * A: %s\n", cfgDiffEntryText(de.EntryA))
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"    * B: %s\n", cfgDiffEntryText(de.EntryB))
+		}
+	}
+}
+
+func targetConfigDiffCmd(cmd *cobra.Command, args []string) {
+	if targetCfgDiffRev != "" {
+		if len(args) != 1 {
+			NewtUsage(cmd, util.NewNewtError(
+				"Must specify exactly one target when --rev is used"))
+		}
+	} else if len(args) != 2 {
+		NewtUsage(cmd, util.NewNewtError("Must specify two targets"))
+	}
+
+	TryGetProject()
+
+	nameA, cfgA, err := targetBuilderCfg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	var nameB string
+	var cfgB syscfg.Cfg
+	if targetCfgDiffRev == "" {
+		nameB, cfgB, err = targetBuilderCfg(args[1])
+	} else {
+		err = WithProjectAtRev(targetCfgDiffRev, func() error {
+			var err error
+			nameB, cfgB, err = targetBuilderCfg(args[0])
+			return err
+		})
+		nameB += "@" + targetCfgDiffRev
+	}
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	printCfgDiff(nameA, nameB, syscfg.Diff(cfgA, cfgB))
+}
+
+func cfgPointText(point syscfg.CfgPoint) string {
+	s := fmt.Sprintf("%s (%s): '%s'", point.Name(), point.PriorityName(),
+		point.Value)
+	if point.Feature != "" {
+		s += fmt.Sprintf(" [enabled by %s]", point.Feature)
+	}
+
+	return s
+}
+
+func printCfgPointDependers(point syscfg.CfgPoint, res *resolve.Resolution,
+	revdg builder.DepGraph) {
+
+	if point.Source == nil {
+		return
+	}
+
+	rpkg := res.LpkgRpkgMap[point.Source]
+	if rpkg == nil {
+		return
+	}
+
+	deps := resolve.SortResolveDeps(revdg[rpkg])
+	if len(deps) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    * %s: seed package\n", point.Name())
+		return
+	}
+
+	depStrs := make([]string, len(deps))
+	for i, dep := range deps {
+		depStrs[i] = builder.DepString(dep)
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "    * %s <-- [%s]\n",
+		point.Name(), strings.Join(depStrs, " "))
+}
+
+func targetConfigWhyCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		NewtUsage(cmd,
+			util.NewNewtError("Must specify target and setting name"))
+	}
+
+	TryGetProject()
+
+	b, err := TargetBuilderForTargetOrUnittest(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	res := targetBuilderConfigResolve(b)
+	revdg, err := b.CreateRevdepGraph()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	name := args[1]
+	entry, ok := res.Cfg.Settings[name]
+	if !ok {
+		orphans := res.Cfg.Orphans[name]
+		if len(orphans) == 0 {
+			NewtUsage(nil, util.FmtNewtError(
+				"Setting \"%s\" not defined by target \"%s\"", name,
+				b.GetTarget().FullName()))
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Setting %s is not defined by any package; "+
+				"ignored overrides:\n", name)
+		for _, point := range orphans {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "    * %s\n",
+				cfgPointText(point))
+		}
+		return
+	}
+
+	def := entry.History[0]
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "* Setting: %s\n", name)
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"  * Description: %s\n", entry.Description)
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"  * Defined by: %s\n", cfgPointText(def))
+	if def.Filename() != "" {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    * File: %s\n", def.Filename())
+	}
+
+	if len(entry.History) > 1 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"  * Overrides (lowest to highest priority):\n")
+		for _, point := range entry.History[1:] {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "    * %s\n",
+				cfgPointText(point))
+		}
+	}
+
+	rejected := []syscfg.CfgPriority{}
+	for _, priority := range res.Cfg.PriorityViolations {
+		if priority.SettingName == name {
+			rejected = append(rejected, priority)
+		}
+	}
+	if len(rejected) > 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"  * Rejected overrides (insufficient priority):\n")
+		for _, priority := range rejected {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "    * %s (%s)\n",
+				priority.PackageSrc.Name(),
+				pkg.PackageTypeNames[priority.PackageSrc.Type()])
+		}
+	}
+
+	if points := res.Cfg.Ambiguities[name]; len(points) > 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"  * Ambiguous overrides (equal priority, different values):\n")
+		for _, point := range points {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "    * %s\n",
+				cfgPointText(point))
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"  * Effective value: '%s' (set by %s)\n", entry.Value,
+		entry.Setter().Name())
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"  * Dependencies that brought in contributing packages:\n")
+	seen := map[*pkg.LocalPackage]bool{}
+	for _, point := range entry.History {
+		if point.Source != nil && !seen[point.Source] {
+			seen[point.Source] = true
+			printCfgPointDependers(point, res, revdg)
+		}
+	}
+}
+
 func targetConfigInitCmd(cmd *cobra.Command, args []string) {
 	if len(args) < 1 {
 		NewtUsage(cmd,
@@ -559,6 +823,13 @@ func targetDepCmd(cmd *cobra.Command, args []string) {
 			util.NewNewtError("Must specify target or unittest name"))
 	}
 
+	if targetDepCollapse != "" &&
+		targetDepFormat == builder.DEPGRAPH_FORMAT_TEXT {
+
+		NewtUsage(cmd, util.NewNewtError(
+			"--collapse requires --format dot, graphml, or json"))
+	}
+
 	TryGetProject()
 
 	b, err := TargetBuilderForTargetOrUnittest(args[0])
@@ -592,12 +863,62 @@ func targetDepCmd(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if targetDepFormat != builder.DEPGRAPH_FORMAT_TEXT {
+		var collapse []string
+		if targetDepCollapse != "" {
+			collapse = strings.Split(targetDepCollapse, ",")
+		}
+
+		text, err := builder.DepGraphExport(dg, targetDepFormat, collapse)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+		fmt.Print(text)
+		return
+	}
+
 	if len(dg) > 0 {
 		util.StatusMessage(util.VERBOSITY_DEFAULT,
 			builder.DepGraphText(dg)+"\n")
 	}
 }
 
+func targetFlashMapCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	TryGetProject()
+
+	b, err := TargetBuilderForTargetOrUnittest(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	report, err := b.FlashMapReport()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Flash map for %s (bsp=%s):\n\n",
+		b.GetTarget().FullName(), b.GetTarget().BspName)
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", report.Text())
+
+	if targetFlashMapSvg != "" {
+		f, err := os.Create(targetFlashMapSvg)
+		if err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+		report.WriteSvg(f)
+		if err := f.Close(); err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Wrote %s\n",
+			targetFlashMapSvg)
+	}
+}
+
 func targetRevdepCmd(cmd *cobra.Command, args []string) {
 	if len(args) < 1 {
 		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
@@ -642,6 +963,221 @@ func targetRevdepCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+func targetWhyPkgCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		NewtUsage(cmd,
+			util.NewNewtError("Must specify target and package name"))
+	}
+
+	TryGetProject()
+
+	b, err := TargetBuilderForTargetOrUnittest(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	res, err := b.Resolve()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	rpkgs, err := ResolveRpkgs(res, args[1:])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	dst := rpkgs[0]
+
+	dg, err := b.CreateDepGraph()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	// No path is found if the package is only reachable through a cycle.  A
+	// seed package without dependers has a single, empty path.
+	paths := builder.DepPaths(dg, dst, targetWhyPkgMaxPaths)
+	if len(paths) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"No dependency path to %s found in target %s\n",
+			dst.Lpkg.FullName(), b.GetTarget().FullName())
+		return
+	}
+	if len(paths[0].Deps) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Package %s is a seed package of target %s\n",
+			dst.Lpkg.FullName(), b.GetTarget().FullName())
+		return
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Dependency paths to %s (depender --> dependee):\n",
+		dst.Lpkg.FullName())
+
+	features := []string{}
+	for _, path := range paths {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    * %s\n",
+			path.String())
+
+		for _, dep := range path.Deps {
+			if dep.Feature != "" {
+				features = append(features, dep.Feature)
+			}
+		}
+	}
+	if len(paths) == targetWhyPkgMaxPaths {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    (only the %d shortest paths are shown)\n", len(paths))
+	}
+
+	features = util.UniqueStrings(features)
+	sort.Strings(features)
+	if len(features) > 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Syscfg settings that enabled conditional dependencies:\n")
+		for _, feature := range features {
+			entry, ok := res.Cfg.Settings[feature]
+			if !ok {
+				util.StatusMessage(util.VERBOSITY_DEFAULT,
+					"    * %s (injected by package)\n", feature)
+			} else {
+				util.StatusMessage(util.VERBOSITY_DEFAULT,
+					"    * %s='%s' (set by %s)\n", feature, entry.Value,
+					entry.Setter().Name())
+			}
+		}
+	}
+}
+
+func targetLintCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	TryGetProject()
+
+	b, err := TargetBuilderForTargetOrUnittest(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	res, err := b.Resolve()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	names, err := b.UnreferencedSettings()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Settings not referenced by any package in the build:\n")
+	if len(names) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    (none)\n")
+	}
+	for _, name := range names {
+		entry := res.Cfg.Settings[name]
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    * %s (defined by %s)\n", name, entry.PackageDef.FullName())
+	}
+
+	overrides, err := b.RedundantOverrides()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Target overrides equal to the default value:\n")
+	if len(overrides) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    (none)\n")
+	}
+	for _, o := range overrides {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    * %s: %s\n",
+			o.Name, cfgPointText(o.Point))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Packages contributing no symbols to the linked image:\n")
+
+	// The symbol check requires a built image; the checks above do not.
+	rpkgs, err := b.EmptyPackages()
+	if err != nil {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    (skipped: %s)\n",
+			err.Error())
+		return
+	}
+	if len(rpkgs) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    (none)\n")
+	}
+	for _, rpkg := range rpkgs {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    * %s\n",
+			rpkg.Lpkg.FullName())
+	}
+}
+
+func printSysinitOrder(title string, rpkgs []*resolve.ResolvePackage,
+	resolveFn func([]*pkg.LocalPackage) ([]sysinit.Stage, error)) {
+
+	stages, err := resolveFn(resolve.RpkgSliceToLpkgSlice(rpkgs))
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	if len(stages) == 0 {
+		return
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "%s:\n", title)
+	for _, stage := range stages {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    Stage %d\n",
+			stage.Stage)
+		for i, f := range stage.Funcs {
+			s := fmt.Sprintf("        %d.%d: %s", stage.Stage, i, f.String())
+			if len(f.After) > 0 {
+				names := make([]string, len(f.After))
+				for j, pred := range f.After {
+					names[j] = pred.Name
+				}
+				sort.Strings(names)
+				s += fmt.Sprintf(" [after: %s]", strings.Join(names, ", "))
+			}
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", s)
+		}
+	}
+}
+
+func targetSysinitShowCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	TryGetProject()
+
+	b, err := TargetBuilderForTargetOrUnittest(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	res, err := b.Resolve()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if res.LoaderSet != nil {
+		printSysinitOrder("Loader sysinit order", res.LoaderSet.Rpkgs,
+			sysinit.ResolveOrder)
+		printSysinitOrder("Loader sysdown order", res.LoaderSet.Rpkgs,
+			sysinit.ResolveDownOrder)
+		printSysinitOrder("App sysinit order", res.AppSet.Rpkgs,
+			sysinit.ResolveOrder)
+		printSysinitOrder("App sysdown order", res.AppSet.Rpkgs,
+			sysinit.ResolveDownOrder)
+	} else {
+		printSysinitOrder("Sysinit order", res.AppSet.Rpkgs,
+			sysinit.ResolveOrder)
+		printSysinitOrder("Sysdown order", res.AppSet.Rpkgs,
+			sysinit.ResolveDownOrder)
+	}
+}
+
 func AddTargetCommands(cmd *cobra.Command) {
 	targetHelpText := ""
 	targetHelpEx := ""
@@ -763,6 +1299,51 @@ func AddTargetCommands(cmd *cobra.Command) {
 		return append(targetList(), unittestList()...)
 	})
 
+	configDiffHelpText := "Compare the system configuration of two " +
+		"targets.  Settings with different values and settings that are " +
+		"only defined for one target are listed along with the package " +
+		"that set them.  If --rev is specified, a single target is " +
+		"compared against the same target at the specified git revision " +
+		"of the local repository."
+	configDiffHelpEx := "  newt target config diff my_target1 my_target2\n"
+	configDiffHelpEx += "  newt target config diff my_target1 --rev HEAD~1"
+
+	configDiffCmd := &cobra.Command{
+		Use:     "diff <target-a> [target-b]",
+		Short:   "Compare the system configuration of two targets",
+		Long:    configDiffHelpText,
+		Example: configDiffHelpEx,
+		Run:     targetConfigDiffCmd,
+	}
+	configDiffCmd.PersistentFlags().StringVarP(&targetCfgDiffRev,
+		"rev", "r", "",
+		"Compare against the target at this git revision of the local repo")
+
+	configCmd.AddCommand(configDiffCmd)
+	AddTabCompleteFn(configDiffCmd, func() []string {
+		return append(targetList(), unittestList()...)
+	})
+
+	configWhyHelpText := "Explain why a setting has its value.  The " +
+		"setting's definition, each override in priority order, the " +
+		"features that enabled conditional overrides, and the " +
+		"dependencies that brought each contributing package into the " +
+		"build are displayed."
+	configWhyHelpEx := "  newt target config why my_target1 LOG_LEVEL"
+
+	configWhyCmd := &cobra.Command{
+		Use:     "why <target> <setting>",
+		Short:   "Explain why a setting has its value",
+		Long:    configWhyHelpText,
+		Example: configWhyHelpEx,
+		Run:     targetConfigWhyCmd,
+	}
+
+	configCmd.AddCommand(configWhyCmd)
+	AddTabCompleteFn(configWhyCmd, func() []string {
+		return append(targetList(), unittestList()...)
+	})
+
 	configInitCmd := &cobra.Command{
 		Use:   "init",
 		Short: "Populate a target's system configuration file",
@@ -779,20 +1360,56 @@ func AddTargetCommands(cmd *cobra.Command) {
 		return append(targetList(), unittestList()...)
 	})
 
-	depHelpText := "View a target's dependency graph."
+	depHelpText := "View a target's dependency graph.  With --format, " +
+		"the graph is exported as Graphviz (dot), GraphML, or JSON.  " +
+		"Edges are labeled with the API or syscfg setting that generated " +
+		"them; nodes are colored by package type and repo.  With " +
+		"--collapse (dot, graphml, or json only), packages are merged by repo (\"repo\") or by the " +
+		"specified comma-separated package name prefixes.  A prefix " +
+		"without a repo (\"hw/mcu\") matches packages in every repo; " +
+		"\"@repo/hw/mcu\" matches only the named repo."
+	depHelpEx := "  newt target dep my_target1 --format dot | dot -Tsvg > deps.svg\n"
+	depHelpEx += "  newt target dep my_target1 --format json --collapse repo\n"
+	depHelpEx += "  newt target dep my_target1 --format dot --collapse hw/mcu,net/nimble"
 
 	depCmd := &cobra.Command{
-		Use:   "dep <target> [pkg-1] [pkg-2] [...]",
-		Short: "View target's dependency graph",
-		Long:  depHelpText,
-		Run:   targetDepCmd,
-	}
+		Use:     "dep <target> [pkg-1] [pkg-2] [...]",
+		Short:   "View target's dependency graph",
+		Long:    depHelpText,
+		Example: depHelpEx,
+		Run:     targetDepCmd,
+	}
+	depCmd.PersistentFlags().StringVarP(&targetDepFormat, "format", "",
+		builder.DEPGRAPH_FORMAT_TEXT,
+		"Output format (text, dot, graphml, json)")
+	depCmd.PersistentFlags().StringVarP(&targetDepCollapse, "collapse", "",
+		"", "Collapse packages by repo (\"repo\") or by comma-separated "+
+			"package name prefixes; requires --format dot, graphml, or json")
 
 	targetCmd.AddCommand(depCmd)
 	AddTabCompleteFn(depCmd, func() []string {
 		return append(targetList(), unittestList()...)
 	})
 
+	whyPkgHelpText := "Explain why a package is included in a target.  " +
+		"Every dependency path leading to <pkg> is displayed, including " +
+		"dependencies generated by API requirements and dependencies " +
+		"enabled by syscfg settings."
+	whyPkgHelpEx := "  newt target why-pkg my_target1 sys/log/full"
+
+	whyPkgCmd := &cobra.Command{
+		Use:     "why-pkg <target> <pkg>",
+		Short:   "Explain why a package is included in a target",
+		Long:    whyPkgHelpText,
+		Example: whyPkgHelpEx,
+		Run:     targetWhyPkgCmd,
+	}
+
+	targetCmd.AddCommand(whyPkgCmd)
+	AddTabCompleteFn(whyPkgCmd, func() []string {
+		return append(targetList(), unittestList()...)
+	})
+
 	revdepHelpText := "View a target's reverse-dependency graph."
 
 	revdepCmd := &cobra.Command{
@@ -806,4 +1423,88 @@ func AddTargetCommands(cmd *cobra.Command) {
 	AddTabCompleteFn(revdepCmd, func() []string {
 		return append(targetList(), unittestList()...)
 	})
+
+	flashMapHelpText := "Display a target's flash map.  Each flash " +
+		"device is shown as a table of areas, followed by a drawing of its " +
+		"layout.  Gaps between areas, areas that are not aligned to the " +
+		"device's sectors (bsp.yml: bsp.flash_map.devices.<id>.sector_size " +
+		"or .sectors), and the flash_owner settings that claim each area " +
+		"are reported.  If the target has " +
+		"been built, the space used by the latest image in each slot is " +
+		"shown as well."
+	flashMapHelpEx := "  newt target flashmap my_target1\n"
+	flashMapHelpEx += "  newt target flashmap my_target1 --svg flash.svg"
+
+	flashMapCmd := &cobra.Command{
+		Use:     "flashmap <target>",
+		Short:   "Display a target's flash map",
+		Long:    flashMapHelpText,
+		Example: flashMapHelpEx,
+		Run:     targetFlashMapCmd,
+	}
+	flashMapCmd.PersistentFlags().StringVarP(&targetFlashMapSvg, "svg", "",
+		"", "Also write the layout as an SVG drawing to the specified file")
+
+	targetCmd.AddCommand(flashMapCmd)
+	AddTabCompleteFn(flashMapCmd, func() []string {
+		return append(targetList(), unittestList()...)
+	})
+
+	lintHelpText := "Report configuration and packages that have no effect " +
+		"on a target.  Three checks are performed:\n" +
+		"    * Syscfg settings that are never referenced by the source " +
+		"files or configuration of any package in the build.\n" +
+		"    * Target syscfg overrides that set a setting to its default " +
+		"value.\n" +
+		"    * Packages whose archives contribute no symbols to the " +
+		"linked ELF file.  This check requires the target to be built."
+	lintHelpEx := "  newt target lint my_target1"
+
+	lintCmd := &cobra.Command{
+		Use:     "lint <target>",
+		Short:   "Report unused packages and dead syscfg settings",
+		Long:    lintHelpText,
+		Example: lintHelpEx,
+		Run:     targetLintCmd,
+	}
+
+	targetCmd.AddCommand(lintCmd)
+	AddTabCompleteFn(lintCmd, func() []string {
+		return append(targetList(), unittestList()...)
+	})
+
+	sysinitHelpText := "View a target's system initialization and " +
+		"shutdown sequences"
+
+	sysinitCmd := &cobra.Command{
+		Use:   "sysinit",
+		Short: sysinitHelpText,
+		Long:  sysinitHelpText,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+		},
+	}
+
+	targetCmd.AddCommand(sysinitCmd)
+
+	sysinitShowHelpText := "Display the order in which a target's init " +
+		"and down functions are called.  Functions are grouped by stage; " +
+		"within a stage, they are ordered by the \"after\" and \"before\" " +
+		"relations in each package's pkg.init and pkg.down maps, then by " +
+		"package and function name.  Down stages are called in descending " +
+		"order."
+	sysinitShowHelpEx := "  newt target sysinit show my_target1"
+
+	sysinitShowCmd := &cobra.Command{
+		Use:     "show <target>",
+		Short:   "View a target's init function order",
+		Long:    sysinitShowHelpText,
+		Example: sysinitShowHelpEx,
+		Run:     targetSysinitShowCmd,
+	}
+
+	sysinitCmd.AddCommand(sysinitShowCmd)
+	AddTabCompleteFn(sysinitShowCmd, func() []string {
+		return append(targetList(), unittestList()...)
+	})
 }
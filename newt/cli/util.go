@@ -23,6 +23,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -35,6 +36,7 @@ import (
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/repo"
 	"mynewt.apache.org/newt/newt/resolve"
 	"mynewt.apache.org/newt/newt/target"
 	"mynewt.apache.org/newt/util"
@@ -201,6 +203,78 @@ func ResetGlobalState() error {
 	return nil
 }
 
+func gitCmd(dir string, args ...string) (string, error) {
+	cmd := append([]string{"git", "-C", dir}, args...)
+	o, err := util.ShellCommand(cmd, nil)
+	return strings.TrimSpace(string(o)), err
+}
+
+// Executes the specified function with the project loaded as it existed at
+// the specified git revision of the local repository.  The revision is
+// checked out into a temporary git worktree.  Installed repos and the project
+// state file are shared with the current project.  The global project and
+// target state is restored before this function returns.
+func WithProjectAtRev(rev string, fn func() error) error {
+	projDir := TryGetProject().Path()
+
+	topDir, err := gitCmd(projDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return util.FmtNewtError(
+			"Project directory is not in a git repository: %s", projDir)
+	}
+	prefix, err := gitCmd(projDir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := ioutil.TempDir("", "newt-rev")
+	if err != nil {
+		return util.NewNewtError(err.Error())
+	}
+	defer os.RemoveAll(tmpDir)
+
+	wtDir := tmpDir + "/worktree"
+	if _, err := gitCmd(topDir, "worktree", "add", "--detach", wtDir,
+		rev); err != nil {
+
+		return util.FmtNewtError("Failed to check out revision \"%s\": %s",
+			rev, err.Error())
+	}
+	defer gitCmd(topDir, "worktree", "remove", "--force", wtDir)
+
+	revProjDir := filepath.ToSlash(filepath.Clean(wtDir + "/" + prefix))
+	for _, name := range []string{repo.REPOS_DIR,
+		project.PROJECT_STATE_FILE} {
+
+		src := projDir + "/" + name
+		dst := revProjDir + "/" + name
+		if util.NodeExist(src) && util.NodeNotExist(dst) {
+			if err := os.Symlink(src, dst); err != nil {
+				return util.NewNewtError(err.Error())
+			}
+			defer os.Remove(dst)
+		}
+	}
+
+	if err := ResetGlobalState(); err != nil {
+		return err
+	}
+	defer func() {
+		os.Chdir(projDir)
+		target.ResetTargets()
+		project.ResetProject()
+	}()
+
+	if err := os.Chdir(revProjDir); err != nil {
+		return util.NewNewtError(err.Error())
+	}
+	if _, err := project.TryGetProject(); err != nil {
+		return err
+	}
+
+	return fn()
+}
+
 func TryGetProject() *project.Project {
 	var p *project.Project
 	var err error
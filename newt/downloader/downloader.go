@@ -31,6 +31,7 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 
+	"mynewt.apache.org/newt/newt/interfaces"
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/util"
 )
@@ -41,11 +42,22 @@ type Downloader interface {
 	SetBranch(branch string)
 	DownloadRepo(branch string) (string, error)
 	CurrentBranch(path string) (string, error)
+	CurrentCommit(path string) (string, error)
 	UpdateRepo(path string, branchName string) error
 	CleanupRepo(path string, branchName string) error
 	LocalDiff(path string) ([]byte, error)
+	RemoteUrl() string
 }
 
+// Directory of bare git repositories, one per repository, named
+// "<repo-name>.git".  If set, every repository is downloaded from this
+// directory rather than from its configured remote.  This overrides any mirror
+// configured in newtrc.
+var MirrorDir string
+
+// Disables mirror redirection, e.g., while populating a mirror.
+var MirrorDisabled bool
+
 type GenericDownloader struct {
 	branch string
 }
@@ -64,6 +76,18 @@ type GithubDownloader struct {
 	Password string
 }
 
+// Downloads repositories from an arbitrary git remote (e.g., GitLab, Gitea, or
+// a plain SSH or HTTPS server).  All remote access goes through the git
+// binary, so ssh-agent, credential helpers, and URL rewrites configured in git
+// are honored.
+type GitDownloader struct {
+	GenericDownloader
+
+	// Clone URL; anything accepted by "git clone", including a path to a
+	// local bare repository.
+	Url string
+}
+
 type LocalDownloader struct {
 	GenericDownloader
 
@@ -183,6 +207,12 @@ func stashPop(repoDir string) error {
 	return err
 }
 
+func currentCommit(repoDir string) (string, error) {
+	cmd := []string{"rev-parse", "HEAD"}
+	commit, err := executeGitCommand(repoDir, cmd)
+	return strings.Trim(string(commit), "\r\n"), err
+}
+
 func clean(repoDir string) error {
 	_, err := executeGitCommand(repoDir, []string{"clean", "-f"})
 	return err
@@ -262,7 +292,25 @@ func (gd *GithubDownloader) CurrentBranch(path string) (string, error) {
 	return strings.Trim(string(branch), "\r\n"), err
 }
 
+func (gd *GithubDownloader) CurrentCommit(path string) (string, error) {
+	return currentCommit(path)
+}
+
 func (gd *GithubDownloader) UpdateRepo(path string, branchName string) error {
+	return updateRepo(path, branchName)
+}
+
+func (gd *GithubDownloader) CleanupRepo(path string, branchName string) error {
+	return cleanupRepo(path, branchName)
+}
+
+func (gd *GithubDownloader) LocalDiff(path string) ([]byte, error) {
+	return executeGitCommand(path, []string{"diff"})
+}
+
+// updateRepo fetches upstream changes and checks out the specified branch,
+// preserving local changes.
+func updateRepo(path string, branchName string) error {
 	err := fetch(path)
 	if err != nil {
 		return err
@@ -287,7 +335,9 @@ func (gd *GithubDownloader) UpdateRepo(path string, branchName string) error {
 	return nil
 }
 
-func (gd *GithubDownloader) CleanupRepo(path string, branchName string) error {
+// cleanupRepo stashes local changes, removes untracked files, and checks out
+// the specified branch.
+func cleanupRepo(path string, branchName string) error {
 	_, err := stash(path)
 	if err != nil {
 		return err
@@ -300,11 +350,16 @@ func (gd *GithubDownloader) CleanupRepo(path string, branchName string) error {
 
 	// TODO: needs handling of non-tracked files
 
-	return gd.UpdateRepo(path, branchName)
+	return updateRepo(path, branchName)
 }
 
-func (gd *GithubDownloader) LocalDiff(path string) ([]byte, error) {
-	return executeGitCommand(path, []string{"diff"})
+func (gd *GithubDownloader) RemoteUrl() string {
+	server := "github.com"
+
+	if gd.Server != "" {
+		server = gd.Server
+	}
+	return fmt.Sprintf("https://%s/%s/%s.git", server, gd.User, gd.Repo)
 }
 
 func (gd *GithubDownloader) DownloadRepo(commit string) (string, error) {
@@ -316,12 +371,7 @@ func (gd *GithubDownloader) DownloadRepo(commit string) (string, error) {
 
 	// Currently only the master branch is supported.
 	branch := "master"
-	server := "github.com"
-
-	if gd.Server != "" {
-		server = gd.Server
-	}
-	url := fmt.Sprintf("https://%s/%s/%s.git", server, gd.User, gd.Repo)
+	url := gd.RemoteUrl()
 	util.StatusMessage(util.VERBOSITY_VERBOSE, "Downloading "+
 		"repository %s (branch: %s; commit: %s) at %s\n", gd.Repo, branch,
 		commit, url)
@@ -367,6 +417,100 @@ func NewGithubDownloader() *GithubDownloader {
 	return &GithubDownloader{}
 }
 
+// Fetches a single file from the tip of the downloader's branch.  Only the
+// branch's most recent commit is fetched, into a throwaway repository.
+func (gd *GitDownloader) FetchFile(name string, dest string) error {
+	tmpdir, err := ioutil.TempDir("", "newt-fetch")
+	if err != nil {
+		return util.NewNewtError(err.Error())
+	}
+	defer os.RemoveAll(tmpdir)
+
+	log.Debugf("Fetching file %s (url: %s; branch: %s) to %s", name, gd.Url,
+		gd.Branch(), dest)
+
+	cmds := [][]string{
+		{"init", "--quiet"},
+		{"fetch", "--quiet", "--depth", "1", gd.Url, gd.Branch()},
+	}
+	for _, cmd := range cmds {
+		if _, err := executeGitCommand(tmpdir, cmd); err != nil {
+			return util.FmtNewtError("Failed to fetch %s from %s: %s",
+				name, gd.Url, err.Error())
+		}
+	}
+
+	contents, err := executeGitCommand(tmpdir,
+		[]string{"show", "FETCH_HEAD:" + name})
+	if err != nil {
+		return util.FmtNewtError("Failed to fetch %s from %s: %s",
+			name, gd.Url, err.Error())
+	}
+
+	if err := ioutil.WriteFile(dest, contents, 0644); err != nil {
+		return util.NewNewtError(err.Error())
+	}
+
+	return nil
+}
+
+func (gd *GitDownloader) CurrentBranch(path string) (string, error) {
+	cmd := []string{"rev-parse", "--abbrev-ref", "HEAD"}
+	branch, err := executeGitCommand(path, cmd)
+	return strings.Trim(string(branch), "\r\n"), err
+}
+
+func (gd *GitDownloader) CurrentCommit(path string) (string, error) {
+	return currentCommit(path)
+}
+
+func (gd *GitDownloader) UpdateRepo(path string, branchName string) error {
+	return updateRepo(path, branchName)
+}
+
+func (gd *GitDownloader) CleanupRepo(path string, branchName string) error {
+	return cleanupRepo(path, branchName)
+}
+
+func (gd *GitDownloader) LocalDiff(path string) ([]byte, error) {
+	return executeGitCommand(path, []string{"diff"})
+}
+
+func (gd *GitDownloader) RemoteUrl() string {
+	return gd.Url
+}
+
+func (gd *GitDownloader) DownloadRepo(commit string) (string, error) {
+	// Get a temporary directory, and clone the repository into that
+	// directory.
+	tmpdir, err := ioutil.TempDir("", "newt-repo")
+	if err != nil {
+		return "", util.NewNewtError(err.Error())
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Downloading "+
+		"repository %s (commit: %s)\n", gd.Url, commit)
+
+	if _, err := executeGitCommand(tmpdir,
+		[]string{"clone", "--quiet", gd.Url, "."}); err != nil {
+
+		os.RemoveAll(tmpdir)
+		return "", err
+	}
+
+	// Checkout the specified commit.
+	if err := checkout(tmpdir, commit); err != nil {
+		os.RemoveAll(tmpdir)
+		return "", err
+	}
+
+	return tmpdir, nil
+}
+
+func NewGitDownloader() *GitDownloader {
+	return &GitDownloader{}
+}
+
 func (ld *LocalDownloader) FetchFile(name string, dest string) error {
 	srcPath := ld.Path + "/" + name
 
@@ -384,6 +528,10 @@ func (ld *LocalDownloader) CurrentBranch(path string) (string, error) {
 	return strings.Trim(string(branch), "\r\n"), err
 }
 
+func (ld *LocalDownloader) CurrentCommit(path string) (string, error) {
+	return currentCommit(path)
+}
+
 // NOTE: intentionally always error...
 func (ld *LocalDownloader) UpdateRepo(path string, branchName string) error {
 	return util.NewNewtError(fmt.Sprintf("Can't pull from a local repo\n"))
@@ -399,6 +547,10 @@ func (ld *LocalDownloader) LocalDiff(path string) ([]byte, error) {
 	return executeGitCommand(path, []string{"diff"})
 }
 
+func (ld *LocalDownloader) RemoteUrl() string {
+	return ld.Path
+}
+
 func (ld *LocalDownloader) DownloadRepo(commit string) (string, error) {
 	// Get a temporary directory, and copy the repository into that directory.
 	tmpdir, err := ioutil.TempDir("", "newt-repo")
@@ -425,9 +577,115 @@ func NewLocalDownloader() *LocalDownloader {
 	return &LocalDownloader{}
 }
 
+// Determines the mirror URL for the specified repository, or "" if the
+// repository is not mirrored.  The --mirror command line option takes
+// precedence over newtrc, which supports the following settings:
+//
+//	mirror:
+//	    dir: /path/to/mirror
+//	    repos:
+//	        <repo-name>: <clone-url>
+func MirrorUrl(repoName string) string {
+	if MirrorDisabled {
+		return ""
+	}
+
+	if MirrorDir != "" {
+		return MirrorDir + "/" + repoName + ".git"
+	}
+
+	newtrc := newtutil.Newtrc()
+	if url := newtrc.GetStringMapString("mirror.repos")[repoName]; url != "" {
+		return url
+	}
+	if dir := newtrc.GetString("mirror.dir"); dir != "" {
+		return dir + "/" + repoName + ".git"
+	}
+
+	return ""
+}
+
+// Copies every branch and tag of a downloader's remote into a bare mirror
+// repository.  If the mirror already exists, it is brought up to date.
+func Mirror(dl Downloader, dst string) error {
+	url := dl.RemoteUrl()
+
+	if util.NodeExist(dst) {
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Updating mirror %s from %s\n", dst, url)
+		_, err := executeGitCommand(dst,
+			[]string{"remote", "update", "--prune"})
+		return err
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Creating mirror %s from %s\n", dst, url)
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return util.NewNewtError(err.Error())
+	}
+	_, err := executeGitCommand(filepath.Dir(dst),
+		[]string{"clone", "--quiet", "--mirror", url, dst})
+	return err
+}
+
+// Indicates whether the specified branch or tag exists in a mirror.
+func MirrorHasRef(dst string, ref string) bool {
+	_, err := executeGitCommand(dst,
+		[]string{"rev-parse", "--verify", "--quiet", ref + "^{commit}"})
+	return err == nil
+}
+
+// Counts the commits that a repository's checked out commit is ahead of and
+// behind the specified branch or tag.  The remote-tracking branch is used if
+// it exists; it reflects the most recent fetch.  Nothing gets fetched.
+func AheadBehind(path string, branch string) (int, int, error) {
+	ref, err := ResolveRef(path, branch)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	output, err := executeGitCommand(path,
+		[]string{"rev-list", "--left-right", "--count", "HEAD..." + ref})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var ahead, behind int
+	if _, err := fmt.Sscanf(string(output), "%d %d", &ahead,
+		&behind); err != nil {
+
+		return 0, 0, util.FmtNewtError(
+			"Unexpected output from git rev-list: %s", string(output))
+	}
+
+	return ahead, behind, nil
+}
+
+// Indicates whether a git URL refers to a path on the local filesystem
+// rather than to a remote.  Remote URLs either specify a scheme
+// ("https://...") or use the scp-like syntax ("[user@]host:path").
+func isLocalGitUrl(url string) bool {
+	if strings.Contains(url, "://") {
+		return false
+	}
+
+	// A colon following a slash is part of a path.
+	colon := strings.Index(url, ":")
+	slash := strings.Index(url, "/")
+	return colon < 0 || (slash >= 0 && slash < colon)
+}
+
 func LoadDownloader(repoName string, repoVars map[string]string) (
 	Downloader, error) {
 
+	if url := MirrorUrl(repoName); url != "" {
+		log.Debugf("Using mirror %s for repository %s", url, repoName)
+		gd := NewGitDownloader()
+		gd.Url = url
+		return gd, nil
+	}
+
 	switch repoVars["type"] {
 	case "github":
 		gd := NewGithubDownloader()
@@ -460,6 +718,23 @@ func LoadDownloader(repoName string, repoVars map[string]string) (
 		}
 		return gd, nil
 
+	case "git":
+		gd := NewGitDownloader()
+		gd.Url = repoVars["url"]
+		if gd.Url == "" {
+			return nil, util.FmtNewtError(
+				"Repository %s of type git lacks a url", repoName)
+		}
+
+		// git runs in temporary directories; a relative path would be
+		// resolved against the wrong directory.
+		if isLocalGitUrl(gd.Url) && !filepath.IsAbs(gd.Url) {
+			if proj := interfaces.GetProject(); proj != nil {
+				gd.Url = proj.Path() + "/" + gd.Url
+			}
+		}
+		return gd, nil
+
 	case "local":
 		ld := NewLocalDownloader()
 		ld.Path = repoVars["path"]
@@ -0,0 +1,316 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Work in a repository's working tree that does not exist upstream and would
+// be lost if a different commit were checked out by force.
+type LocalWork struct {
+	// Commits that are not reachable from the upstream ref.
+	Commits []string
+
+	// Tracked files with uncommitted changes.
+	Modified []string
+
+	// Files that git does not track and does not ignore.
+	Untracked []string
+}
+
+func (lw *LocalWork) IsEmpty() bool {
+	return len(lw.Commits) == 0 && len(lw.Modified) == 0 &&
+		len(lw.Untracked) == 0
+}
+
+// Indicates whether the working tree has uncommitted changes or untracked
+// files.
+func (lw *LocalWork) HasChanges() bool {
+	return len(lw.Modified) > 0 || len(lw.Untracked) > 0
+}
+
+func gitLines(path string, cmd []string) ([]string, error) {
+	output, err := executeGitCommand(path, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, nil
+}
+
+func refExists(path string, ref string) bool {
+	_, err := executeGitCommand(path,
+		[]string{"rev-parse", "--verify", "--quiet", ref + "^{commit}"})
+	return err == nil
+}
+
+// Fetches upstream branches and tags.  Repositories without a remote (e.g.,
+// copies of local repositories) are left alone.
+func Fetch(path string) error {
+	remotes, err := gitLines(path, []string{"remote"})
+	if err != nil {
+		return err
+	}
+	if len(remotes) == 0 {
+		return nil
+	}
+
+	return fetch(path)
+}
+
+// Determines the fully-qualified ref that a version's branch or tag name
+// refers to.  The remote-tracking branch takes precedence over tags and local
+// branches.
+func ResolveRef(path string, branch string) (string, error) {
+	for _, ref := range []string{
+		"refs/remotes/origin/" + branch,
+		"refs/tags/" + branch,
+		"refs/heads/" + branch,
+	} {
+		if refExists(path, ref) {
+			return ref, nil
+		}
+	}
+
+	return "", util.FmtNewtError("Branch or tag \"%s\" not found in %s",
+		branch, path)
+}
+
+// Collects the work in a repository that is not contained in the specified
+// upstream ref.
+func FindLocalWork(path string, ref string) (*LocalWork, error) {
+	var err error
+	lw := &LocalWork{}
+
+	lw.Commits, err = gitLines(path, []string{
+		"log", "--format=%h %s", ref + "..HEAD"})
+	if err != nil {
+		return nil, err
+	}
+
+	lw.Modified, err = gitLines(path, []string{
+		"diff", "HEAD", "--name-only"})
+	if err != nil {
+		return nil, err
+	}
+
+	lw.Untracked, err = gitLines(path, []string{
+		"ls-files", "--others", "--exclude-standard"})
+	if err != nil {
+		return nil, err
+	}
+
+	return lw, nil
+}
+
+// Points the named ref at the specified commit so that it remains reachable.
+func SaveRef(path string, ref string, commit string) error {
+	_, err := executeGitCommand(path, []string{"update-ref", ref, commit})
+	return err
+}
+
+// Lists the commits on a local branch that are not reachable from the
+// specified upstream ref.  The list is empty if the branch does not exist.
+func BranchCommits(path string, branch string, ref string) ([]string, error) {
+	local := "refs/heads/" + branch
+	if local == ref || !refExists(path, local) {
+		return nil, nil
+	}
+
+	return gitLines(path, []string{"log", "--format=%h %s", ref + ".." + local})
+}
+
+// Stashes uncommitted changes and untracked files, and points the named ref
+// at the resulting stash commit.  The stash also remains in the stash list.
+func StashAll(path string, ref string) error {
+	if _, err := executeGitCommand(path, []string{
+		"stash", "push", "--include-untracked", "-m", "newt: " + ref,
+	}); err != nil {
+		return err
+	}
+
+	_, err := executeGitCommand(path,
+		[]string{"update-ref", ref, "refs/stash"})
+	return err
+}
+
+// Restores the most recent stash.
+func StashPop(path string) error {
+	return stashPop(path)
+}
+
+// Rebases the commits on the current branch that are not in the specified
+// ref onto it.  On failure, the rebase is aborted and the working tree is
+// left as it was.
+func Rebase(path string, ref string) error {
+	if _, err := executeGitCommand(path,
+		[]string{"rebase", ref}); err != nil {
+
+		executeGitCommand(path, []string{"rebase", "--abort"})
+		return err
+	}
+
+	return nil
+}
+
+// Checks out the specified ref as the named local branch, creating or
+// resetting the branch as necessary.
+func CheckoutBranch(path string, branch string, ref string) error {
+	_, err := executeGitCommand(path,
+		[]string{"checkout", "-B", branch, ref})
+	return err
+}
+
+// The result of checking a patch against a working tree.
+type PatchState int
+
+const (
+	PATCH_STATE_APPLICABLE PatchState = iota
+	PATCH_STATE_APPLIED
+	PATCH_STATE_CONFLICT
+)
+
+// Produces the diff introduced by a commit or commit range (e.g., "a..b").
+// If a URL is specified, the commits are fetched from it first.
+func RefDiff(path string, url string, rev string) ([]byte, error) {
+	from, to := "", rev
+	if idx := strings.Index(rev, ".."); idx >= 0 {
+		from, to = rev[:idx], rev[idx+2:]
+	}
+
+	// Replace each fetched ref with the commit it refers to.
+	if url != "" {
+		for _, ref := range []*string{&from, &to} {
+			if *ref == "" {
+				continue
+			}
+
+			if _, err := executeGitCommand(path,
+				[]string{"fetch", "--quiet", url, *ref}); err != nil {
+				return nil, err
+			}
+
+			commit, err := executeGitCommand(path,
+				[]string{"rev-parse", "FETCH_HEAD"})
+			if err != nil {
+				return nil, err
+			}
+			*ref = strings.TrimSpace(string(commit))
+		}
+	}
+
+	if from == "" {
+		from = to + "^"
+	}
+	return executeGitCommand(path, []string{"diff", "--binary", from, to})
+}
+
+func withPatchFile(patch []byte, fn func(filename string) error) error {
+	f, err := ioutil.TempFile("", "newt-patch")
+	if err != nil {
+		return util.NewNewtError(err.Error())
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(patch)
+	f.Close()
+	if err != nil {
+		return util.NewNewtError(err.Error())
+	}
+
+	return fn(filepath.ToSlash(f.Name()))
+}
+
+// Determines whether a patch can be applied to a working tree, is already
+// applied, or conflicts with it.
+func CheckPatch(path string, patch []byte) PatchState {
+	state := PATCH_STATE_CONFLICT
+
+	withPatchFile(patch, func(filename string) error {
+		if _, err := executeGitCommand(path,
+			[]string{"apply", "--check", filename}); err == nil {
+
+			state = PATCH_STATE_APPLICABLE
+		} else if _, err := executeGitCommand(path,
+			[]string{"apply", "--check", "--reverse", filename}); err == nil {
+
+			state = PATCH_STATE_APPLIED
+		}
+		return nil
+	})
+
+	return state
+}
+
+// Applies a patch to a working tree, or reverts it if reverse is true.
+func ApplyPatch(path string, patch []byte, reverse bool) error {
+	return withPatchFile(patch, func(filename string) error {
+		cmd := []string{"apply"}
+		if reverse {
+			cmd = append(cmd, "--reverse")
+		}
+		_, err := executeGitCommand(path, append(cmd, filename))
+		return err
+	})
+}
+
+// Lists the files that a patch modifies, relative to the working tree root.
+func PatchFiles(path string, patch []byte) ([]string, error) {
+	var lines []string
+
+	err := withPatchFile(patch, func(filename string) error {
+		var err error
+		lines, err = gitLines(path, []string{"apply", "--numstat", filename})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Each line has the form "<added>\t<deleted>\t<path>".
+	files := make([]string, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) == 3 {
+			files = append(files, fields[2])
+		}
+	}
+
+	return files, nil
+}
+
+// Lists the tracked files with uncommitted changes in a working tree.
+func ChangedFiles(path string) ([]string, error) {
+	return gitLines(path, []string{"diff", "HEAD", "--name-only"})
+}
@@ -67,15 +67,38 @@ type FlashArea struct {
 	Size   int
 }
 
+// Properties of a flash device, declared in the BSP's flash map.
+type FlashDevice struct {
+	Id int
+
+	// The address at which offset 0 of the device is mapped.  Used when
+	// writing address-bearing output formats (e.g., Intel HEX).  HasBase
+	// indicates whether the base was declared in the flash map.
+	Base    int
+	HasBase bool
+
+	// Erase-sector layout; see sector.go.  If SectorSize is nonzero, the
+	// device consists of uniformly sized sectors.  Otherwise, Sectors lists
+	// the size of each sector, starting at offset 0.  If both are empty, the
+	// layout is unknown and sector checks are skipped.
+	SectorSize int
+	Sectors    []int
+}
+
 type FlashMap struct {
 	Areas       map[string]FlashArea
+	Devices     map[int]FlashDevice
 	Overlaps    [][]FlashArea
 	IdConflicts [][]FlashArea
+
+	// Misaligned areas and image slots that cannot be swapped.
+	SectorErrors []string
 }
 
 func newFlashMap() FlashMap {
 	return FlashMap{
 		Areas:    map[string]FlashArea{},
+		Devices:  map[int]FlashDevice{},
 		Overlaps: [][]FlashArea{},
 	}
 }
@@ -179,6 +202,70 @@ func parseFlashArea(
 	return area, nil
 }
 
+func parseFlashDevice(
+	idStr string, ymlFields map[string]interface{}) (FlashDevice, error) {
+
+	dev := FlashDevice{}
+
+	var err error
+
+	dev.Id, err = util.AtoiNoOct(idStr)
+	if err != nil {
+		return dev, util.FmtNewtError("invalid flash device id: %s", idStr)
+	}
+
+	for k, yv := range ymlFields {
+		v := cast.ToString(yv)
+
+		switch k {
+		case "base":
+			dev.Base, err = util.AtoiNoOct(v)
+			if err != nil {
+				return dev, util.FmtNewtError(
+					"flash device %d: invalid base address: %s", dev.Id, v)
+			}
+			dev.HasBase = true
+
+		case "sector_size":
+			dev.SectorSize, err = parseSize(v)
+			if err != nil || dev.SectorSize <= 0 {
+				return dev, util.FmtNewtError(
+					"flash device %d: invalid sector size: %s", dev.Id, v)
+			}
+
+		case "sectors":
+			dev.Sectors, err = parseSectors(cast.ToStringSlice(yv))
+			if err != nil {
+				return dev, util.FmtNewtError(
+					"flash device %d: %s", dev.Id, err.Error())
+			}
+
+		default:
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"Warning: flash device %d contains unrecognized field: %s\n",
+				dev.Id, k)
+		}
+	}
+
+	if dev.SectorSize != 0 && len(dev.Sectors) != 0 {
+		return dev, util.FmtNewtError(
+			"flash device %d: \"sector_size\" and \"sectors\" are "+
+				"mutually exclusive", dev.Id)
+	}
+
+	return dev, nil
+}
+
+// Retrieves the properties of the specified flash device.  Devices that are
+// not declared in the flash map have a base address of 0.
+func (flashMap FlashMap) Device(id int) FlashDevice {
+	if dev, ok := flashMap.Devices[id]; ok {
+		return dev
+	}
+
+	return FlashDevice{Id: id}
+}
+
 func (flashMap FlashMap) unSortedAreas() []FlashArea {
 	areas := make([]FlashArea, 0, len(flashMap.Areas))
 	for _, area := range flashMap.Areas {
@@ -280,6 +367,14 @@ func (flashMap FlashMap) ErrorText() string {
 		}
 	}
 
+	if len(flashMap.SectorErrors) > 0 {
+		str += "Flash areas incompatible with sector layout:\n"
+
+		for _, e := range flashMap.SectorErrors {
+			str += fmt.Sprintf("    %s\n", e)
+		}
+	}
+
 	return str
 }
 
@@ -307,7 +402,24 @@ func Read(ymlFlashMap map[string]interface{}) (FlashMap, error) {
 		flashMap.Areas[k] = area
 	}
 
+	// Device declarations are optional:
+	//     devices:
+	//         0:
+	//             base: 0x08000000
+	//             sector_size: 4kB
+	//         1:
+	//             sectors: [4x16kB, 64kB, 7x128kB]
+	for k, v := range cast.ToStringMap(ymlFlashMap["devices"]) {
+		dev, err := parseFlashDevice(k, cast.ToStringMap(v))
+		if err != nil {
+			return flashMap, err
+		}
+
+		flashMap.Devices[dev.Id] = dev
+	}
+
 	flashMap.detectOverlaps()
+	flashMap.detectSectorErrors()
 
 	return flashMap, nil
 }
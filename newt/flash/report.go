@@ -0,0 +1,232 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flash
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A contiguous region of a flash device.  A span with a nil area is a gap:
+// space between two areas that is not assigned to anything.
+type FlashSpan struct {
+	Device int
+	Offset int
+	Size   int
+	Area   *FlashArea
+}
+
+type areaOffsetSorter struct {
+	areas []FlashArea
+}
+
+func (s areaOffsetSorter) Len() int {
+	return len(s.areas)
+}
+func (s areaOffsetSorter) Swap(i, j int) {
+	s.areas[i], s.areas[j] = s.areas[j], s.areas[i]
+}
+func (s areaOffsetSorter) Less(i, j int) bool {
+	if s.areas[i].Offset != s.areas[j].Offset {
+		return s.areas[i].Offset < s.areas[j].Offset
+	}
+	return s.areas[i].Id < s.areas[j].Id
+}
+
+// Retrieves the areas belonging to the specified device, sorted by offset.
+func (flashMap FlashMap) DeviceAreas(device int) []FlashArea {
+	areas := []FlashArea{}
+	for _, area := range flashMap.Areas {
+		if area.Device == device {
+			areas = append(areas, area)
+		}
+	}
+
+	sort.Sort(areaOffsetSorter{areas})
+	return areas
+}
+
+// Divides the used portion of a flash device into spans.  The device is
+// considered to extend from the start of its first area to the end of its
+// last; any unassigned space in between is reported as a gap.  Overlapping
+// areas produce adjacent spans that overlap; no gap is reported for them.
+func (flashMap FlashMap) DeviceSpans(device int) []FlashSpan {
+	spans := []FlashSpan{}
+
+	end := -1
+	for _, area := range flashMap.DeviceAreas(device) {
+		if end >= 0 && area.Offset > end {
+			spans = append(spans, FlashSpan{
+				Device: device,
+				Offset: end,
+				Size:   area.Offset - end,
+			})
+		}
+
+		a := area
+		spans = append(spans, FlashSpan{
+			Device: device,
+			Offset: area.Offset,
+			Size:   area.Size,
+			Area:   &a,
+		})
+
+		if area.Offset+area.Size > end {
+			end = area.Offset + area.Size
+		}
+	}
+
+	return spans
+}
+
+// Formats a byte count for human consumption (e.g., "16 kB", "1100 B").
+func SizeText(size int) string {
+	if size >= 1024 && size%1024 == 0 {
+		return fmt.Sprintf("%d kB", size/1024)
+	}
+
+	return fmt.Sprintf("%d B", size)
+}
+
+// Produces an ASCII drawing of a device's layout, `width` characters wide.
+// Each area is drawn with a letter and each gap with '.'; a legend mapping
+// letters to area names follows the drawing.
+func (flashMap FlashMap) LayoutText(device int, width int) string {
+	spans := flashMap.DeviceSpans(device)
+	if len(spans) == 0 {
+		return ""
+	}
+
+	start := spans[0].Offset
+	total := 0
+	for _, span := range spans {
+		if span.Offset+span.Size-start > total {
+			total = span.Offset + span.Size - start
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+
+	bar := ""
+	legend := ""
+	letter := 0
+	for _, span := range spans {
+		cols := (span.Size*width + total/2) / total
+		if cols < 1 {
+			cols = 1
+		}
+
+		c := "."
+		if span.Area != nil {
+			c = string('A' + rune(letter%26))
+			legend += fmt.Sprintf("    %s = %s\n", c, span.Area.Name)
+			letter++
+		}
+		bar += strings.Repeat(c, cols)
+	}
+
+	return fmt.Sprintf("    0x%08x [%s] 0x%08x\n", start, bar, start+total) +
+		legend
+}
+
+const (
+	svgWidth      = 800
+	svgMargin     = 20
+	svgRowHeight  = 48
+	svgRowSpacing = 40
+)
+
+// Writes an SVG drawing of the flash map, one row per device.  `labels`
+// supplies optional extra text (e.g., owner or usage) to display beneath
+// each area's name; it is keyed by area name.
+func (flashMap FlashMap) WriteLayoutSvg(w io.Writer,
+	labels map[string]string) {
+
+	devices := flashMap.DeviceIds()
+	height := svgMargin*2 + len(devices)*(svgRowHeight+svgRowSpacing)
+
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" "+
+		"width=\"%d\" height=\"%d\" font-family=\"monospace\" "+
+		"font-size=\"10\">\n", svgWidth+svgMargin*2, height)
+
+	for i, device := range devices {
+		spans := flashMap.DeviceSpans(device)
+		if len(spans) == 0 {
+			continue
+		}
+
+		start := spans[0].Offset
+		total := 0
+		for _, span := range spans {
+			if span.Offset+span.Size-start > total {
+				total = span.Offset + span.Size - start
+			}
+		}
+
+		y := svgMargin + i*(svgRowHeight+svgRowSpacing) + svgRowSpacing/2
+		fmt.Fprintf(w, "  <text x=\"%d\" y=\"%d\" font-size=\"12\">"+
+			"Device %d (0x%08x - 0x%08x)</text>\n",
+			svgMargin, y-6, device, start, start+total)
+
+		for _, span := range spans {
+			x := svgMargin + (span.Offset-start)*svgWidth/total
+			width := span.Size * svgWidth / total
+			if width < 1 {
+				width = 1
+			}
+
+			fill := "#e0e0e0"
+			name := "(gap)"
+			if span.Area != nil {
+				fill = "#9ecae1"
+				name = span.Area.Name
+			}
+
+			title := fmt.Sprintf("%s: offset=0x%08x size=%s",
+				name, span.Offset, SizeText(span.Size))
+			if span.Area != nil && labels[name] != "" {
+				title += "; " + labels[name]
+			}
+
+			fmt.Fprintf(w, "  <g>\n")
+			fmt.Fprintf(w, "    <title>%s</title>\n", html.EscapeString(title))
+			fmt.Fprintf(w, "    <rect x=\"%d\" y=\"%d\" width=\"%d\" "+
+				"height=\"%d\" fill=\"%s\" stroke=\"#333\"/>\n",
+				x, y, width, svgRowHeight, fill)
+
+			if span.Area != nil {
+				fmt.Fprintf(w, "    <text x=\"%d\" y=\"%d\">%s</text>\n",
+					x+2, y+14, html.EscapeString(
+						strings.TrimPrefix(name, "FLASH_AREA_")))
+				if labels[name] != "" {
+					fmt.Fprintf(w, "    <text x=\"%d\" y=\"%d\">%s</text>\n",
+						x+2, y+28, html.EscapeString(labels[name]))
+				}
+			}
+			fmt.Fprintf(w, "  </g>\n")
+		}
+	}
+
+	fmt.Fprintf(w, "</svg>\n")
+}
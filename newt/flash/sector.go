@@ -0,0 +1,350 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flash
+
+import (
+	"fmt"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Sector layouts are declared per device in the BSP's flash map, either as a
+// uniform sector size or as a list of sector sizes starting at offset 0:
+//
+//	bsp.flash_map:
+//	    devices:
+//	        0:
+//	            sector_size: 4kB
+//	        1:
+//	            sectors: [4x16kB, 64kB, 7x128kB]
+//
+// When a device's layout is known, each of its areas must begin and end on a
+// sector boundary, and the image slots must be swappable by the boot loader.
+
+// The maximum number of sectors in an image slot.  The boot loader reserves
+// swap status space for this many sectors in each boot trailer.
+const BOOT_MAX_IMG_SECTORS = 128
+
+// Describes a flash area that is incompatible with its device's sectors.
+type FlashAlignError struct {
+	Area   FlashArea
+	Reason string
+}
+
+func (e FlashAlignError) Text() string {
+	return fmt.Sprintf("%s (offset=0x%08x size=%d) %s",
+		e.Area.Name, e.Area.Offset, e.Area.Size, e.Reason)
+}
+
+// Parses a list of sector specifiers.  Each specifier is either a size
+// ("16kB") or a count and a size ("4x16kB").
+func parseSectors(specs []string) ([]int, error) {
+	if len(specs) == 0 {
+		return nil, util.NewNewtError("empty sector list")
+	}
+
+	sectors := []int{}
+	for _, spec := range specs {
+		count := 1
+		sizeStr := strings.TrimSpace(spec)
+
+		if parts := strings.SplitN(sizeStr, "x", 2); len(parts) == 2 &&
+			!strings.HasPrefix(strings.ToLower(sizeStr), "0x") {
+
+			var err error
+			count, err = util.AtoiNoOct(strings.TrimSpace(parts[0]))
+			if err != nil || count <= 0 {
+				return nil, util.FmtNewtError(
+					"invalid sector specifier: %s", spec)
+			}
+			sizeStr = strings.TrimSpace(parts[1])
+		}
+
+		size, err := parseSize(sizeStr)
+		if err != nil || size <= 0 {
+			return nil, util.FmtNewtError("invalid sector specifier: %s", spec)
+		}
+
+		for i := 0; i < count; i++ {
+			sectors = append(sectors, size)
+		}
+	}
+
+	return sectors, nil
+}
+
+// Indicates whether the device's sector layout is known.
+func (dev FlashDevice) HasSectors() bool {
+	return dev.SectorSize > 0 || len(dev.Sectors) > 0
+}
+
+// Retrieves the sizes of the sectors spanned by the specified region of the
+// device.  An error is returned if the region does not start and end on
+// sector boundaries.  The result is nil if the device's layout is unknown.
+func (dev FlashDevice) RegionSectors(offset int, size int) ([]int, error) {
+	if dev.SectorSize > 0 {
+		if offset%dev.SectorSize != 0 || size%dev.SectorSize != 0 {
+			return nil, util.FmtNewtError(
+				"is not aligned to the %d-byte sectors of flash device %d",
+				dev.SectorSize, dev.Id)
+		}
+
+		sectors := make([]int, size/dev.SectorSize)
+		for i := range sectors {
+			sectors[i] = dev.SectorSize
+		}
+		return sectors, nil
+	}
+
+	if len(dev.Sectors) == 0 {
+		return nil, nil
+	}
+
+	end := offset + size
+
+	var sectors []int
+	startOk := false
+	cur := 0
+	for _, sz := range dev.Sectors {
+		if cur == offset {
+			startOk = true
+		}
+		if cur >= offset && cur < end {
+			sectors = append(sectors, sz)
+		}
+		cur += sz
+
+		if cur == end {
+			if !startOk {
+				break
+			}
+			return sectors, nil
+		}
+	}
+
+	switch {
+	case end > cur:
+		return nil, util.FmtNewtError(
+			"extends beyond the last sector of flash device %d (0x%08x)",
+			dev.Id, cur)
+
+	case !startOk:
+		return nil, util.FmtNewtError(
+			"does not start on a sector boundary of flash device %d",
+			dev.Id)
+
+	default:
+		return nil, util.FmtNewtError(
+			"does not end on a sector boundary of flash device %d",
+			dev.Id)
+	}
+}
+
+// Produces a short description of the device's sector layout (e.g.,
+// "4 x 16 kB, 1 x 64 kB").  Runs of equally sized sectors are collapsed.
+func (dev FlashDevice) SectorText() string {
+	if dev.SectorSize > 0 {
+		return SizeText(dev.SectorSize) + " sectors"
+	}
+
+	runs := []string{}
+	for i := 0; i < len(dev.Sectors); {
+		j := i
+		for j < len(dev.Sectors) && dev.Sectors[j] == dev.Sectors[i] {
+			j++
+		}
+		runs = append(runs,
+			fmt.Sprintf("%d x %s", j-i, SizeText(dev.Sectors[i])))
+		i = j
+	}
+
+	return "sectors: " + strings.Join(runs, ", ")
+}
+
+// Identifies areas that do not start and end on a sector boundary.  Devices
+// with an unknown sector layout are not checked.
+func (flashMap FlashMap) AlignErrors() []FlashAlignError {
+	errs := []FlashAlignError{}
+
+	for _, area := range flashMap.SortedAreas() {
+		dev := flashMap.Device(area.Device)
+		if _, err := dev.RegionSectors(area.Offset, area.Size); err != nil {
+			errs = append(errs, FlashAlignError{
+				Area:   area,
+				Reason: err.Error(),
+			})
+		}
+	}
+
+	return errs
+}
+
+// Retrieves the sizes of the sectors that make up the named area.  The result
+// is nil if the area does not exist, its device's sector layout is unknown, or
+// the area is misaligned.
+func (flashMap FlashMap) AreaSectors(areaName string) []int {
+	area, ok := flashMap.Areas[areaName]
+	if !ok {
+		return nil
+	}
+
+	sectors, err := flashMap.Device(area.Device).RegionSectors(
+		area.Offset, area.Size)
+	if err != nil {
+		return nil
+	}
+
+	return sectors
+}
+
+// Groups the sectors of two image slots into the smallest units that the boot
+// loader swaps at once.  A unit ends wherever both slots share a sector
+// boundary.  The boolean result is false if the slots cannot be divided this
+// way (i.e., they differ in size).
+func swapUnits(sectors0 []int, sectors1 []int) ([]int, bool) {
+	units := []int{}
+
+	i := 0
+	j := 0
+	sz0 := 0
+	sz1 := 0
+	for i < len(sectors0) || j < len(sectors1) {
+		if sz0 <= sz1 && i < len(sectors0) {
+			sz0 += sectors0[i]
+			i++
+		} else if j < len(sectors1) {
+			sz1 += sectors1[j]
+			j++
+		} else {
+			return nil, false
+		}
+
+		if sz0 == sz1 {
+			units = append(units, sz0)
+			sz0 = 0
+			sz1 = 0
+		}
+	}
+
+	return units, sz0 == 0 && sz1 == 0
+}
+
+// Detects areas that are incompatible with their device's sector layout, and
+// image slots that the boot loader would be unable to swap.
+func (flashMap *FlashMap) detectSectorErrors() {
+	flashMap.SectorErrors = nil
+
+	for _, e := range flashMap.AlignErrors() {
+		flashMap.SectorErrors = append(flashMap.SectorErrors, e.Text())
+	}
+
+	sectors0 := flashMap.AreaSectors(FLASH_AREA_NAME_IMAGE_0)
+	sectors1 := flashMap.AreaSectors(FLASH_AREA_NAME_IMAGE_1)
+	if sectors0 == nil || sectors1 == nil {
+		return
+	}
+
+	slotSectors := map[string][]int{
+		FLASH_AREA_NAME_IMAGE_0: sectors0,
+		FLASH_AREA_NAME_IMAGE_1: sectors1,
+	}
+	for _, name := range []string{
+		FLASH_AREA_NAME_IMAGE_0, FLASH_AREA_NAME_IMAGE_1} {
+
+		if n := len(slotSectors[name]); n > BOOT_MAX_IMG_SECTORS {
+			flashMap.SectorErrors = append(flashMap.SectorErrors, fmt.Sprintf(
+				"%s contains %d sectors; the boot loader supports at "+
+					"most %d", name, n, BOOT_MAX_IMG_SECTORS))
+		}
+	}
+
+	units, ok := swapUnits(sectors0, sectors1)
+	if !ok {
+		flashMap.SectorErrors = append(flashMap.SectorErrors, fmt.Sprintf(
+			"%s and %s cannot be swapped; their sector layouts "+
+				"do not divide them into equally sized units",
+			FLASH_AREA_NAME_IMAGE_0, FLASH_AREA_NAME_IMAGE_1))
+		return
+	}
+
+	scratch, ok := flashMap.Areas[FLASH_AREA_NAME_IMAGE_SCRATCH]
+	if !ok {
+		return
+	}
+
+	maxUnit := 0
+	for _, u := range units {
+		if u > maxUnit {
+			maxUnit = u
+		}
+	}
+	if scratch.Size < maxUnit {
+		flashMap.SectorErrors = append(flashMap.SectorErrors, fmt.Sprintf(
+			"%s (size=%d) is smaller than the largest unit swapped "+
+				"between image slots (%d bytes)",
+			FLASH_AREA_NAME_IMAGE_SCRATCH, scratch.Size, maxUnit))
+	}
+}
+
+// Retrieves the number of sectors in the larger image slot, or 0 if the
+// sector layout of either slot is unknown.
+func (flashMap FlashMap) ImageSectorCount() int {
+	sectors0 := flashMap.AreaSectors(FLASH_AREA_NAME_IMAGE_0)
+	sectors1 := flashMap.AreaSectors(FLASH_AREA_NAME_IMAGE_1)
+	if sectors0 == nil || sectors1 == nil {
+		return 0
+	}
+
+	if len(sectors0) > len(sectors1) {
+		return len(sectors0)
+	}
+	return len(sectors1)
+}
+
+// Verifies that a boot trailer of the specified size fits in each image slot
+// and in the scratch area.  The trailer size depends on target configuration,
+// so this check is performed by the builder rather than by Read().
+func (flashMap FlashMap) TrailerErrors(trailerSize int) []string {
+	errs := []string{}
+
+	names := []string{
+		FLASH_AREA_NAME_IMAGE_0,
+		FLASH_AREA_NAME_IMAGE_1,
+		FLASH_AREA_NAME_IMAGE_SCRATCH,
+	}
+	for _, name := range names {
+		area, ok := flashMap.Areas[name]
+		if !ok {
+			continue
+		}
+
+		if area.Size < trailerSize ||
+			(name != FLASH_AREA_NAME_IMAGE_SCRATCH &&
+				area.Size == trailerSize) {
+
+			errs = append(errs, fmt.Sprintf(
+				"%s (size=%d) is too small to hold a %d-byte boot trailer",
+				name, area.Size, trailerSize))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,288 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package flasher implements the backends that newt uses to write images to
+// a device's flash and to start debug sessions.  A BSP selects a backend in
+// bsp.yml; the selection and the backend's settings can be overridden by the
+// user's newtrc and by the target.
+package flasher
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/util"
+)
+
+const (
+	FLASHER_SCRIPT  = "script"
+	FLASHER_OPENOCD = "openocd"
+	FLASHER_JLINK   = "jlink"
+	FLASHER_PYOCD   = "pyocd"
+)
+
+var flasherNames = []string{
+	FLASHER_SCRIPT,
+	FLASHER_OPENOCD,
+	FLASHER_JLINK,
+	FLASHER_PYOCD,
+}
+
+// Everything a backend needs to know about the BSP and the user's setup.
+type Config struct {
+	// Name of the backend (FLASHER_[...]).
+	Backend string
+
+	// Settings specific to the selected backend (e.g., probe serial number).
+	Settings map[string]interface{}
+
+	ProjectPath string
+	BspName     string
+	BspPath     string
+	CorePath    string
+
+	// BSP scripts; used by the script backend.
+	DownloadScript string
+	DebugScript    string
+
+	// Flash devices that the download script is able to program.
+	DownloadDevices []int
+
+	// Flash devices with a base address declared in the BSP's flash map.
+	// Used by the backends that write to absolute addresses.
+	AddressedDevices []int
+}
+
+// Describes a single write to flash.
+type LoadArgs struct {
+	// The file to write.  This is a raw binary.
+	ImagePath string
+
+	// The image path without an extension; passed to BSP scripts.
+	BinBaseName string
+
+	// The flash device to write to, the offset within that device, and the
+	// corresponding absolute address.
+	Device  int
+	Offset  int
+	Address int
+
+	// The image slot being written, or -1 if the write is not to an image
+	// slot (e.g., a manufacturing image).
+	Slot int
+
+	// Whether the image is a boot loader.
+	BootLoader bool
+
+	// Extra command to pass to the debug probe.
+	ExtraCmd string
+
+	// Additional environment settings for script-based backends.
+	Env map[string]string
+}
+
+// Describes a debug session.
+type DebugArgs struct {
+	ElfPath     string
+	BinBaseName string
+
+	// Whether to reset the device when the session starts.
+	Reset bool
+
+	// Only start the gdb server; don't attach a debugger.
+	NoGdb bool
+
+	// Extra command to pass to the debug probe.
+	ExtraCmd string
+
+	// Additional environment settings for script-based backends.
+	Env map[string]string
+}
+
+type Flasher interface {
+	// Name of the backend (FLASHER_[...]).
+	Name() string
+
+	// Indicates whether the backend is able to write an entire section to the
+	// specified flash device.  Used when loading manufacturing images.
+	SupportsDevice(device int) bool
+
+	Load(args LoadArgs) error
+	Debug(args DebugArgs) error
+}
+
+// Creates the backend described by the specified configuration.
+func New(cfg Config) (Flasher, error) {
+	if cfg.Settings == nil {
+		cfg.Settings = map[string]interface{}{}
+	}
+
+	switch cfg.Backend {
+	case "", FLASHER_SCRIPT:
+		return newScriptFlasher(cfg), nil
+
+	case FLASHER_OPENOCD:
+		return newOpenocdFlasher(cfg)
+
+	case FLASHER_JLINK:
+		return newJlinkFlasher(cfg)
+
+	case FLASHER_PYOCD:
+		return newPyocdFlasher(cfg)
+
+	default:
+		return nil, util.FmtNewtError(
+			"unknown flasher \"%s\"; valid flashers are: %s",
+			cfg.Backend, strings.Join(flasherNames, ", "))
+	}
+}
+
+// Writes an image to flash using the specified backend.  Progress is reported
+// and errors are annotated the same way regardless of backend.
+func Load(f Flasher, args LoadArgs) error {
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Loading %s into flash device %d at 0x%x (%s flasher)\n",
+		args.ImagePath, args.Device, args.Address, f.Name())
+
+	start := time.Now()
+	if err := f.Load(args); err != nil {
+		return util.FmtNewtError("%s flasher failed to load %s: %s",
+			f.Name(), args.ImagePath, strings.TrimSpace(err.Error()))
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Successfully loaded image (%.1fs).\n",
+		time.Since(start).Seconds())
+
+	return nil
+}
+
+// Starts a debug session using the specified backend.
+func Debug(f Flasher, args DebugArgs) error {
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Debugging %s (%s flasher)\n", args.ElfPath, f.Name())
+
+	if err := f.Debug(args); err != nil {
+		return util.FmtNewtError("%s flasher failed to start debug "+
+			"session: %s", f.Name(), strings.TrimSpace(err.Error()))
+	}
+
+	return nil
+}
+
+// Reports an intermediate step of a load or debug operation.
+func progress(f Flasher, format string, args ...interface{}) {
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "[%s] %s\n", f.Name(),
+		fmt.Sprintf(format, args...))
+}
+
+// Indicates whether a backend that writes to absolute addresses is able to
+// write to the specified flash device.  Device 0 is internal flash; any other
+// device must declare its base address in the flash map.  Otherwise, its
+// contents would be written over internal flash.
+func addressedDevice(cfg Config, device int) bool {
+	if device == 0 {
+		return true
+	}
+
+	for _, d := range cfg.AddressedDevices {
+		if d == device {
+			return true
+		}
+	}
+
+	return false
+}
+
+func settingString(cfg Config, key string, dflt string) string {
+	if val, ok := cfg.Settings[key]; ok {
+		if s := cast.ToString(val); s != "" {
+			return s
+		}
+	}
+
+	return dflt
+}
+
+func settingInt(cfg Config, key string, dflt int) (int, error) {
+	s := settingString(cfg, key, "")
+	if s == "" {
+		return dflt, nil
+	}
+
+	val, err := util.AtoiNoOct(s)
+	if err != nil {
+		return 0, util.FmtNewtError(
+			"%s flasher: invalid integer setting %s=%s", cfg.Backend, key, s)
+	}
+
+	return val, nil
+}
+
+func settingBool(cfg Config, key string) bool {
+	s := settingString(cfg, key, "")
+	return s != "" && s != "0" && strings.ToLower(s) != "false"
+}
+
+// Reads a list setting.  Lists specified as a single string (e.g., in
+// target.yml) are whitespace-separated.
+func settingList(cfg Config, key string) []string {
+	val, ok := cfg.Settings[key]
+	if !ok {
+		return nil
+	}
+
+	if s, ok := val.(string); ok {
+		return strings.Fields(s)
+	}
+
+	return cast.ToStringSlice(val)
+}
+
+func requireSetting(cfg Config, key string) (string, error) {
+	s := settingString(cfg, key, "")
+	if s == "" {
+		return "", util.FmtNewtError(
+			"%s flasher requires the \"%s\" setting; specify it in the "+
+				"BSP's bsp.flasher_settings", cfg.Backend, key)
+	}
+
+	return s, nil
+}
+
+// Converts a map of environment settings to a sorted list of "key=value"
+// strings.
+func envList(envMap map[string]string) []string {
+	keys := make([]string, 0, len(envMap))
+	for k, _ := range envMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	env := make([]string, 0, len(keys))
+	for _, k := range keys {
+		env = append(env, fmt.Sprintf("%s=%s", k, envMap[k]))
+	}
+
+	return env
+}
@@ -0,0 +1,148 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flasher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Settings:
+//
+//	device:    J-Link device name (e.g., nRF52832_xxAA).  Required.
+//	interface: Target interface (default: SWD).
+//	speed:     Interface speed, in kHz (default: 4000).
+//	serial:    Serial number of the J-Link to use.
+//	command:   J-Link Commander executable (default: JLinkExe).
+//	gdbserver: J-Link gdb server executable (default: JLinkGDBServer).
+//	gdb_port:  gdb server port (default: 2331).
+//	verify:    Whether to verify each image after writing it.
+//	gdb:       gdb executable (default: arm-none-eabi-gdb).
+type jlinkFlasher struct {
+	cfg     Config
+	device  string
+	gdbPort int
+}
+
+func newJlinkFlasher(cfg Config) (*jlinkFlasher, error) {
+	f := &jlinkFlasher{
+		cfg: cfg,
+	}
+
+	var err error
+	if f.device, err = requireSetting(cfg, "device"); err != nil {
+		return nil, err
+	}
+	if f.gdbPort, err = settingInt(cfg, "gdb_port", 2331); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *jlinkFlasher) Name() string {
+	return FLASHER_JLINK
+}
+
+func (f *jlinkFlasher) SupportsDevice(device int) bool {
+	return addressedDevice(f.cfg, device)
+}
+
+// Generates a J-Link Commander script that writes the image and restarts the
+// target.
+func (f *jlinkFlasher) commanderScript(args LoadArgs) string {
+	lines := []string{
+		"r",
+		"h",
+	}
+	if args.ExtraCmd != "" {
+		lines = append(lines, args.ExtraCmd)
+	}
+	lines = append(lines,
+		fmt.Sprintf("loadbin \"%s\", 0x%x", args.ImagePath, args.Address))
+	if settingBool(f.cfg, "verify") {
+		lines = append(lines,
+			fmt.Sprintf("verifybin \"%s\", 0x%x", args.ImagePath,
+				args.Address))
+	}
+	lines = append(lines, "r", "g", "qc")
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func (f *jlinkFlasher) Load(args LoadArgs) error {
+	script := f.commanderScript(args)
+
+	file, err := ioutil.TempFile("", "newt-jlink-")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(script); err != nil {
+		file.Close()
+		return util.ChildNewtError(err)
+	}
+	file.Close()
+
+	progress(f, "commander script:\n%s", script)
+
+	cmd := []string{
+		settingString(f.cfg, "command", "JLinkExe"),
+		"-device", f.device,
+		"-if", settingString(f.cfg, "interface", "SWD"),
+		"-speed", settingString(f.cfg, "speed", "4000"),
+		"-autoconnect", "1",
+		"-ExitOnError", "1",
+	}
+	if serial := settingString(f.cfg, "serial", ""); serial != "" {
+		cmd = append(cmd, "-SelectEmuBySN", serial)
+	}
+	cmd = append(cmd, "-CommandFile", file.Name())
+
+	progress(f, "running %s", strings.Join(cmd, " "))
+	if _, err := util.ShellCommand(cmd, nil); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (f *jlinkFlasher) Debug(args DebugArgs) error {
+	cmd := []string{
+		settingString(f.cfg, "gdbserver", "JLinkGDBServer"),
+		"-device", f.device,
+		"-if", settingString(f.cfg, "interface", "SWD"),
+		"-speed", settingString(f.cfg, "speed", "4000"),
+		"-port", fmt.Sprintf("%d", f.gdbPort),
+		"-singlerun",
+		"-nogui",
+	}
+	if serial := settingString(f.cfg, "serial", ""); serial != "" {
+		cmd = append(cmd, "-select", "USB="+serial)
+	}
+
+	return gdbSession(f, f.cfg, cmd, "localhost", f.gdbPort,
+		"monitor reset", args)
+}
@@ -0,0 +1,245 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flasher
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Settings:
+//
+//	host:     Address of the OpenOCD server (default: localhost).
+//	tcl_port: OpenOCD's TCL RPC port (default: 6666).
+//	gdb_port: OpenOCD's gdb port (default: 3333).
+//	command:  OpenOCD executable (default: openocd).
+//	config:   OpenOCD configuration files.  If specified, newt starts OpenOCD
+//	          itself; otherwise, a running server is assumed.  Relative
+//	          paths are searched for in the BSP directory.
+//	verify:   Whether to verify each image after writing it.
+//	gdb:      gdb executable (default: arm-none-eabi-gdb).
+type openocdFlasher struct {
+	cfg     Config
+	host    string
+	tclPort int
+	gdbPort int
+}
+
+type openocdStep struct {
+	desc string
+	cmd  string
+}
+
+// Terminates each OpenOCD TCL RPC command and response.
+const tclTerminator = 0x1a
+
+const tclTimeout = 60 * time.Second
+
+// A client for OpenOCD's TCL RPC server.
+type tclClient struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func dialTcl(addr string) (*tclClient, error) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tclClient{
+		conn: conn,
+		rd:   bufio.NewReader(conn),
+	}, nil
+}
+
+func (c *tclClient) close() {
+	c.conn.Close()
+}
+
+// Evaluates a TCL script and returns its result.
+func (c *tclClient) eval(script string) (string, error) {
+	c.conn.SetDeadline(time.Now().Add(tclTimeout))
+
+	if _, err := c.conn.Write(
+		append([]byte(script), tclTerminator)); err != nil {
+
+		return "", util.ChildNewtError(err)
+	}
+
+	rsp, err := c.rd.ReadString(tclTerminator)
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	return strings.TrimSuffix(rsp, "\x1a"), nil
+}
+
+// Executes an OpenOCD command.  An error is returned if the command fails.
+func (c *tclClient) run(cmd string) error {
+	script := fmt.Sprintf("if {[catch {%s} e]} {set r \"newt-error: $e\"} "+
+		"else {set r \"newt-ok\"}", cmd)
+
+	rsp, err := c.eval(script)
+	if err != nil {
+		return err
+	}
+
+	if rsp != "newt-ok" {
+		return util.FmtNewtError("\"%s\" failed: %s", cmd,
+			strings.TrimPrefix(rsp, "newt-error: "))
+	}
+
+	return nil
+}
+
+// Quotes a string for use as a single TCL word.
+func tclQuote(s string) string {
+	return "{" + s + "}"
+}
+
+func newOpenocdFlasher(cfg Config) (*openocdFlasher, error) {
+	f := &openocdFlasher{
+		cfg:  cfg,
+		host: settingString(cfg, "host", "localhost"),
+	}
+
+	var err error
+	if f.tclPort, err = settingInt(cfg, "tcl_port", 6666); err != nil {
+		return nil, err
+	}
+	if f.gdbPort, err = settingInt(cfg, "gdb_port", 3333); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *openocdFlasher) Name() string {
+	return FLASHER_OPENOCD
+}
+
+func (f *openocdFlasher) SupportsDevice(device int) bool {
+	return addressedDevice(f.cfg, device)
+}
+
+// Builds the command that starts an OpenOCD server.  The result is nil if no
+// configuration files are specified, in which case a running server is
+// assumed.
+func (f *openocdFlasher) serverCmd(extraCmds ...string) []string {
+	configs := settingList(f.cfg, "config")
+	if len(configs) == 0 {
+		return nil
+	}
+
+	cmd := []string{settingString(f.cfg, "command", "openocd")}
+	if f.cfg.BspPath != "" {
+		cmd = append(cmd, "-s", f.cfg.BspPath)
+	}
+	for _, c := range configs {
+		cmd = append(cmd, "-f", c)
+	}
+	for _, c := range extraCmds {
+		if c != "" {
+			cmd = append(cmd, "-c", c)
+		}
+	}
+
+	return cmd
+}
+
+func (f *openocdFlasher) Load(args LoadArgs) error {
+	addr := fmt.Sprintf("%s:%d", f.host, f.tclPort)
+
+	serverCmd := f.serverCmd(
+		fmt.Sprintf("tcl_port %d", f.tclPort),
+		"gdb_port disabled",
+		"telnet_port disabled")
+
+	var s *server
+	if serverCmd != nil {
+		var err error
+		s, err = startServer(f, serverCmd, addr)
+		if err != nil {
+			return err
+		}
+		defer s.stop()
+	}
+
+	c, err := dialTcl(addr)
+	if err != nil {
+		return util.FmtNewtError("could not connect to OpenOCD at %s (%s); "+
+			"start OpenOCD or specify the \"config\" setting", addr,
+			err.Error())
+	}
+	defer c.close()
+
+	img := tclQuote(args.ImagePath)
+	address := fmt.Sprintf("0x%x", args.Address)
+
+	steps := []openocdStep{
+		{"halting target", "reset halt"},
+		{"running extra command", args.ExtraCmd},
+		{"erasing and writing " + args.ImagePath,
+			"flash write_image erase " + img + " " + address + " bin"},
+	}
+	if settingBool(f.cfg, "verify") {
+		steps = append(steps, openocdStep{
+			"verifying", "verify_image " + img + " " + address + " bin"})
+	}
+	steps = append(steps, openocdStep{"resetting target", "reset run"})
+
+	for _, step := range steps {
+		if step.cmd == "" {
+			continue
+		}
+
+		progress(f, "%s", step.desc)
+		if err := c.run(step.cmd); err != nil {
+			return err
+		}
+	}
+
+	if s != nil {
+		c.eval("shutdown")
+		select {
+		case <-s.exited:
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	return nil
+}
+
+func (f *openocdFlasher) Debug(args DebugArgs) error {
+	serverCmd := f.serverCmd(
+		fmt.Sprintf("gdb_port %d", f.gdbPort),
+		"tcl_port disabled",
+		"telnet_port disabled",
+		args.ExtraCmd)
+
+	return gdbSession(f, f.cfg, serverCmd, f.host, f.gdbPort,
+		"monitor reset halt", args)
+}
@@ -0,0 +1,106 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flasher
+
+import (
+	"fmt"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Settings:
+//
+//	target:    pyOCD target type (e.g., nrf52).  Required.
+//	probe:     Unique ID of the debug probe to use.
+//	frequency: SWD/JTAG frequency, in Hz.
+//	command:   pyOCD executable (default: pyocd).
+//	gdb_port:  gdb server port (default: 3333).
+//	gdb:       gdb executable (default: arm-none-eabi-gdb).
+type pyocdFlasher struct {
+	cfg     Config
+	target  string
+	gdbPort int
+}
+
+func newPyocdFlasher(cfg Config) (*pyocdFlasher, error) {
+	f := &pyocdFlasher{
+		cfg: cfg,
+	}
+
+	var err error
+	if f.target, err = requireSetting(cfg, "target"); err != nil {
+		return nil, err
+	}
+	if f.gdbPort, err = settingInt(cfg, "gdb_port", 3333); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *pyocdFlasher) Name() string {
+	return FLASHER_PYOCD
+}
+
+func (f *pyocdFlasher) SupportsDevice(device int) bool {
+	return addressedDevice(f.cfg, device)
+}
+
+// Builds a pyOCD command line for the specified subcommand, including the
+// options common to all subcommands.
+func (f *pyocdFlasher) cmd(subcmd string) []string {
+	cmd := []string{
+		settingString(f.cfg, "command", "pyocd"),
+		subcmd,
+		"--target", f.target,
+	}
+	if probe := settingString(f.cfg, "probe", ""); probe != "" {
+		cmd = append(cmd, "--uid", probe)
+	}
+	if freq := settingString(f.cfg, "frequency", ""); freq != "" {
+		cmd = append(cmd, "--frequency", freq)
+	}
+
+	return cmd
+}
+
+func (f *pyocdFlasher) Load(args LoadArgs) error {
+	cmd := f.cmd("load")
+	cmd = append(cmd,
+		"--base-address", fmt.Sprintf("0x%x", args.Address),
+		"--format", "bin",
+		args.ImagePath)
+
+	progress(f, "running %s", strings.Join(cmd, " "))
+	if _, err := util.ShellCommand(cmd, nil); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (f *pyocdFlasher) Debug(args DebugArgs) error {
+	cmd := f.cmd("gdbserver")
+	cmd = append(cmd, "--port", fmt.Sprintf("%d", f.gdbPort))
+
+	return gdbSession(f, f.cfg, cmd, "localhost", f.gdbPort,
+		"monitor reset halt", args)
+}
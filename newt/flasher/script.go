@@ -0,0 +1,153 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flasher
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Runs the BSP's download and debug scripts.  Load arguments are passed to the
+// scripts via the following environment settings:
+//
+//	CORE_PATH=<path of apache-mynewt-core repo>
+//	BSP_PATH=<path of BSP package>
+//	BIN_BASENAME=<image path without extension>
+//	IMAGE_SLOT=<slot number>
+//	FLASH_OFFSET=<offset within flash device>
+//	FLASH_ADDRESS=<absolute address to write to>
+//	EXTRA_JTAG_CMD=<extra command>
+//
+// Settings in LoadArgs.Env take precedence over these.
+//
+// For backwards compatibility, the BSP path and binary base name are also
+// passed as command line arguments.
+type scriptFlasher struct {
+	cfg Config
+}
+
+func newScriptFlasher(cfg Config) *scriptFlasher {
+	return &scriptFlasher{
+		cfg: cfg,
+	}
+}
+
+func (f *scriptFlasher) Name() string {
+	return FLASHER_SCRIPT
+}
+
+func (f *scriptFlasher) SupportsDevice(device int) bool {
+	for _, d := range f.cfg.DownloadDevices {
+		if d == device {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *scriptFlasher) baseEnv(binBaseName string) []string {
+	return []string{
+		fmt.Sprintf("CORE_PATH=%s", f.cfg.CorePath),
+		fmt.Sprintf("BSP_PATH=%s", f.cfg.BspPath),
+		fmt.Sprintf("BIN_BASENAME=%s", binBaseName),
+	}
+}
+
+func (f *scriptFlasher) Load(args LoadArgs) error {
+	if f.cfg.DownloadScript == "" {
+		progress(f, "BSP %s does not specify a download script; "+
+			"nothing to do", f.cfg.BspName)
+		return nil
+	}
+
+	envMap := map[string]string{}
+	if args.Slot >= 0 {
+		envMap["IMAGE_SLOT"] = fmt.Sprintf("%d", args.Slot)
+	}
+	envMap["FLASH_OFFSET"] = fmt.Sprintf("0x%x", args.Offset)
+	envMap["FLASH_ADDRESS"] = fmt.Sprintf("0x%x", args.Address)
+	if args.ExtraCmd != "" {
+		envMap["EXTRA_JTAG_CMD"] = args.ExtraCmd
+	}
+	for k, v := range args.Env {
+		envMap[k] = v
+	}
+
+	env := append(envList(envMap), f.baseEnv(args.BinBaseName)...)
+
+	cmd := []string{
+		f.cfg.DownloadScript,
+		f.cfg.BspPath,
+		args.BinBaseName,
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Load command: %s\n",
+		strings.Join(cmd, " "))
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Environment:\n")
+	for _, v := range env {
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "* %s\n", v)
+	}
+	if _, err := util.ShellCommand(cmd, env); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (f *scriptFlasher) Debug(args DebugArgs) error {
+	if f.cfg.DebugScript == "" {
+		return util.FmtNewtError("BSP %s does not specify a debug script "+
+			"(bsp.debugscript)", f.cfg.BspName)
+	}
+
+	env := f.baseEnv(args.BinBaseName)
+	env = append(env, envList(args.Env)...)
+	if args.ExtraCmd != "" {
+		env = append(env, fmt.Sprintf("EXTRA_JTAG_CMD=%s", args.ExtraCmd))
+	}
+	if args.Reset {
+		env = append(env, "RESET=true")
+	}
+	if args.NoGdb {
+		env = append(env, "NO_GDB=1")
+	}
+
+	if err := os.Chdir(f.cfg.ProjectPath); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	cmd := []string{
+		f.cfg.DebugScript,
+		f.cfg.BspPath,
+		args.BinBaseName,
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Debug command: %s\n",
+		strings.Join(cmd, " "))
+	util.StatusMessage(util.VERBOSITY_VERBOSE, "Environment:\n")
+	for _, v := range env {
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "* %s\n", v)
+	}
+	return util.ShellInteractiveCommand(cmd, env)
+}
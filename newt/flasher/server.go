@@ -0,0 +1,161 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package flasher
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"mynewt.apache.org/newt/util"
+)
+
+const DEFAULT_GDB = "arm-none-eabi-gdb"
+
+// How long to wait for a newly started server to accept connections.
+const serverStartTimeout = 10 * time.Second
+
+// A probe server (e.g., OpenOCD or a gdb server) running in the background.
+type server struct {
+	cmd    *exec.Cmd
+	output bytes.Buffer
+
+	// Closed when the process terminates.
+	exited chan struct{}
+}
+
+func lookPath(cfg Config, name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", util.FmtNewtError(
+			"%s flasher: could not find \"%s\" in PATH", cfg.Backend, name)
+	}
+
+	return path, nil
+}
+
+// Starts the specified command in the background and waits until it accepts
+// connections on the specified address.
+func startServer(f Flasher, cmdStrs []string, addr string) (*server, error) {
+	progress(f, "starting %s", strings.Join(cmdStrs, " "))
+
+	s := &server{
+		cmd:    exec.Command(cmdStrs[0], cmdStrs[1:]...),
+		exited: make(chan struct{}),
+	}
+	s.cmd.Stdout = &s.output
+	s.cmd.Stderr = &s.output
+
+	if err := s.cmd.Start(); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	go func() {
+		s.cmd.Wait()
+		close(s.exited)
+	}()
+
+	deadline := time.Now().Add(serverStartTimeout)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return s, nil
+		}
+
+		select {
+		case <-s.exited:
+			return nil, util.FmtNewtError("%s exited unexpectedly:\n%s",
+				cmdStrs[0], s.output.String())
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		if time.Now().After(deadline) {
+			s.stop()
+			return nil, util.FmtNewtError(
+				"%s did not accept connections on %s within %s:\n%s",
+				cmdStrs[0], addr, serverStartTimeout, s.output.String())
+		}
+	}
+}
+
+// Terminates the server if it is still running.
+func (s *server) stop() {
+	select {
+	case <-s.exited:
+		return
+	default:
+	}
+
+	s.cmd.Process.Kill()
+	<-s.exited
+}
+
+// Runs an interactive gdb session against a gdb server.  If serverCmd is not
+// nil, the server is started first and stopped when gdb exits; otherwise, an
+// already-running server is assumed.  With NoGdb, only the server is run, in
+// the foreground.
+func gdbSession(f Flasher, cfg Config, serverCmd []string, host string,
+	port int, resetCmd string, args DebugArgs) error {
+
+	addr := fmt.Sprintf("%s:%d", host, port)
+
+	if args.NoGdb {
+		if serverCmd == nil {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Using gdb server at %s\n", addr)
+			return nil
+		}
+
+		path, err := lookPath(cfg, serverCmd[0])
+		if err != nil {
+			return err
+		}
+		serverCmd[0] = path
+		return util.ShellInteractiveCommand(serverCmd, nil)
+	}
+
+	gdb, err := lookPath(cfg, settingString(cfg, "gdb", DEFAULT_GDB))
+	if err != nil {
+		return err
+	}
+
+	if serverCmd != nil {
+		s, err := startServer(f, serverCmd, addr)
+		if err != nil {
+			return err
+		}
+		defer s.stop()
+	}
+
+	gdbCmd := []string{
+		gdb,
+		"-ex", "target extended-remote " + addr,
+	}
+	if args.Reset && resetCmd != "" {
+		gdbCmd = append(gdbCmd, "-ex", resetCmd)
+	}
+	gdbCmd = append(gdbCmd, args.ElfPath)
+
+	progress(f, "running %s", strings.Join(gdbCmd, " "))
+	return util.ShellInteractiveCommand(gdbCmd, nil)
+}
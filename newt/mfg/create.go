@@ -41,6 +41,14 @@ type mfgManifest struct {
 	Version     string `json:"version"`
 	MetaSection int    `json:"meta_section"`
 	MetaOffset  int    `json:"meta_offset"`
+
+	Units []mfgUnitManifest `json:"units,omitempty"`
+}
+
+type mfgUnitManifest struct {
+	Id       string   `json:"id"`
+	MfgHash  string   `json:"mfg_hash"`
+	Sections []string `json:"sections"`
 }
 
 type createState struct {
@@ -173,7 +181,11 @@ func sectionFromParts(parts []mfgPart) []byte {
 	return section
 }
 
-func (mi *MfgImage) devicePartMap() (map[int][]mfgPart, error) {
+// Groups the image's parts by flash device.  unitParts contains the
+// provisioned data for a single unit; it is nil for the common image.
+func (mi *MfgImage) devicePartMap(unitParts []mfgPart) (
+	map[int][]mfgPart, error) {
+
 	dpMap := map[int][]mfgPart{}
 
 	// Create parts from the raw entries.
@@ -189,6 +201,10 @@ func (mi *MfgImage) devicePartMap() (map[int][]mfgPart, error) {
 	}
 	dpMap[0] = append(dpMap[0], targetParts...)
 
+	for _, part := range unitParts {
+		dpMap[part.device] = append(dpMap[part.device], part)
+	}
+
 	// Sort each part slice by offset.
 	for device, _ := range dpMap {
 		sortParts(dpMap[device])
@@ -197,8 +213,10 @@ func (mi *MfgImage) devicePartMap() (map[int][]mfgPart, error) {
 	return dpMap, nil
 }
 
-func (mi *MfgImage) deviceSectionMap() (map[int][]byte, error) {
-	dpMap, err := mi.devicePartMap()
+func (mi *MfgImage) deviceSectionMap(unitParts []mfgPart) (
+	map[int][]byte, error) {
+
+	dpMap, err := mi.devicePartMap(unitParts)
 	if err != nil {
 		return nil, err
 	}
@@ -212,16 +230,18 @@ func (mi *MfgImage) deviceSectionMap() (map[int][]byte, error) {
 	return dsMap, nil
 }
 
-func (mi *MfgImage) createSections() (createState, error) {
+// Creates the sections of a manufacturing image.  The meta region and its
+// hash are computed separately for each set of sections.
+func (mi *MfgImage) createSections(unitParts []mfgPart) (createState, error) {
 	cs := createState{}
 
 	var err error
 
-	if err := mi.detectOverlaps(); err != nil {
+	if err := mi.detectOverlaps(unitParts); err != nil {
 		return cs, err
 	}
 
-	cs.dsMap, err = mi.deviceSectionMap()
+	cs.dsMap, err = mi.deviceSectionMap(unitParts)
 	if err != nil {
 		return cs, err
 	}
@@ -231,18 +251,13 @@ func (mi *MfgImage) createSections() (createState, error) {
 	}
 
 	cs.metaOffset, cs.hashOffset, err = insertMeta(cs.dsMap[0],
-		mi.bsp.FlashMap)
+		mi.bsp.FlashMap, mi.metaTlvs, mi.metaMaxSize)
 	if err != nil {
 		return cs, err
 	}
 
 	// Calculate manufacturing hash.
-	devices := make([]int, 0, len(cs.dsMap))
-	for device, _ := range cs.dsMap {
-		devices = append(devices, device)
-	}
-	sort.Ints(devices)
-
+	devices := sortedDevices(cs.dsMap)
 	sections := make([][]byte, len(devices))
 	for i, device := range devices {
 		sections[i] = cs.dsMap[device]
@@ -253,6 +268,16 @@ func (mi *MfgImage) createSections() (createState, error) {
 	return cs, nil
 }
 
+func sortedDevices(dsMap map[int][]byte) []int {
+	devices := make([]int, 0, len(dsMap))
+	for device, _ := range dsMap {
+		devices = append(devices, device)
+	}
+	sort.Ints(devices)
+
+	return devices
+}
+
 func areaNameFromImgIdx(imgIdx int) (string, error) {
 	switch imgIdx {
 	case 0:
@@ -419,6 +444,12 @@ func (mi *MfgImage) FromPaths() []string {
 		paths = append(paths, raw.filename)
 	}
 
+	if len(mi.records) > 0 {
+		paths = append(paths, mi.recordsPath)
+	}
+
+	paths = append(paths, mi.metaTlvPaths()...)
+
 	return paths
 }
 
@@ -427,7 +458,11 @@ func (mi *MfgImage) build() (createState, error) {
 		return createState{}, err
 	}
 
-	cs, err := mi.createSections()
+	if err := mi.resolveMetaTlvs(); err != nil {
+		return createState{}, err
+	}
+
+	cs, err := mi.createSections(nil)
 	if err != nil {
 		return cs, err
 	}
@@ -435,13 +470,71 @@ func (mi *MfgImage) build() (createState, error) {
 	return cs, nil
 }
 
-func (mi *MfgImage) createManifest(cs createState) ([]byte, error) {
+func writeSections(cs createState, pathFn func(device int) string) error {
+	for device, section := range cs.dsMap {
+		sectionPath := pathFn(device)
+		if err := os.MkdirAll(filepath.Dir(sectionPath), 0755); err != nil {
+			return util.ChildNewtError(err)
+		}
+		if err := ioutil.WriteFile(sectionPath, section, 0644); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	return nil
+}
+
+// Creates and writes a set of sections for each provisioned unit.
+func (mi *MfgImage) createUnits() ([]mfgUnitManifest, error) {
+	units := make([]mfgUnitManifest, len(mi.records))
+	for i, rec := range mi.records {
+		parts, err := mi.unitParts(rec)
+		if err != nil {
+			return nil, err
+		}
+
+		cs, err := mi.createSections(parts)
+		if err != nil {
+			return nil, util.FmtNewtError("unit %s: %s", rec.Id, err.Error())
+		}
+
+		pathFn := func(device int) string {
+			return MfgUnitSectionBinPath(mi.basePkg.Name(), rec.Id, device)
+		}
+		if err := writeSections(cs, pathFn); err != nil {
+			return nil, err
+		}
+		if err := mi.writeFormatted(cs, pathFn, MfgUnitCombinedPath(
+			mi.basePkg.Name(), rec.Id, mi.formatExt())); err != nil {
+
+			return nil, err
+		}
+
+		units[i] = mfgUnitManifest{
+			Id:      rec.Id,
+			MfgHash: fmt.Sprintf("%x", cs.hash),
+		}
+		for _, device := range sortedDevices(cs.dsMap) {
+			units[i].Sections = append(units[i].Sections, pathFn(device))
+		}
+
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Created sections for unit %s; mfg hash %x\n", rec.Id, cs.hash)
+	}
+
+	return units, nil
+}
+
+func (mi *MfgImage) createManifest(cs createState,
+	units []mfgUnitManifest) ([]byte, error) {
+
 	manifest := mfgManifest{
 		BuildTime:   time.Now().Format(time.RFC3339),
 		Version:     mi.version.String(),
 		MfgHash:     fmt.Sprintf("%x", cs.hash),
 		MetaSection: 0,
 		MetaOffset:  cs.metaOffset,
+		Units:       units,
 	}
 	buffer, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
@@ -476,6 +569,8 @@ func (mi *MfgImage) ToPaths() []string {
 	}
 
 	paths = append(paths, mi.SectionBinPaths()...)
+	paths = append(paths, mi.UnitSectionBinPaths()...)
+	paths = append(paths, mi.FormattedPaths()...)
 	paths = append(paths, mi.ManifestPath())
 
 	return paths
@@ -488,19 +583,32 @@ func (mi *MfgImage) CreateMfgImage() ([]string, error) {
 		return nil, err
 	}
 
-	sectionDir := MfgSectionBinDir(mi.basePkg.Name())
-	if err := os.MkdirAll(sectionDir, 0755); err != nil {
+	pathFn := func(device int) string {
+		return MfgSectionBinPath(mi.basePkg.Name(), device)
+	}
+	if err := writeSections(cs, pathFn); err != nil {
+		return nil, err
+	}
+	if err := mi.writeFormatted(cs, pathFn,
+		MfgCombinedPath(mi.basePkg.Name(), mi.formatExt())); err != nil {
+
+		return nil, err
+	}
+
+	// Remove the units of a previous run; they may not exist in this one.
+	if err := os.RemoveAll(MfgUnitsDir(mi.basePkg.Name())); err != nil {
 		return nil, util.ChildNewtError(err)
 	}
 
-	for device, section := range cs.dsMap {
-		sectionPath := MfgSectionBinPath(mi.basePkg.Name(), device)
-		if err := ioutil.WriteFile(sectionPath, section, 0644); err != nil {
-			return nil, util.ChildNewtError(err)
+	var units []mfgUnitManifest
+	if len(mi.records) > 0 {
+		units, err = mi.createUnits()
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	manifest, err := mi.createManifest(cs)
+	manifest, err := mi.createManifest(cs, units)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,324 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/util"
+)
+
+// Output formats for manufacturing images.  Raw .bin sections are always
+// generated; the other formats are produced in addition to them.
+const (
+	MFG_FORMAT_BIN  = "bin"
+	MFG_FORMAT_IHEX = "ihex"
+	MFG_FORMAT_SREC = "srec"
+)
+
+var mfgFormatExts = map[string]string{
+	MFG_FORMAT_BIN:  "bin",
+	MFG_FORMAT_IHEX: "hex",
+	MFG_FORMAT_SREC: "srec",
+}
+
+// Runs of unwritten flash (0xff) at least this long are omitted from
+// address-bearing output formats.
+const MFG_SPARSE_MIN_GAP = 16
+
+const IHEX_RECORD_LEN = 16
+const SREC_RECORD_LEN = 32
+
+// A contiguous run of data at an absolute address.
+type mfgSegment struct {
+	addr int
+	data []byte
+}
+
+type segmentSorter []mfgSegment
+
+func (s segmentSorter) Len() int {
+	return len(s)
+}
+func (s segmentSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s segmentSorter) Less(i, j int) bool {
+	return s[i].addr < s[j].addr
+}
+
+func (mi *MfgImage) SetFormat(format string) error {
+	if _, ok := mfgFormatExts[format]; !ok {
+		return util.FmtNewtError(
+			"invalid mfg output format \"%s\"; must be one of: bin, ihex, srec",
+			format)
+	}
+
+	mi.format = format
+	return nil
+}
+
+func (mi *MfgImage) formatExt() string {
+	return mfgFormatExts[mi.format]
+}
+
+// Splits a section into the segments that contain data.  Long runs of
+// unwritten flash are left out rather than being padded with 0xff.
+func sectionSegments(section []byte, base int) []mfgSegment {
+	segs := []mfgSegment{}
+
+	start := -1
+	gap := 0
+	for i, b := range section {
+		if b == 0xff {
+			gap++
+			if start >= 0 && gap >= MFG_SPARSE_MIN_GAP {
+				end := i + 1 - gap
+				segs = append(segs, mfgSegment{
+					addr: base + start,
+					data: section[start:end],
+				})
+				start = -1
+			}
+			continue
+		}
+
+		if start < 0 {
+			start = i
+		}
+		gap = 0
+	}
+
+	if start >= 0 {
+		segs = append(segs, mfgSegment{
+			addr: base + start,
+			data: bytes.TrimRight(section[start:], "\xff"),
+		})
+	}
+
+	return segs
+}
+
+// Converts the sections of a manufacturing image into segments with absolute
+// addresses, as determined by the base address of each flash device.
+func deviceSegments(dsMap map[int][]byte,
+	flashMap flash.FlashMap) ([]mfgSegment, error) {
+
+	type devRange struct {
+		device int
+		lo     int
+		hi     int
+	}
+
+	segs := []mfgSegment{}
+	ranges := []devRange{}
+	for _, device := range sortedDevices(dsMap) {
+		base := flashMap.Device(device).Base
+		section := dsMap[device]
+		segs = append(segs, sectionSegments(section, base)...)
+		ranges = append(ranges, devRange{device, base, base + len(section)})
+	}
+
+	// Each device must occupy its own address range.
+	for i, r0 := range ranges {
+		for _, r1 := range ranges[i+1:] {
+			if r0.lo < r1.hi && r1.lo < r0.hi {
+				return nil, util.FmtNewtError(
+					"flash devices %d and %d overlap in the address space "+
+						"(0x%x-0x%x, 0x%x-0x%x); declare device base "+
+						"addresses in bsp.flash_map.devices",
+					r0.device, r1.device, r0.lo, r0.hi, r1.lo, r1.hi)
+			}
+		}
+	}
+
+	sort.Sort(segmentSorter(segs))
+
+	return segs, nil
+}
+
+func checksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return sum
+}
+
+func ihexRecord(buf *bytes.Buffer, typ byte, addr int, data []byte) {
+	rec := []byte{byte(len(data)), byte(addr >> 8), byte(addr), typ}
+	rec = append(rec, data...)
+	rec = append(rec, -checksum(rec))
+	fmt.Fprintf(buf, ":%X\n", rec)
+}
+
+// Encodes a set of segments as Intel HEX.
+func encodeIhex(segs []mfgSegment) []byte {
+	buf := &bytes.Buffer{}
+
+	upper := 0
+	for _, seg := range segs {
+		for off := 0; off < len(seg.data); {
+			addr := seg.addr + off
+
+			if addr>>16 != upper {
+				upper = addr >> 16
+				ihexRecord(buf, 0x04, 0, []byte{byte(upper >> 8), byte(upper)})
+			}
+
+			// A record cannot cross a 64 KB boundary.
+			n := util.IntMin(IHEX_RECORD_LEN, len(seg.data)-off)
+			n = util.IntMin(n, 0x10000-(addr&0xffff))
+
+			ihexRecord(buf, 0x00, addr&0xffff, seg.data[off:off+n])
+			off += n
+		}
+	}
+
+	ihexRecord(buf, 0x01, 0, nil)
+
+	return buf.Bytes()
+}
+
+func srecRecord(buf *bytes.Buffer, typ int, addr []byte, data []byte) {
+	rec := []byte{byte(len(addr) + len(data) + 1)}
+	rec = append(rec, addr...)
+	rec = append(rec, data...)
+	rec = append(rec, ^checksum(rec))
+	fmt.Fprintf(buf, "S%d%X\n", typ, rec)
+}
+
+func srecAddr32(addr int) []byte {
+	return []byte{byte(addr >> 24), byte(addr >> 16), byte(addr >> 8),
+		byte(addr)}
+}
+
+// Encodes a set of segments as Motorola S-records with 32-bit addresses.
+func encodeSrec(segs []mfgSegment, header string) []byte {
+	buf := &bytes.Buffer{}
+
+	srecRecord(buf, 0, []byte{0, 0}, []byte(header))
+
+	count := 0
+	for _, seg := range segs {
+		for off := 0; off < len(seg.data); off += SREC_RECORD_LEN {
+			end := util.IntMin(off+SREC_RECORD_LEN, len(seg.data))
+			srecRecord(buf, 3, srecAddr32(seg.addr+off), seg.data[off:end])
+			count++
+		}
+	}
+
+	// The record count is optional; S5 holds 16 bits and S6 holds 24.
+	if count <= 0xffff {
+		srecRecord(buf, 5, []byte{byte(count >> 8), byte(count)}, nil)
+	} else if count <= 0xffffff {
+		srecRecord(buf, 6,
+			[]byte{byte(count >> 16), byte(count >> 8), byte(count)}, nil)
+	}
+	srecRecord(buf, 7, srecAddr32(0), nil)
+
+	return buf.Bytes()
+}
+
+func (mi *MfgImage) encodeSegments(segs []mfgSegment) []byte {
+	switch mi.format {
+	case MFG_FORMAT_IHEX:
+		return encodeIhex(segs)
+	case MFG_FORMAT_SREC:
+		return encodeSrec(segs, filepath.Base(mi.basePkg.Name()))
+	default:
+		panic("invalid mfg format: " + mi.format)
+	}
+}
+
+// Writes each section, and a single file covering every device, in the
+// configured output format.  Nothing is written for the raw binary format.
+func (mi *MfgImage) writeFormatted(cs createState,
+	pathFn func(device int) string, combinedPath string) error {
+
+	if mi.format == "" || mi.format == MFG_FORMAT_BIN {
+		return nil
+	}
+
+	write := func(path string, segs []mfgSegment) error {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return util.ChildNewtError(err)
+		}
+		if err := ioutil.WriteFile(path, mi.encodeSegments(segs),
+			0644); err != nil {
+
+			return util.ChildNewtError(err)
+		}
+		return nil
+	}
+
+	for _, device := range sortedDevices(cs.dsMap) {
+		base := mi.bsp.FlashMap.Device(device).Base
+		path := formattedPath(pathFn(device), mi.formatExt())
+		if err := write(path,
+			sectionSegments(cs.dsMap[device], base)); err != nil {
+
+			return err
+		}
+	}
+
+	segs, err := deviceSegments(cs.dsMap, mi.bsp.FlashMap)
+	if err != nil {
+		return err
+	}
+
+	return write(combinedPath, segs)
+}
+
+func formattedPath(binPath string, ext string) string {
+	return strings.TrimSuffix(binPath, ".bin") + "." + ext
+}
+
+// Returns the paths of the files written in the configured output format.
+func (mi *MfgImage) FormattedPaths() []string {
+	if mi.format == "" || mi.format == MFG_FORMAT_BIN {
+		return nil
+	}
+
+	ext := mi.formatExt()
+	paths := []string{}
+	for _, path := range mi.SectionBinPaths() {
+		paths = append(paths, formattedPath(path, ext))
+	}
+	paths = append(paths, MfgCombinedPath(mi.basePkg.Name(), ext))
+
+	unitPaths := mi.UnitSectionBinPaths()
+	for _, path := range unitPaths {
+		paths = append(paths, formattedPath(path, ext))
+	}
+	for _, rec := range mi.records {
+		paths = append(paths,
+			MfgUnitCombinedPath(mi.basePkg.Name(), rec.Id, ext))
+	}
+
+	return paths
+}
@@ -0,0 +1,99 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func expectLines(t *testing.T, actual []byte, expected []string) {
+	lines := strings.Split(strings.TrimSuffix(string(actual), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d:\n%s", len(expected), len(lines),
+			string(actual))
+	}
+
+	for i, line := range lines {
+		if line != expected[i] {
+			t.Errorf("line %d: expected %s, got %s", i+1, expected[i], line)
+		}
+	}
+}
+
+// Data on both sides of a 64 KB boundary is split into two records, with an
+// extended linear address record between them.
+func TestIhexBoundary(t *testing.T) {
+	data := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07,
+		0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+	}
+	segs := []mfgSegment{{addr: 0xfff8, data: data}}
+
+	expectLines(t, encodeIhex(segs), []string{
+		":08FFF8000001020304050607E5",
+		":020000040001F9",
+		":0800000008090A0B0C0D0E0F9C",
+		":00000001FF",
+	})
+}
+
+// A long run of unwritten flash splits a section into separate segments.
+func TestSparseGap(t *testing.T) {
+	section := []byte{0x01, 0x02, 0x03}
+	section = append(section, bytes.Repeat([]byte{0xff}, 16)...)
+	section = append(section, 0x04, 0x05, 0xff, 0xff)
+
+	segs := sectionSegments(section, 0x08000000)
+	if len(segs) != 2 {
+		t.Fatalf("expected 2 segments, got %d", len(segs))
+	}
+
+	expectLines(t, encodeIhex(segs), []string{
+		":020000040800F2",
+		":03000000010203F7",
+		":020013000405E2",
+		":00000001FF",
+	})
+
+	segs = sectionSegments(section, 0x1000)
+	expectLines(t, encodeSrec(segs, "t"), []string{
+		"S00400007487",
+		"S30800001000010203E1",
+		"S307000010130405CC",
+		"S5030002FA",
+		"S70500000000FA",
+	})
+}
+
+// Record counts that do not fit in 16 bits are written as an S6 record.
+func TestSrecCount24(t *testing.T) {
+	segs := []mfgSegment{{
+		addr: 0,
+		data: make([]byte, 0x10000*SREC_RECORD_LEN),
+	}}
+
+	srec := encodeSrec(segs, "t")
+	lines := strings.Split(strings.TrimSuffix(string(srec), "\n"), "\n")
+	if count := lines[len(lines)-2]; count != "S604010000FA" {
+		t.Errorf("expected count record S604010000FA, got %s", count)
+	}
+}
@@ -0,0 +1,580 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/util"
+)
+
+// A TLV in the meta region that newt does not interpret.
+type MetaTlv struct {
+	Type   uint8
+	Offset int
+	Data   []byte
+}
+
+// The decoded contents of a manufacturing meta region.
+type MfgMeta struct {
+	// Location of the region within section 0.
+	Offset int
+	Size   int
+
+	Version    uint8
+	Hash       []byte
+	HashOffset int
+	FlashAreas []flash.FlashArea
+	OtherTlvs  []MetaTlv
+}
+
+// Information about a firmware image embedded in a manufacturing image.
+type MfgImageInfo struct {
+	Area flash.FlashArea
+
+	// False if the image slot is unwritten (all 0xff).
+	Present bool
+
+	Header    image.ImageHdr
+	Hash      []byte
+	CalcHash  []byte
+	ParseErr  string
+	Bootable  bool
+	TotalSize int
+}
+
+func (info *MfgImageInfo) HashOk() bool {
+	return info.Hash != nil && bytes.Equal(info.Hash, info.CalcHash)
+}
+
+// The result of inspecting a set of manufacturing image sections.
+type MfgInspection struct {
+	// Section file paths and contents, keyed by flash device.
+	SectionPaths map[int]string
+	Sections     map[int][]byte
+
+	Meta     *MfgMeta
+	CalcHash []byte
+
+	// Hash recorded in the mfg manifest, if one was found.
+	ManifestPath string
+	ManifestHash string
+
+	BootSize int
+	BootHash []byte
+
+	Images []*MfgImageInfo
+}
+
+func (ins *MfgInspection) HashOk() bool {
+	return bytes.Equal(ins.Meta.Hash, ins.CalcHash)
+}
+
+// Indicates whether every check passed.
+func (ins *MfgInspection) Ok() bool {
+	if !ins.HashOk() {
+		return false
+	}
+
+	if ins.ManifestHash != "" &&
+		ins.ManifestHash != fmt.Sprintf("%x", ins.CalcHash) {
+
+		return false
+	}
+
+	for _, img := range ins.Images {
+		if img.Present && (img.ParseErr != "" || !img.HashOk()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func FlashAreaNameFromId(id int) string {
+	for name, areaId := range flash.SYSTEM_AREA_NAME_ID_MAP {
+		if areaId == id {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("area-%d", id)
+}
+
+// Attempts to decode a meta region whose footer ends at the specified offset
+// of section 0.
+func parseMeta(section0 []byte, end int) (*MfgMeta, error) {
+	if end < META_FOOTER_SZ || end > len(section0) {
+		return nil, util.FmtNewtError("meta region end out of range: %d", end)
+	}
+
+	ftr := section0[end-META_FOOTER_SZ : end]
+	magic := binary.LittleEndian.Uint32(ftr[4:8])
+	if magic != META_MAGIC {
+		return nil, util.FmtNewtError("bad meta magic: 0x%08x", magic)
+	}
+
+	size := int(binary.LittleEndian.Uint16(ftr[0:2]))
+	if size < 4+META_FOOTER_SZ || size > end {
+		return nil, util.FmtNewtError("invalid meta region size: %d", size)
+	}
+
+	meta := &MfgMeta{
+		Offset:  end - size,
+		Size:    size,
+		Version: section0[end-size],
+	}
+	if meta.Version != META_VERSION {
+		return nil, util.FmtNewtError("unsupported meta version: %d",
+			meta.Version)
+	}
+
+	off := meta.Offset + 4
+	tlvEnd := end - META_FOOTER_SZ
+	for off < tlvEnd {
+		if off+2 > tlvEnd {
+			return nil, util.FmtNewtError("truncated TLV header at offset %d",
+				off)
+		}
+
+		typ := section0[off]
+		sz := int(section0[off+1])
+		data := section0[off+2:]
+		if off+2+sz > tlvEnd {
+			return nil, util.FmtNewtError(
+				"TLV at offset %d extends past meta footer", off)
+		}
+		data = data[:sz]
+
+		switch {
+		case typ == META_TLV_CODE_HASH && sz == META_TLV_HASH_SZ:
+			meta.Hash = append([]byte{}, data...)
+			meta.HashOffset = off + 2
+
+		case typ == META_TLV_CODE_FLASH_AREA && sz == META_TLV_FLASH_AREA_SZ:
+			id := int(data[0])
+			meta.FlashAreas = append(meta.FlashAreas, flash.FlashArea{
+				Name:   FlashAreaNameFromId(id),
+				Id:     id,
+				Device: int(data[1]),
+				Offset: int(binary.LittleEndian.Uint32(data[4:8])),
+				Size:   int(binary.LittleEndian.Uint32(data[8:12])),
+			})
+
+		default:
+			meta.OtherTlvs = append(meta.OtherTlvs, MetaTlv{
+				Type:   typ,
+				Offset: off,
+				Data:   append([]byte{}, data...),
+			})
+		}
+
+		off += 2 + sz
+	}
+
+	if meta.Hash == nil {
+		return nil, util.NewNewtError("meta region contains no hash TLV")
+	}
+
+	return meta, nil
+}
+
+func (meta *MfgMeta) findArea(id int) *flash.FlashArea {
+	for i, _ := range meta.FlashAreas {
+		if meta.FlashAreas[i].Id == id {
+			return &meta.FlashAreas[i]
+		}
+	}
+
+	return nil
+}
+
+// Locates the meta region in section 0.  The region is located at the end of
+// the boot loader flash area; because the area's location is not known in
+// advance, every occurrence of META_MAGIC is examined.  A candidate is only
+// accepted if its own boot loader flash area entry ends where the region
+// ends.
+func FindMeta(section0 []byte) (*MfgMeta, error) {
+	magic := make([]byte, 4)
+	binary.LittleEndian.PutUint32(magic, META_MAGIC)
+
+	var firstErr error
+	for i := 0; i+4 <= len(section0); i += 4 {
+		if !bytes.Equal(section0[i:i+4], magic) {
+			continue
+		}
+
+		meta, err := parseMeta(section0, i+4)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		boot := meta.findArea(
+			flash.SYSTEM_AREA_NAME_ID_MAP[flash.FLASH_AREA_NAME_BOOTLOADER])
+		if boot == nil || boot.Offset+boot.Size != i+4 {
+			continue
+		}
+
+		return meta, nil
+	}
+
+	if firstErr != nil {
+		return nil, util.FmtNewtError(
+			"no valid manufacturing meta region found: %s", firstErr.Error())
+	}
+
+	return nil, util.NewNewtError("no manufacturing meta region found " +
+		"(META_MAGIC not present)")
+}
+
+var sectionPathRe = regexp.MustCompile(`^(.*-s)([0-9]+)\.bin$`)
+
+// Finds the files containing the sections of the manufacturing image that
+// the specified section 0 file belongs to.
+func FindSectionPaths(section0Path string) (map[int]string, error) {
+	m := sectionPathRe.FindStringSubmatch(section0Path)
+	if m == nil {
+		return map[int]string{0: section0Path}, nil
+	}
+
+	if m[2] != "0" {
+		return nil, util.FmtNewtError(
+			"%s is not a section 0 file; the meta region is in section 0",
+			section0Path)
+	}
+
+	matches, err := filepath.Glob(m[1] + "*.bin")
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	paths := map[int]string{}
+	for _, match := range matches {
+		mm := sectionPathRe.FindStringSubmatch(match)
+		if mm == nil || mm[1] != m[1] {
+			continue
+		}
+
+		device, err := strconv.Atoi(mm[2])
+		if err == nil {
+			paths[device] = match
+		}
+	}
+
+	return paths, nil
+}
+
+func (info *MfgImageInfo) parse(data []byte, seed []byte) {
+	if len(data) < image.IMAGE_HEADER_SIZE {
+		info.ParseErr = "flash area smaller than an image header"
+		return
+	}
+
+	r := bytes.NewReader(data)
+	if err := binary.Read(r, binary.LittleEndian, &info.Header); err != nil {
+		info.ParseErr = err.Error()
+		return
+	}
+
+	if info.Header.Magic != image.IMAGE_MAGIC {
+		info.ParseErr = fmt.Sprintf("bad image magic: 0x%08x",
+			info.Header.Magic)
+		return
+	}
+
+	info.Bootable = info.Header.Flags&image.IMAGE_F_NON_BOOTABLE == 0
+
+	bodyEnd := int(info.Header.HdrSz) + int(info.Header.ImgSz)
+	info.TotalSize = bodyEnd + int(info.Header.TlvSz)
+	if info.TotalSize > len(data) {
+		info.ParseErr = fmt.Sprintf(
+			"image size (%d) exceeds flash area size (%d)",
+			info.TotalSize, len(data))
+		return
+	}
+
+	// Find the SHA256 TLV in the trailer.
+	off := bodyEnd
+	for off+4 <= info.TotalSize {
+		typ := data[off]
+		tlvLen := int(binary.LittleEndian.Uint16(data[off+2 : off+4]))
+		if off+4+tlvLen > info.TotalSize {
+			break
+		}
+		if typ == image.IMAGE_TLV_SHA256 {
+			info.Hash = append([]byte{}, data[off+4:off+4+tlvLen]...)
+		}
+		off += 4 + tlvLen
+	}
+
+	if info.Hash == nil {
+		info.ParseErr = "image trailer contains no SHA256 TLV"
+		return
+	}
+
+	hash := sha256.New()
+	if !info.Bootable && seed != nil {
+		hash.Write(seed)
+	}
+	hash.Write(data[:bodyEnd])
+	info.CalcHash = hash.Sum(nil)
+}
+
+func allErased(data []byte) bool {
+	for _, b := range data {
+		if b != 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+// Searches the directories containing the sections for an mfg manifest that
+// describes them.
+func (ins *MfgInspection) readManifest(section0Path string) {
+	dir := filepath.Dir(section0Path)
+	for i := 0; i < 3; i++ {
+		dir = filepath.Dir(dir)
+		path := dir + "/manifest.json"
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		man := mfgManifest{}
+		if err := json.Unmarshal(data, &man); err != nil {
+			continue
+		}
+
+		candidates := map[string]string{man.MfgHash: ""}
+		for _, unit := range man.Units {
+			candidates[unit.MfgHash] = unit.Id
+		}
+
+		ins.ManifestPath = path
+		calc := fmt.Sprintf("%x", ins.CalcHash)
+		if _, ok := candidates[calc]; ok {
+			ins.ManifestHash = calc
+		} else if len(man.Units) == 0 {
+			ins.ManifestHash = man.MfgHash
+		} else {
+			ins.ManifestHash = "(no matching unit)"
+		}
+		return
+	}
+}
+
+// Reads back a manufacturing image and verifies its contents.  The meta
+// region is decoded, the manufacturing hash is recalculated over all
+// sections, and the embedded boot loader and firmware images are parsed.
+func Inspect(section0Path string) (*MfgInspection, error) {
+	paths, err := FindSectionPaths(section0Path)
+	if err != nil {
+		return nil, err
+	}
+
+	ins := &MfgInspection{
+		SectionPaths: paths,
+		Sections:     map[int][]byte{},
+	}
+
+	for device, path := range paths {
+		ins.Sections[device], err = ioutil.ReadFile(path)
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+	}
+
+	section0 := ins.Sections[0]
+	ins.Meta, err = FindMeta(section0)
+	if err != nil {
+		return nil, util.FmtNewtError("%s: %s", section0Path, err.Error())
+	}
+
+	// Recalculate the hash with the hash field zeroed.
+	devices := make([]int, 0, len(ins.Sections))
+	for device, _ := range ins.Sections {
+		devices = append(devices, device)
+	}
+	sort.Ints(devices)
+
+	zeroed := append([]byte{}, section0...)
+	for i := 0; i < META_HASH_SZ; i++ {
+		zeroed[ins.Meta.HashOffset+i] = 0
+	}
+
+	sections := make([][]byte, len(devices))
+	for i, device := range devices {
+		if device == 0 {
+			sections[i] = zeroed
+		} else {
+			sections[i] = ins.Sections[device]
+		}
+	}
+	ins.CalcHash = calcMetaHash(sections)
+
+	// Boot loader: everything in the boot area preceding the meta region,
+	// excluding trailing unwritten flash.
+	boot := ins.Meta.findArea(
+		flash.SYSTEM_AREA_NAME_ID_MAP[flash.FLASH_AREA_NAME_BOOTLOADER])
+	bootData := bytes.TrimRight(section0[boot.Offset:ins.Meta.Offset],
+		"\xff")
+	ins.BootSize = len(bootData)
+	bootHash := sha256.Sum256(bootData)
+	ins.BootHash = bootHash[:]
+
+	var seed []byte
+	for _, name := range []string{
+		flash.FLASH_AREA_NAME_IMAGE_0,
+		flash.FLASH_AREA_NAME_IMAGE_1,
+	} {
+		area := ins.Meta.findArea(flash.SYSTEM_AREA_NAME_ID_MAP[name])
+		if area == nil {
+			continue
+		}
+
+		info := &MfgImageInfo{
+			Area: *area,
+		}
+		ins.Images = append(ins.Images, info)
+
+		section := ins.Sections[area.Device]
+		if area.Offset >= len(section) {
+			continue
+		}
+		end := util.IntMin(area.Offset+area.Size, len(section))
+		data := section[area.Offset:end]
+		if allErased(data) {
+			continue
+		}
+
+		info.Present = true
+		info.parse(data, seed)
+
+		// A split app's hash is seeded with its loader's hash.
+		seed = info.Hash
+	}
+
+	ins.readManifest(section0Path)
+
+	return ins, nil
+}
+
+// Produces a human-readable report of an inspection.
+func (ins *MfgInspection) Text() string {
+	buf := &bytes.Buffer{}
+
+	devices := []int{}
+	for device, _ := range ins.SectionPaths {
+		devices = append(devices, device)
+	}
+	sort.Ints(devices)
+
+	fmt.Fprintf(buf, "Sections:\n")
+	for _, device := range devices {
+		fmt.Fprintf(buf, "    s%d: %s (%d bytes)\n", device,
+			ins.SectionPaths[device], len(ins.Sections[device]))
+	}
+
+	meta := ins.Meta
+	fmt.Fprintf(buf, "\nMeta region: section 0, offset 0x%x, size %d, "+
+		"version %d\n", meta.Offset, meta.Size, meta.Version)
+	fmt.Fprintf(buf, "    Flash areas:\n")
+	for _, area := range meta.FlashAreas {
+		fmt.Fprintf(buf, "        %-26s id=%-3d device=%d offset=0x%08x "+
+			"size=%d\n", area.Name, area.Id, area.Device, area.Offset,
+			area.Size)
+	}
+	for _, tlv := range meta.OtherTlvs {
+		fmt.Fprintf(buf, "    TLV type 0x%02x (%d bytes): %x\n", tlv.Type,
+			len(tlv.Data), tlv.Data)
+	}
+
+	fmt.Fprintf(buf, "\nMfg hash:   %x\n", meta.Hash)
+	if ins.HashOk() {
+		fmt.Fprintf(buf, "Recomputed: %x (OK)\n", ins.CalcHash)
+	} else {
+		fmt.Fprintf(buf, "Recomputed: %x (MISMATCH)\n", ins.CalcHash)
+	}
+	if ins.ManifestPath != "" {
+		status := "OK"
+		if ins.ManifestHash != fmt.Sprintf("%x", ins.CalcHash) {
+			status = "MISMATCH; manifest has " + ins.ManifestHash
+		}
+		fmt.Fprintf(buf, "Manifest:   %s (%s)\n", ins.ManifestPath, status)
+	}
+
+	fmt.Fprintf(buf, "\nBoot loader: %d bytes, sha256 %x\n", ins.BootSize,
+		ins.BootHash)
+
+	for _, img := range ins.Images {
+		fmt.Fprintf(buf, "%s: ", img.Area.Name)
+		switch {
+		case !img.Present:
+			fmt.Fprintf(buf, "empty\n")
+
+		case img.ParseErr != "":
+			fmt.Fprintf(buf, "INVALID (%s)\n", img.ParseErr)
+
+		default:
+			flags := []string{}
+			if !img.Bootable {
+				flags = append(flags, "non-bootable")
+			}
+			if img.Header.Flags&(image.IMAGE_F_PKCS15_RSA2048_SHA256|
+				image.IMAGE_F_ECDSA224_SHA256|
+				image.IMAGE_F_ECDSA256_SHA256) != 0 {
+
+				flags = append(flags, "signed")
+			}
+			flagStr := ""
+			if len(flags) > 0 {
+				flagStr = " (" + strings.Join(flags, ", ") + ")"
+			}
+
+			fmt.Fprintf(buf, "version %s, %d bytes%s\n",
+				img.Header.Vers.String(), img.TotalSize, flagStr)
+
+			status := "OK"
+			if !img.HashOk() {
+				status = fmt.Sprintf("MISMATCH; computed %x", img.CalcHash)
+			}
+			fmt.Fprintf(buf, "    hash %x (%s)\n", img.Hash, status)
+		}
+	}
+
+	return buf.String()
+}
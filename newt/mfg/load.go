@@ -139,8 +139,19 @@ func (mi *MfgImage) detectInvalidDevices() error {
 		deviceMap[device] = struct{}{}
 	}
 
+	// Provisioned data may target devices that contain no other data.
+	for _, field := range mi.provFields {
+		sectionIds = append(sectionIds, field.device)
+	}
+
 	invalidIds := []int{}
+	seen := map[int]bool{}
 	for _, sectionId := range sectionIds {
+		if seen[sectionId] {
+			continue
+		}
+		seen[sectionId] = true
+
 		if _, ok := deviceMap[sectionId]; !ok {
 			invalidIds = append(invalidIds, sectionId)
 		}
@@ -163,7 +174,7 @@ func (mi *MfgImage) detectInvalidDevices() error {
 			"flash map: %s", listStr)
 }
 
-func (mi *MfgImage) detectOverlaps() error {
+func (mi *MfgImage) detectOverlaps(unitParts []mfgPart) error {
 	type overlap struct {
 		part0 mfgPart
 		part1 mfgPart
@@ -171,7 +182,7 @@ func (mi *MfgImage) detectOverlaps() error {
 
 	overlaps := []overlap{}
 
-	dpMap, err := mi.devicePartMap()
+	dpMap, err := mi.devicePartMap(unitParts)
 	if err != nil {
 		return err
 	}
@@ -269,6 +280,14 @@ func Load(basePkg *pkg.LocalPackage) (*MfgImage, error) {
 		}
 	}
 
+	if err := mi.loadProvision(v); err != nil {
+		return nil, err
+	}
+
+	if err := mi.loadMetaTlvs(v); err != nil {
+		return nil, err
+	}
+
 	proj := project.GetProject()
 
 	bspLpkg, err := proj.ResolvePackage(mi.basePkg.Repo(),
@@ -280,7 +299,7 @@ func Load(basePkg *pkg.LocalPackage) (*MfgImage, error) {
 	}
 	mi.bsp, err = pkg.NewBspPackage(bspLpkg)
 	if err != nil {
-		return nil, mi.loadError(err.Error())
+		return nil, mi.loadError("%s", err.Error())
 	}
 
 	for _, imgTarget := range mi.images {
@@ -50,7 +50,8 @@ import (
 // +-+-+-+-+-+--+-+-+-+-end of boot loader area+-+-+-+-+-+-+-+-+-+-+
 //
 // The number of TLVs is variable; two are shown above for illustrative
-// purposes.
+// purposes.  The flash area TLVs come first, followed by any custom TLVs
+// declared in mfg.yml, followed by the hash TLV.
 //
 // Fields:
 // <Header>
@@ -157,6 +158,16 @@ func writeFlashMapEntry(area flash.FlashArea, buf *bytes.Buffer) error {
 	return writeElem(tlv, buf)
 }
 
+// Writes a custom TLV declared in mfg.yml.
+func writeCustomTlv(tlv MfgMetaTlv, buf *bytes.Buffer) error {
+	if err := writeTlvHeader(tlv.typ, uint8(len(tlv.data)), buf); err != nil {
+		return err
+	}
+
+	buf.Write(tlv.data)
+	return nil
+}
+
 // Writes a zeroed-out hash TLV.  The hash's original value must be zero for
 // the actual hash to be calculated later.  After the actual value is
 // calculated, it replaces the zeros in the TLV.
@@ -171,9 +182,12 @@ func writeZeroHash(buf *bytes.Buffer) error {
 	return writeElem(tlv, buf)
 }
 
+// Builds the meta region and copies it into section 0.  If maxSize is
+// nonzero, it limits the size of the meta region.
+//
 // @return						meta-offset, hash-offset, error
-func insertMeta(section0Data []byte, flashMap flash.FlashMap) (
-	int, int, error) {
+func insertMeta(section0Data []byte, flashMap flash.FlashMap,
+	customTlvs []MfgMetaTlv, maxSize int) (int, int, error) {
 
 	buf := &bytes.Buffer{}
 
@@ -187,6 +201,12 @@ func insertMeta(section0Data []byte, flashMap flash.FlashMap) (
 		}
 	}
 
+	for _, tlv := range customTlvs {
+		if err := writeCustomTlv(tlv, buf); err != nil {
+			return 0, 0, err
+		}
+	}
+
 	if err := writeZeroHash(buf); err != nil {
 		return 0, 0, err
 	}
@@ -196,6 +216,16 @@ func insertMeta(section0Data []byte, flashMap flash.FlashMap) (
 		return 0, 0, err
 	}
 
+	if buf.Len() > 0xffff {
+		return 0, 0, util.FmtNewtError(
+			"Meta region too large; size=%d max=%d", buf.Len(), 0xffff)
+	}
+	if maxSize > 0 && buf.Len() > maxSize {
+		return 0, 0, util.FmtNewtError(
+			"Meta region exceeds its budget (mfg.meta.max_size); "+
+				"size=%d max=%d", buf.Len(), maxSize)
+	}
+
 	// The meta region gets placed at the very end of the boot loader slot.
 	bootArea, ok := flashMap.Areas[flash.FLASH_AREA_NAME_BOOTLOADER]
 	if !ok {
@@ -0,0 +1,289 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/viper"
+)
+
+// Custom meta TLVs carry factory data (e.g., board revision, product SKU,
+// boot loader public key hash) in the meta region.  They are declared in
+// mfg.yml:
+//
+//	mfg.meta:
+//	    max_size: 256       # Optional size budget for the meta region.
+//	    tlvs:
+//	        - type: 0x10
+//	          value: "C"
+//	          encoding: ascii
+//	        - type: 0x11
+//	          file: keys/boot-pub.der
+//	          hash: sha256
+//	        - type: 0x12
+//	          syscfg: BOARD_REVISION
+//	          encoding: u8
+//
+// Each TLV takes its data from exactly one of: a literal value, a file, or a
+// syscfg setting of the boot loader target.  Literal and syscfg values are
+// converted according to the same encodings as provisioning fields.
+
+// TLV types that cannot be used by custom TLVs.
+var metaReservedTlvTypes = map[int]string{
+	META_TLV_CODE_HASH:       "hash",
+	META_TLV_CODE_FLASH_AREA: "flash area",
+	0xff:                     "unwritten flash",
+}
+
+// The maximum amount of data in a single TLV; limited by the size field.
+const META_TLV_MAX_DATA_SZ = 0xff
+
+type MfgMetaTlv struct {
+	typ uint8
+
+	// Encoding of literal and syscfg values.
+	field MfgProvisionField
+
+	value  string
+	file   string
+	syscfg string
+	hash   bool
+
+	// Populated by resolveMetaTlvs().
+	data []byte
+}
+
+func (tlv *MfgMetaTlv) String() string {
+	switch {
+	case tlv.file != "":
+		return fmt.Sprintf("meta TLV 0x%02x (file %s)", tlv.typ, tlv.file)
+	case tlv.syscfg != "":
+		return fmt.Sprintf("meta TLV 0x%02x (syscfg %s)", tlv.typ, tlv.syscfg)
+	default:
+		return fmt.Sprintf("meta TLV 0x%02x", tlv.typ)
+	}
+}
+
+func (mi *MfgImage) loadMetaTlv(
+	tlvIdx int, entry map[string]string) (MfgMetaTlv, error) {
+
+	tlv := MfgMetaTlv{}
+
+	typStr := entry["type"]
+	if typStr == "" {
+		return tlv, mi.loadError(
+			"meta TLV %d missing required \"type\" field", tlvIdx)
+	}
+
+	typ, err := util.AtoiNoOct(typStr)
+	if err != nil || typ < 0 || typ > 0xff {
+		return tlv, mi.loadError("meta TLV %d contains invalid type: %s",
+			tlvIdx, typStr)
+	}
+	if name, ok := metaReservedTlvTypes[typ]; ok {
+		return tlv, mi.loadError(
+			"meta TLV %d uses reserved type 0x%02x (%s)", tlvIdx, typ, name)
+	}
+	tlv.typ = uint8(typ)
+
+	tlv.value = entry["value"]
+	tlv.file = entry["file"]
+	tlv.syscfg = entry["syscfg"]
+
+	numSrcs := 0
+	for _, src := range []string{tlv.value, tlv.file, tlv.syscfg} {
+		if src != "" {
+			numSrcs++
+		}
+	}
+	if numSrcs != 1 {
+		return tlv, mi.loadError(
+			"meta TLV 0x%02x must specify exactly one of \"value\", "+
+				"\"file\", or \"syscfg\"", typ)
+	}
+
+	if tlv.file != "" && !strings.HasPrefix(tlv.file, "/") {
+		tlv.file = mi.basePkg.BasePath() + "/" + tlv.file
+	}
+
+	switch strings.ToLower(entry["hash"]) {
+	case "":
+	case "sha256":
+		tlv.hash = true
+	default:
+		return tlv, mi.loadError(
+			"meta TLV 0x%02x specifies unsupported hash \"%s\"; must be "+
+				"sha256", typ, entry["hash"])
+	}
+
+	// Reuse the provisioning field parser for the encoding settings.
+	fieldEntry := map[string]string{
+		"name":     fmt.Sprintf("meta TLV 0x%02x", typ),
+		"device":   "0",
+		"offset":   "0",
+		"encoding": entry["encoding"],
+		"size":     entry["size"],
+		"pad":      entry["pad"],
+	}
+	tlv.field, err = mi.loadProvisionField(tlvIdx, fieldEntry)
+	if err != nil {
+		return tlv, err
+	}
+	if tlv.field.encoding == PROV_ENC_FILE {
+		return tlv, mi.loadError(
+			"meta TLV 0x%02x: use the \"file\" field instead of the "+
+				"\"file\" encoding", typ)
+	}
+
+	return tlv, nil
+}
+
+// Reads the custom meta TLV declarations from mfg.yml, if present.
+func (mi *MfgImage) loadMetaTlvs(v *viper.Viper) error {
+	meta := cast.ToStringMap(v.Get("mfg.meta"))
+	if len(meta) == 0 {
+		return nil
+	}
+
+	if sizeStr := cast.ToString(meta["max_size"]); sizeStr != "" {
+		size, err := util.AtoiNoOct(sizeStr)
+		if err != nil || size <= 0 {
+			return mi.loadError("invalid mfg.meta.max_size: %s", sizeStr)
+		}
+		mi.metaMaxSize = size
+	}
+
+	types := map[uint8]bool{}
+	for i, itf := range cast.ToSlice(meta["tlvs"]) {
+		tlv, err := mi.loadMetaTlv(i, cast.ToStringMapString(itf))
+		if err != nil {
+			return err
+		}
+
+		if types[tlv.typ] {
+			return mi.loadError("duplicate meta TLV type 0x%02x", tlv.typ)
+		}
+		types[tlv.typ] = true
+
+		mi.metaTlvs = append(mi.metaTlvs, tlv)
+	}
+
+	return nil
+}
+
+// Retrieves the value of a syscfg setting of the boot loader target.
+func (mi *MfgImage) bootSyscfgValue(name string) (string, error) {
+	if mi.bootCfg == nil {
+		b, err := builder.NewTargetBuilder(mi.boot)
+		if err != nil {
+			return "", err
+		}
+
+		res, err := b.Resolve()
+		if err != nil {
+			return "", err
+		}
+
+		mi.bootCfg = res.Cfg.Settings
+	}
+
+	entry, ok := mi.bootCfg[name]
+	if !ok {
+		return "", util.FmtNewtError(
+			"boot loader target %s does not define syscfg setting %s",
+			mi.boot.Name(), name)
+	}
+
+	// String settings are quoted for the C preprocessor.
+	val := entry.Value
+	if len(val) >= 2 && strings.HasPrefix(val, "\"") &&
+		strings.HasSuffix(val, "\"") {
+
+		val = val[1 : len(val)-1]
+	}
+
+	return val, nil
+}
+
+// Determines the data of each custom meta TLV.
+func (mi *MfgImage) resolveMetaTlvs() error {
+	for i, _ := range mi.metaTlvs {
+		tlv := &mi.metaTlvs[i]
+
+		var data []byte
+		var err error
+
+		switch {
+		case tlv.file != "":
+			data, err = ioutil.ReadFile(tlv.file)
+			if err != nil {
+				err = util.ChildNewtError(err)
+			}
+
+		case tlv.syscfg != "":
+			var val string
+			val, err = mi.bootSyscfgValue(tlv.syscfg)
+			if err == nil {
+				data, err = encodeProvisionValue(tlv.field, val)
+			}
+
+		default:
+			data, err = encodeProvisionValue(tlv.field, tlv.value)
+		}
+		if err != nil {
+			return util.FmtNewtError("%s: %s", tlv.String(), err.Error())
+		}
+
+		if tlv.hash {
+			sum := sha256.Sum256(data)
+			data = sum[:]
+		}
+
+		if len(data) > META_TLV_MAX_DATA_SZ {
+			return util.FmtNewtError(
+				"%s is too large; size=%d max=%d", tlv.String(), len(data),
+				META_TLV_MAX_DATA_SZ)
+		}
+
+		tlv.data = data
+	}
+
+	return nil
+}
+
+// Files that custom meta TLVs read their data from.
+func (mi *MfgImage) metaTlvPaths() []string {
+	paths := []string{}
+	for _, tlv := range mi.metaTlvs {
+		if tlv.file != "" {
+			paths = append(paths, tlv.file)
+		}
+	}
+
+	return paths
+}
@@ -24,6 +24,7 @@ import (
 
 	"mynewt.apache.org/newt/newt/image"
 	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/syscfg"
 	"mynewt.apache.org/newt/newt/target"
 )
 
@@ -52,7 +53,23 @@ type MfgImage struct {
 	images     []*target.Target
 	rawEntries []MfgRawEntry
 
+	// Per-unit provisioning data.
+	provFields  []MfgProvisionField
+	provIdField string
+	recordsPath string
+	records     []MfgUnitRecord
+
 	version image.ImageVersion
+
+	// Output format; raw sections are always written.
+	format string
+
+	// Custom TLVs to include in the meta region.
+	metaTlvs    []MfgMetaTlv
+	metaMaxSize int
+
+	// Syscfg of the boot loader target; resolved on demand.
+	bootCfg map[string]syscfg.CfgEntry
 }
 
 func (mi *MfgImage) SetVersion(ver image.ImageVersion) {
@@ -78,6 +78,35 @@ func MfgSectionBinPath(mfgPkgName string, sectionNum int) string {
 		filepath.Base(mfgPkgName), sectionNum)
 }
 
+// Path of the file containing every section in an address-bearing format.
+func MfgCombinedPath(mfgPkgName string, ext string) string {
+	return fmt.Sprintf("%s/%s.%s", MfgSectionBinDir(mfgPkgName),
+		filepath.Base(mfgPkgName), ext)
+}
+
+func MfgUnitsDir(mfgPkgName string) string {
+	return MfgBinDir(mfgPkgName) + "/units"
+}
+
+func MfgUnitSectionBinDir(mfgPkgName string, unitId string) string {
+	return MfgUnitsDir(mfgPkgName) + "/" + unitId
+}
+
+func MfgUnitSectionBinPath(mfgPkgName string, unitId string,
+	sectionNum int) string {
+
+	return fmt.Sprintf("%s/%s-s%d.bin",
+		MfgUnitSectionBinDir(mfgPkgName, unitId), filepath.Base(mfgPkgName),
+		sectionNum)
+}
+
+func MfgUnitCombinedPath(mfgPkgName string, unitId string,
+	ext string) string {
+
+	return fmt.Sprintf("%s/%s.%s", MfgUnitSectionBinDir(mfgPkgName, unitId),
+		filepath.Base(mfgPkgName), ext)
+}
+
 func MfgManifestPath(mfgPkgName string) string {
 	return MfgBinDir(mfgPkgName) + "/manifest.json"
 }
@@ -165,3 +194,24 @@ func (mi *MfgImage) SectionBinPaths() []string {
 	}
 	return paths
 }
+
+// Returns the paths of the sections generated for each provisioned unit.
+func (mi *MfgImage) UnitSectionBinPaths() []string {
+	sectionIds := mi.sectionIds()
+	for _, field := range mi.provFields {
+		sectionIds = append(sectionIds, field.device)
+	}
+
+	paths := []string{}
+	for _, rec := range mi.records {
+		seen := map[int]bool{}
+		for _, sectionId := range sectionIds {
+			if !seen[sectionId] {
+				seen[sectionId] = true
+				paths = append(paths, MfgUnitSectionBinPath(
+					mi.basePkg.Name(), rec.Id, sectionId))
+			}
+		}
+	}
+	return paths
+}
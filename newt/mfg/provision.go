@@ -0,0 +1,462 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mfg
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/viper"
+)
+
+// Per-device provisioning allows each manufactured unit to receive unique
+// data (serial numbers, MAC addresses, calibration blobs, certificates,
+// etc.).  The mfg.yml file describes where each field goes:
+//
+//	mfg.provision:
+//	    id_field: serial
+//	    fields:
+//	        - name: serial
+//	          device: 0
+//	          offset: 0x7c000
+//	          encoding: ascii
+//	          size: 16
+//	          pad: 0x00
+//	        - name: mac
+//	          device: 0
+//	          offset: 0x7c010
+//	          encoding: hex
+//
+// A records file (CSV with a header row, or a JSON array of objects) supplies
+// one record per unit.  Each record must contain a value for every field.
+// A separate set of sections is generated for each unit.
+
+// Supported field encodings.
+const (
+	PROV_ENC_ASCII  = "ascii"
+	PROV_ENC_HEX    = "hex"
+	PROV_ENC_BASE64 = "base64"
+	PROV_ENC_FILE   = "file"
+	PROV_ENC_U8     = "u8"
+	PROV_ENC_U16LE  = "u16le"
+	PROV_ENC_U16BE  = "u16be"
+	PROV_ENC_U32LE  = "u32le"
+	PROV_ENC_U32BE  = "u32be"
+	PROV_ENC_U64LE  = "u64le"
+	PROV_ENC_U64BE  = "u64be"
+)
+
+type MfgProvisionField struct {
+	name     string
+	device   int
+	offset   int
+	encoding string
+
+	// If nonzero, the encoded value is padded to this many bytes.
+	size int
+	pad  byte
+}
+
+// The data for a single manufactured unit.
+type MfgUnitRecord struct {
+	Id     string
+	values map[string]string
+}
+
+var provUnitIdRe = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// Converts a unit ID into the form used to name the unit's output directory.
+// Characters other than letters, digits, '_', '.', and '-' are replaced with
+// '_'.  IDs consisting only of dots are rejected; they would refer to other
+// directories.
+func CleanUnitId(id string) (string, error) {
+	clean := provUnitIdRe.ReplaceAllString(id, "_")
+	if strings.Trim(clean, ".") == "" {
+		return "", util.FmtNewtError("invalid unit ID: \"%s\"", id)
+	}
+
+	return clean, nil
+}
+
+func provIntSize(encoding string) int {
+	switch encoding {
+	case PROV_ENC_U8:
+		return 1
+	case PROV_ENC_U16LE, PROV_ENC_U16BE:
+		return 2
+	case PROV_ENC_U32LE, PROV_ENC_U32BE:
+		return 4
+	case PROV_ENC_U64LE, PROV_ENC_U64BE:
+		return 8
+	default:
+		return 0
+	}
+}
+
+func (mi *MfgImage) loadProvisionField(
+	fieldIdx int, entry map[string]string) (MfgProvisionField, error) {
+
+	field := MfgProvisionField{
+		name:     entry["name"],
+		encoding: strings.ToLower(entry["encoding"]),
+		pad:      0xff,
+	}
+
+	if field.name == "" {
+		return field, mi.loadError(
+			"provisioning field %d missing required \"name\" field", fieldIdx)
+	}
+
+	for _, key := range []string{"device", "offset"} {
+		if entry[key] == "" {
+			return field, mi.loadError(
+				"provisioning field \"%s\" missing required \"%s\" field",
+				field.name, key)
+		}
+	}
+
+	var err error
+
+	field.device, err = util.AtoiNoOct(entry["device"])
+	if err != nil {
+		return field, mi.loadError(
+			"provisioning field \"%s\" contains invalid device: %s",
+			field.name, entry["device"])
+	}
+
+	field.offset, err = util.AtoiNoOct(entry["offset"])
+	if err != nil {
+		return field, mi.loadError(
+			"provisioning field \"%s\" contains invalid offset: %s",
+			field.name, entry["offset"])
+	}
+
+	if field.encoding == "" {
+		field.encoding = PROV_ENC_ASCII
+	}
+	switch field.encoding {
+	case PROV_ENC_ASCII, PROV_ENC_HEX, PROV_ENC_BASE64, PROV_ENC_FILE:
+	default:
+		if provIntSize(field.encoding) == 0 {
+			return field, mi.loadError(
+				"provisioning field \"%s\" has unknown encoding \"%s\"",
+				field.name, field.encoding)
+		}
+	}
+
+	if entry["size"] != "" {
+		field.size, err = util.AtoiNoOct(entry["size"])
+		if err != nil || field.size <= 0 {
+			return field, mi.loadError(
+				"provisioning field \"%s\" contains invalid size: %s",
+				field.name, entry["size"])
+		}
+	}
+
+	if entry["pad"] != "" {
+		pad, err := util.AtoiNoOct(entry["pad"])
+		if err != nil || pad < 0 || pad > 0xff {
+			return field, mi.loadError(
+				"provisioning field \"%s\" contains invalid pad byte: %s",
+				field.name, entry["pad"])
+		}
+		field.pad = byte(pad)
+	}
+
+	return field, nil
+}
+
+// Reads the provisioning template from mfg.yml, if present.
+func (mi *MfgImage) loadProvision(v *viper.Viper) error {
+	prov := cast.ToStringMap(v.Get("mfg.provision"))
+	if len(prov) == 0 {
+		return nil
+	}
+
+	names := map[string]bool{}
+	for i, itf := range cast.ToSlice(prov["fields"]) {
+		field, err := mi.loadProvisionField(i, cast.ToStringMapString(itf))
+		if err != nil {
+			return err
+		}
+		if names[field.name] {
+			return mi.loadError("duplicate provisioning field \"%s\"",
+				field.name)
+		}
+		names[field.name] = true
+
+		mi.provFields = append(mi.provFields, field)
+	}
+
+	if len(mi.provFields) == 0 {
+		return mi.loadError("mfg.provision contains no fields")
+	}
+
+	mi.provIdField = cast.ToString(prov["id_field"])
+	if mi.provIdField == "" {
+		mi.provIdField = mi.provFields[0].name
+	}
+
+	mi.recordsPath = cast.ToString(prov["records"])
+	if mi.recordsPath != "" && !strings.HasPrefix(mi.recordsPath, "/") {
+		mi.recordsPath = mi.basePkg.BasePath() + "/" + mi.recordsPath
+	}
+
+	return nil
+}
+
+func readCsvRecords(path string) ([]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, util.FmtNewtError("error parsing %s: %s", path,
+			err.Error())
+	}
+	if len(rows) == 0 {
+		return nil, util.FmtNewtError("%s is empty; expected a header row",
+			path)
+	}
+
+	header := rows[0]
+	records := []map[string]string{}
+	for _, row := range rows[1:] {
+		rec := map[string]string{}
+		for i, col := range header {
+			if i < len(row) {
+				rec[strings.TrimSpace(col)] = strings.TrimSpace(row[i])
+			}
+		}
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+func readJsonRecords(path string) ([]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+
+	objs := []map[string]interface{}{}
+	if err := dec.Decode(&objs); err != nil {
+		return nil, util.FmtNewtError(
+			"error parsing %s; expected an array of objects: %s", path,
+			err.Error())
+	}
+
+	records := make([]map[string]string, len(objs))
+	for i, obj := range objs {
+		records[i] = map[string]string{}
+		for k, val := range obj {
+			records[i][k] = cast.ToString(val)
+		}
+	}
+
+	return records, nil
+}
+
+// Reads per-unit provisioning records from a CSV or JSON file.  A records
+// file specified here overrides the one named in mfg.yml.
+func (mi *MfgImage) LoadRecords(path string) error {
+	if path == "" {
+		path = mi.recordsPath
+	}
+	if path == "" {
+		return nil
+	}
+
+	if len(mi.provFields) == 0 {
+		return util.FmtNewtError(
+			"mfg package %s does not define any provisioning fields "+
+				"(mfg.provision)", mi.basePkg.Name())
+	}
+
+	var raws []map[string]string
+	var err error
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		raws, err = readJsonRecords(path)
+	} else {
+		raws, err = readCsvRecords(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(raws) == 0 {
+		return util.FmtNewtError("%s contains no records", path)
+	}
+
+	ids := map[string]int{}
+	mi.records = make([]MfgUnitRecord, len(raws))
+	for i, raw := range raws {
+		rec := MfgUnitRecord{
+			values: map[string]string{},
+		}
+
+		for _, field := range mi.provFields {
+			val, ok := raw[field.name]
+			if !ok || val == "" {
+				return util.FmtNewtError(
+					"record %d in %s is missing field \"%s\"",
+					i+1, path, field.name)
+			}
+
+			// File paths are relative to the records file.
+			if field.encoding == PROV_ENC_FILE &&
+				!strings.HasPrefix(val, "/") {
+
+				val = filepath.Dir(path) + "/" + val
+			}
+
+			rec.values[field.name] = val
+		}
+
+		if raw[mi.provIdField] == "" {
+			rec.Id = fmt.Sprintf("unit-%d", i+1)
+		} else {
+			rec.Id, err = CleanUnitId(raw[mi.provIdField])
+			if err != nil {
+				return util.FmtNewtError("record %d in %s: %s", i+1, path,
+					err.Error())
+			}
+		}
+		if prev, ok := ids[rec.Id]; ok {
+			return util.FmtNewtError(
+				"records %d and %d in %s have the same ID: %s",
+				prev+1, i+1, path, rec.Id)
+		}
+		ids[rec.Id] = i
+
+		mi.records[i] = rec
+	}
+
+	mi.recordsPath = path
+
+	return nil
+}
+
+func (mi *MfgImage) Records() []MfgUnitRecord {
+	return mi.records
+}
+
+func encodeProvisionValue(field MfgProvisionField,
+	val string) ([]byte, error) {
+
+	var data []byte
+	var err error
+
+	switch field.encoding {
+	case PROV_ENC_ASCII:
+		data = []byte(val)
+
+	case PROV_ENC_HEX:
+		// Allow common separators, e.g., "00:11:22:33:44:55".
+		stripped := strings.NewReplacer(":", "", "-", "", " ", "").Replace(
+			strings.TrimPrefix(strings.ToLower(val), "0x"))
+		data, err = hex.DecodeString(stripped)
+
+	case PROV_ENC_BASE64:
+		data, err = base64.StdEncoding.DecodeString(val)
+
+	case PROV_ENC_FILE:
+		data, err = ioutil.ReadFile(val)
+
+	default:
+		size := provIntSize(field.encoding)
+
+		var num uint64
+		num, err = strconv.ParseUint(val, 0, size*8)
+		if err != nil {
+			break
+		}
+
+		data = make([]byte, 8)
+		if strings.HasSuffix(field.encoding, "be") {
+			binary.BigEndian.PutUint64(data, num)
+			data = data[8-size:]
+		} else {
+			binary.LittleEndian.PutUint64(data, num)
+			data = data[:size]
+		}
+	}
+
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"invalid %s value for field \"%s\": %s", field.encoding,
+			field.name, err.Error())
+	}
+
+	if field.size != 0 {
+		if len(data) > field.size {
+			return nil, util.FmtNewtError(
+				"value for field \"%s\" is too large; size=%d max=%d",
+				field.name, len(data), field.size)
+		}
+		for len(data) < field.size {
+			data = append(data, field.pad)
+		}
+	}
+
+	return data, nil
+}
+
+// Converts a unit's provisioning record into image parts.
+func (mi *MfgImage) unitParts(rec MfgUnitRecord) ([]mfgPart, error) {
+	parts := make([]mfgPart, len(mi.provFields))
+	for i, field := range mi.provFields {
+		data, err := encodeProvisionValue(field, rec.values[field.name])
+		if err != nil {
+			return nil, util.FmtNewtError("unit %s: %s", rec.Id,
+				err.Error())
+		}
+
+		parts[i] = mfgPart{
+			device: field.device,
+			offset: field.offset,
+			data:   data,
+			name:   fmt.Sprintf("%s (unit %s)", field.name, rec.Id),
+		}
+	}
+
+	return parts, nil
+}
@@ -20,21 +20,120 @@
 package mfg
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 
 	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/flasher"
+	"mynewt.apache.org/newt/util"
 )
 
-// @return						mfg-image-path, error
-func (mi *MfgImage) Upload() (string, error) {
-	// For now, we always upload section 0 only.
-	section0Path := MfgSectionBinPath(mi.basePkg.Name(), 0)
-	baseName := strings.TrimSuffix(section0Path, ".bin")
+// Retrieves the flash devices that have sections in the manufacturing image.
+// If unitId is not empty, the devices for that provisioned unit are
+// returned.
+func (mi *MfgImage) loadDevices(unitId string) []int {
+	devices := mi.sectionIds()
+	if unitId == "" {
+		return devices
+	}
+
+	seen := map[int]bool{}
+	for _, device := range devices {
+		seen[device] = true
+	}
+	for _, field := range mi.provFields {
+		if !seen[field.device] {
+			seen[field.device] = true
+			devices = append(devices, field.device)
+		}
+	}
+	sort.Ints(devices)
+
+	return devices
+}
+
+// Uploads every section of the manufacturing image, one flash device at a
+// time, using the BSP's flasher.  Each section is written to its device's
+// base address.  If the BSP uses a download script, the script is invoked
+// once per section with the following environment settings:
+//
+//	MFG_IMAGE=1
+//	MFG_DEVICE=<flash device id>
+//	MFG_DEVICE_BASE=<base address of device>
+//	FLASH_OFFSET=0x0
+//	FLASH_ADDRESS=<base address of device>
+//
+// If unitId is not empty, the sections of the specified provisioned unit are
+// uploaded instead of the common image.
+//
+// @return						[uploaded-section-paths], error
+func (mi *MfgImage) Upload(unitId string) ([]string, error) {
+	devices := mi.loadDevices(unitId)
+
+	f, err := builder.NewFlasher(mi.bsp, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify everything can be loaded before loading anything.
+	unsupported := []string{}
+	for _, device := range devices {
+		if !f.SupportsDevice(device) {
+			unsupported = append(unsupported, fmt.Sprintf("%d", device))
+		}
+	}
+	if len(unsupported) > 0 {
+		return nil, util.FmtNewtError(
+			"The %s flasher of BSP %s does not support flash "+
+				"device(s) %s; the manufacturing image contains data for "+
+				"these devices.  Devices supported by the download script "+
+				"are listed in the BSP's bsp.download_devices setting; "+
+				"other flashers require the device's base address in "+
+				"bsp.flash_map.devices.",
+			f.Name(), mi.bsp.Name(), strings.Join(unsupported, ", "))
+	}
+
+	paths := make([]string, len(devices))
+	for i, device := range devices {
+		if unitId == "" {
+			paths[i] = MfgSectionBinPath(mi.basePkg.Name(), device)
+		} else {
+			paths[i] = MfgUnitSectionBinPath(mi.basePkg.Name(), unitId,
+				device)
+		}
+		if util.NodeNotExist(paths[i]) {
+			return nil, util.FmtNewtError(
+				"Section file %s does not exist; run \"newt mfg create\" "+
+					"first", paths[i])
+		}
+	}
+
+	for i, device := range devices {
+		base := mi.bsp.FlashMap.Device(device).Base
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Loading section %d (%s) at 0x%x\n", device, paths[i], base)
+
+		args := flasher.LoadArgs{
+			ImagePath:   paths[i],
+			BinBaseName: strings.TrimSuffix(paths[i], ".bin"),
+			Device:      device,
+			Offset:      0,
+			Address:     base,
+			Slot:        -1,
+			Env: map[string]string{
+				"MFG_IMAGE":       "1",
+				"MFG_DEVICE":      fmt.Sprintf("%d", device),
+				"MFG_DEVICE_BASE": fmt.Sprintf("0x%x", base),
+			},
+		}
 
-	envSettings := map[string]string{"MFG_IMAGE": "1"}
-	if err := builder.Load(baseName, mi.bsp, envSettings); err != nil {
-		return "", err
+		if err := flasher.Load(f, args); err != nil {
+			return nil, util.FmtNewtError(
+				"Failed to load section %d: %s", device, err.Error())
+		}
 	}
 
-	return section0Path, nil
+	return paths, nil
 }
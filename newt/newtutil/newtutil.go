@@ -21,6 +21,7 @@ package newtutil
 
 import (
 	"fmt"
+	"os"
 	"os/user"
 	"sort"
 	"strconv"
@@ -42,6 +43,7 @@ var NewtForce bool
 
 const NEWTRC_DIR string = ".newt"
 const REPOS_FILENAME string = "repos.yml"
+const NEWTRC_FILENAME string = "newtrc.yml"
 
 const CORE_REPO_NAME string = "apache-mynewt-core"
 const ARDUINO_ZERO_REPO_NAME string = "mynewt_arduino_zero"
@@ -115,7 +117,23 @@ func readNewtrc() *viper.Viper {
 	v, err := util.ReadConfig(dir, strings.TrimSuffix(REPOS_FILENAME, ".yml"))
 	if err != nil {
 		log.Debugf("Failed to read %s/%s file", dir, REPOS_FILENAME)
-		return viper.New()
+		v = viper.New()
+		v.SetConfigType("yaml")
+	}
+
+	// General settings (e.g., mirrors) can also be specified in newtrc.yml.
+	path := dir + "/" + NEWTRC_FILENAME
+	if util.NodeExist(path) {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Warnf("Failed to open %s: %s", path, err.Error())
+			return v
+		}
+		defer file.Close()
+
+		if err := v.MergeConfig(file); err != nil {
+			log.Warnf("Failed to read %s: %s", path, err.Error())
+		}
 	}
 
 	return v
@@ -130,11 +148,16 @@ func Newtrc() *viper.Viper {
 	return newtrc
 }
 
-func GetSliceFeatures(v *viper.Viper, features map[string]bool,
-	key string) []interface{} {
+// @return []interface{}        The values read from the base key and from
+//                                  each enabled feature-specific key.
+//         []string             The feature that enabled each value; "" for
+//                                  the base key.
+func getSliceFeaturesSrc(v *viper.Viper, features map[string]bool,
+	key string) ([]interface{}, []string) {
 
 	val := v.Get(key)
 	vals := []interface{}{val}
+	srcs := []string{""}
 
 	// Process the features in alphabetical order to ensure consistent
 	// results across repeated runs.
@@ -147,32 +170,52 @@ func GetSliceFeatures(v *viper.Viper, features map[string]bool,
 	for _, feature := range featureKeys {
 		overwriteVal := v.Get(key + "." + feature + ".OVERWRITE")
 		if overwriteVal != nil {
-			return []interface{}{overwriteVal}
+			return []interface{}{overwriteVal}, []string{feature}
 		}
 
 		appendVal := v.Get(key + "." + feature)
 		if appendVal != nil {
 			vals = append(vals, appendVal)
+			srcs = append(srcs, feature)
 		}
 	}
 
+	return vals, srcs
+}
+
+func GetSliceFeatures(v *viper.Viper, features map[string]bool,
+	key string) []interface{} {
+
+	vals, _ := getSliceFeaturesSrc(v, features, key)
 	return vals
 }
 
 func GetStringMapFeatures(v *viper.Viper, features map[string]bool,
 	key string) map[string]interface{} {
 
+	result, _ := GetStringMapFeaturesSrc(v, features, key)
+	return result
+}
+
+// Like GetStringMapFeatures, but also indicates which feature enabled each
+// entry in the resulting map.  Entries read from the unconditional block map
+// to "".
+func GetStringMapFeaturesSrc(v *viper.Viper, features map[string]bool,
+	key string) (map[string]interface{}, map[string]string) {
+
 	result := map[string]interface{}{}
+	srcMap := map[string]string{}
 
-	slice := GetSliceFeatures(v, features, key)
-	for _, itf := range slice {
+	slice, srcs := getSliceFeaturesSrc(v, features, key)
+	for i, itf := range slice {
 		sub := cast.ToStringMap(itf)
 		for k, v := range sub {
 			result[k] = v
+			srcMap[k] = srcs[i]
 		}
 	}
 
-	return result
+	return result, srcMap
 }
 
 func GetStringFeatures(v *viper.Viper, features map[string]bool,
@@ -239,6 +282,27 @@ func GetStringSliceFeatures(v *viper.Viper, features map[string]bool,
 	return strVals
 }
 
+// Like GetStringSliceFeatures, but also indicates which feature enabled each
+// element in the resulting slice.  Elements read from the unconditional block
+// correspond to "".
+func GetStringSliceFeaturesSrc(v *viper.Viper, features map[string]bool,
+	key string) ([]string, []string) {
+
+	vals, srcs := getSliceFeaturesSrc(v, features, key)
+
+	strVals := []string{}
+	strSrcs := []string{}
+	for i, v := range vals {
+		subVals := cast.ToStringSlice(v)
+		for _, subVal := range subVals {
+			strVals = append(strVals, subVal)
+			strSrcs = append(strSrcs, srcs[i])
+		}
+	}
+
+	return strVals, strSrcs
+}
+
 // Parses a string of the following form:
 //     [@repo]<path/to/package>
 //
@@ -42,6 +42,14 @@ type BspPackage struct {
 	DebugScript        string
 	FlashMap           flash.FlashMap
 	BspV               *viper.Viper
+
+	// Flash devices that the download script is able to program.
+	DownloadDevices []int
+
+	// Flashing backend (bsp.flasher) and per-backend settings
+	// (bsp.flasher_settings.<backend>).
+	Flasher         string
+	FlasherSettings map[string]interface{}
 }
 
 func (bsp *BspPackage) resolvePathSetting(
@@ -145,6 +153,26 @@ func (bsp *BspPackage) Reload(features map[string]bool) error {
 		return err
 	}
 
+	// By default, the download script only supports the first flash device.
+	bsp.DownloadDevices = []int{0}
+	devStrs := newtutil.GetStringSliceFeatures(bsp.BspV, features,
+		"bsp.download_devices")
+	if len(devStrs) > 0 {
+		bsp.DownloadDevices = make([]int, len(devStrs))
+		for i, devStr := range devStrs {
+			bsp.DownloadDevices[i], err = util.AtoiNoOct(devStr)
+			if err != nil {
+				return util.FmtNewtError(
+					"BSP specifies invalid download device: %s", devStr)
+			}
+		}
+	}
+
+	bsp.Flasher = newtutil.GetStringFeatures(bsp.BspV, features,
+		"bsp.flasher")
+	bsp.FlasherSettings = newtutil.GetStringMapFeatures(bsp.BspV, features,
+		"bsp.flasher_settings")
+
 	if bsp.CompilerName == "" {
 		return util.NewNewtError("BSP does not specify a compiler " +
 			"(bsp.compiler)")
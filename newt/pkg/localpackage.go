@@ -31,6 +31,7 @@ import (
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cast"
 
 	"mynewt.apache.org/newt/newt/interfaces"
 	"mynewt.apache.org/newt/newt/newtutil"
@@ -52,6 +53,14 @@ var LocalPackageSpecialNames = map[string]bool{
 	"bin":     true,
 }
 
+// Ordering constraints for an init or down function.  Each element names
+// either another function of the same kind or a package; a package refers to
+// all of its functions of that kind.
+type InitRelations struct {
+	After  []string
+	Before []string
+}
+
 type LocalPackage struct {
 	repo        *repo.Repo
 	name        string
@@ -65,6 +74,16 @@ type LocalPackage struct {
 	// sysinit C file.
 	init map[string]int
 
+	// Ordering constraints for init functions, keyed by function name.
+	initRelations map[string]InitRelations
+
+	// Package shutdown function names and stages.  These are used to
+	// generate the sysdown C file.
+	down map[string]int
+
+	// Ordering constraints for down functions, keyed by function name.
+	downRelations map[string]InitRelations
+
 	// Extra package-specific settings that don't come from syscfg.  For
 	// example, SELFTEST gets set when the newt test command is used.
 	injectedSettings map[string]string
@@ -87,6 +106,9 @@ func NewLocalPackage(r *repo.Repo, pkgDir string) *LocalPackage {
 		repo:             r,
 		basePath:         filepath.ToSlash(filepath.Clean(pkgDir)),
 		init:             map[string]int{},
+		initRelations:    map[string]InitRelations{},
+		down:             map[string]int{},
+		downRelations:    map[string]InitRelations{},
 		injectedSettings: map[string]string{},
 	}
 	return pkg
@@ -321,14 +343,9 @@ func (pkg *LocalPackage) Load() error {
 		}
 	}
 
-	init := pkg.PkgV.GetStringMapString("pkg.init")
-	for name, stageStr := range init {
-		stage, err := strconv.ParseInt(stageStr, 10, 64)
-		if err != nil {
-			return util.NewNewtError(fmt.Sprintf("Parsing pkg %s config: %s",
-				pkg.FullName(), err.Error()))
-		}
-		pkg.init[name] = int(stage)
+	pkg.init, pkg.initRelations, err = pkg.readStageFuncs("pkg.init")
+	if err != nil {
+		return err
 	}
 	initFnName := pkg.PkgV.GetString("pkg.init_function")
 	initStage := pkg.PkgV.GetInt("pkg.init_stage")
@@ -337,6 +354,11 @@ func (pkg *LocalPackage) Load() error {
 		pkg.init[initFnName] = initStage
 	}
 
+	pkg.down, pkg.downRelations, err = pkg.readStageFuncs("pkg.down")
+	if err != nil {
+		return err
+	}
+
 	// Read the package description from the file
 	pkg.desc, err = pkg.readDesc(pkg.PkgV)
 	if err != nil {
@@ -356,10 +378,74 @@ func (pkg *LocalPackage) Load() error {
 	return nil
 }
 
+// Parses a map of stage functions (e.g., "pkg.init" or "pkg.down").  Each
+// entry maps a function name to either a stage number or a map of the
+// following form:
+//
+//	pkg.init:
+//	    my_init_fn:
+//	        stage: 500
+//	        after:
+//	            - other_init_fn
+//	            - "@apache-mynewt-core/sys/log/full"
+//	        before:
+//	            - last_init_fn
+//
+// "after" and "before" entries name other functions or packages.
+func (pkg *LocalPackage) readStageFuncs(key string) (
+	map[string]int, map[string]InitRelations, error) {
+
+	stages := map[string]int{}
+	relationMap := map[string]InitRelations{}
+
+	for name, val := range pkg.PkgV.GetStringMap(key) {
+		var stageVal interface{}
+		relations := InitRelations{}
+
+		if fields, err := cast.ToStringMapE(val); err == nil {
+			stageVal = fields["stage"]
+			if stageVal == nil {
+				return nil, nil, util.FmtNewtError(
+					"Parsing pkg %s config: %s function %s lacks a stage",
+					pkg.FullName(), key, name)
+			}
+			relations.After = cast.ToStringSlice(fields["after"])
+			relations.Before = cast.ToStringSlice(fields["before"])
+		} else {
+			stageVal = val
+		}
+
+		stage, err := strconv.ParseInt(cast.ToString(stageVal), 10, 64)
+		if err != nil {
+			return nil, nil, util.NewNewtError(fmt.Sprintf(
+				"Parsing pkg %s config: %s", pkg.FullName(), err.Error()))
+		}
+		stages[name] = int(stage)
+
+		if len(relations.After) > 0 || len(relations.Before) > 0 {
+			relationMap[name] = relations
+		}
+	}
+
+	return stages, relationMap, nil
+}
+
 func (pkg *LocalPackage) Init() map[string]int {
 	return pkg.init
 }
 
+func (pkg *LocalPackage) InitRelations() map[string]InitRelations {
+	return pkg.initRelations
+}
+
+func (pkg *LocalPackage) Down() map[string]int {
+	return pkg.down
+}
+
+func (pkg *LocalPackage) DownRelations() map[string]InitRelations {
+	return pkg.downRelations
+}
+
 func (pkg *LocalPackage) InjectedSettings() map[string]string {
 	return pkg.injectedSettings
 }
@@ -0,0 +1,136 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/util"
+)
+
+// Developer-specific repository overrides.  This file is not meant to be
+// committed; it should be listed in the project's .gitignore.
+const PROJECT_OVERRIDE_FILE = "project.override.yml"
+
+// Replaces a repository with a local working tree, or checks out a
+// different branch of it.  Exactly one of the fields is set.
+type RepoOverride struct {
+	Path   string
+	Branch string
+}
+
+// Describes the override in a form suitable for display.
+func (ro *RepoOverride) String() string {
+	if ro.Path != "" {
+		return "path " + ro.Path
+	}
+	return "branch " + ro.Branch
+}
+
+// Reads the project's override file, if it exists.  The file uses the same
+// "repository.<name>" keys as project.yml:
+//
+//	repository.apache-mynewt-core:
+//	    path: ../mynewt-core
+//	repository.apache-mynewt-nimble:
+//	    branch: my-feature
+func (proj *Project) loadOverrides() error {
+	proj.overrides = map[string]*RepoOverride{}
+
+	if util.NodeNotExist(proj.BasePath + "/" + PROJECT_OVERRIDE_FILE) {
+		return nil
+	}
+
+	v, err := util.ReadConfig(proj.BasePath,
+		strings.TrimSuffix(PROJECT_OVERRIDE_FILE, ".yml"))
+	if err != nil {
+		return err
+	}
+
+	for key, itf := range v.AllSettings() {
+		if !strings.HasPrefix(key, "repository.") {
+			return util.FmtNewtError("%s: invalid key \"%s\"",
+				PROJECT_OVERRIDE_FILE, key)
+		}
+		rname := strings.TrimPrefix(key, "repository.")
+
+		vals := cast.ToStringMapString(itf)
+		ro := &RepoOverride{
+			Path:   vals["path"],
+			Branch: vals["branch"],
+		}
+		if (ro.Path == "") == (ro.Branch == "") {
+			return util.FmtNewtError(
+				"%s: repository %s must specify either a path or a branch",
+				PROJECT_OVERRIDE_FILE, rname)
+		}
+
+		if ro.Path != "" && !filepath.IsAbs(ro.Path) {
+			ro.Path = proj.BasePath + "/" + ro.Path
+		}
+		if ro.Path != "" {
+			ro.Path = filepath.ToSlash(filepath.Clean(ro.Path))
+			if util.NodeNotExist(ro.Path) {
+				return util.FmtNewtError(
+					"%s: path for repository %s does not exist: %s",
+					PROJECT_OVERRIDE_FILE, rname, ro.Path)
+			}
+		}
+
+		proj.overrides[rname] = ro
+	}
+
+	return nil
+}
+
+// Applies the workspace override for a repo, if there is one.
+func (proj *Project) applyOverride(r *repo.Repo) {
+	ro := proj.overrides[r.Name()]
+	if ro == nil {
+		return
+	}
+
+	if ro.Path != "" {
+		r.SetPathOverride(ro.Path)
+	} else {
+		r.SetBranchOverride(ro.Branch)
+	}
+}
+
+// Retrieves the active workspace overrides, keyed by repository name.
+func (proj *Project) Overrides() map[string]*RepoOverride {
+	return proj.overrides
+}
+
+// Retrieves the names of the repos with an active workspace override, sorted.
+func (proj *Project) OverriddenRepoNames() []string {
+	names := make([]string, 0, len(proj.overrides))
+	for name, _ := range proj.overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
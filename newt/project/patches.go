@@ -0,0 +1,405 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/util"
+)
+
+// Prefix of a patch specifier that refers to a git commit or commit range
+// rather than a patch file; e.g., "ref:abc123", "ref:v1..v2", or
+// "ref:https://github.com/me/fork.git#my-fix".
+const PATCH_REF_PREFIX = "ref:"
+
+const (
+	PATCH_STATUS_APPLIED    = "applied"
+	PATCH_STATUS_PENDING    = "not applied"
+	PATCH_STATUS_CONFLICT   = "conflict"
+	PATCH_STATUS_CHANGED    = "changed since applied"
+	PATCH_STATUS_REMOVED    = "removed from project.yml"
+	PATCH_STATUS_UNRESOLVED = "unresolved"
+)
+
+// A downstream patch listed for a repo in project.yml.
+type RepoPatch struct {
+	Spec string
+
+	// Hash of the patch contents; identifies the version of the patch that
+	// was applied.
+	Hash string
+
+	Diff []byte
+}
+
+// The status of a single patch in an installed repo.
+type PatchStatus struct {
+	Spec   string
+	Status string
+	Detail string
+}
+
+// Applied patches are recorded as "<spec>@<hash>"; see ProjectState.
+func (rp *RepoPatch) stateString() string {
+	return rp.Spec + "@" + rp.Hash
+}
+
+func parsePatchStateString(s string) (string, string) {
+	idx := strings.LastIndex(s, "@")
+	if idx < 0 {
+		return s, ""
+	}
+	return s[:idx], s[idx+1:]
+}
+
+// Retrieves the patch specifiers listed for a repo in project.yml.
+func (proj *Project) PatchSpecs(rname string) []string {
+	repoVars := cast.ToStringMap(proj.v.Get("repository." + rname))
+	return cast.ToStringSlice(repoVars["patches"])
+}
+
+// Directory where copies of the patches applied to a repo are kept.  The
+// copies are used to revert the patches, even if the originals have changed.
+func (proj *Project) appliedPatchDir(rname string) string {
+	return proj.Path() + "/" + repo.REPOS_DIR + "/.patches/" + rname
+}
+
+func (proj *Project) appliedPatchPath(rname string, idx int) string {
+	return fmt.Sprintf("%s/%04d.patch", proj.appliedPatchDir(rname), idx)
+}
+
+// Reads the contents of a patch.  Patch files are relative to the project
+// directory; git refs are resolved in the installed repo.
+func (proj *Project) loadPatch(r *repo.Repo, spec string) (*RepoPatch, error) {
+	var diff []byte
+	var err error
+
+	if strings.HasPrefix(spec, PATCH_REF_PREFIX) {
+		url := ""
+		rev := strings.TrimPrefix(spec, PATCH_REF_PREFIX)
+		if idx := strings.LastIndex(rev, "#"); idx >= 0 {
+			url, rev = rev[:idx], rev[idx+1:]
+		}
+
+		diff, err = downloader.RefDiff(r.Path(), url, rev)
+		if err != nil {
+			// Only the first line of git's output is informative.
+			msg := strings.SplitN(strings.TrimSpace(err.Error()), "\n", 2)[0]
+			return nil, util.FmtNewtError(
+				"Cannot resolve patch \"%s\" for repository %s: %s",
+				spec, r.Name(), msg)
+		}
+	} else {
+		path := spec
+		if !strings.HasPrefix(path, "/") {
+			path = proj.Path() + "/" + path
+		}
+
+		diff, err = ioutil.ReadFile(path)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"Cannot read patch \"%s\" for repository %s: %s",
+				spec, r.Name(), err.Error())
+		}
+	}
+
+	sum := sha256.Sum256(diff)
+	return &RepoPatch{
+		Spec: spec,
+		Hash: fmt.Sprintf("%x", sum)[:12],
+		Diff: diff,
+	}, nil
+}
+
+// Reverts the patches recorded as applied to a repo, in reverse order of
+// application.  The project state is updated but not saved.
+func (proj *Project) UnapplyPatches(r *repo.Repo) error {
+	applied := proj.projState.GetAppliedPatches(r.Name())
+
+	// Nothing to revert if the repo was removed.
+	if util.NodeNotExist(r.Path()) {
+		proj.projState.SetAppliedPatches(r.Name(), nil)
+		os.RemoveAll(proj.appliedPatchDir(r.Name()))
+		return nil
+	}
+
+	for i := len(applied) - 1; i >= 0; i-- {
+		spec, _ := parsePatchStateString(applied[i])
+
+		diff, err := ioutil.ReadFile(proj.appliedPatchPath(r.Name(), i))
+		if err != nil {
+			return util.FmtNewtError(
+				"Cannot revert patch \"%s\" in repository %s: %s",
+				spec, r.Name(), err.Error())
+		}
+
+		if downloader.CheckPatch(r.Path(), diff) ==
+			downloader.PATCH_STATE_APPLIED {
+
+			util.StatusMessage(util.VERBOSITY_VERBOSE,
+				"Reverting patch %s in %s\n", spec, r.Name())
+			if err := downloader.ApplyPatch(r.Path(), diff,
+				true); err != nil {
+
+				return util.FmtNewtError(
+					"Cannot revert patch \"%s\" in repository %s: %s",
+					spec, r.Name(), err.Error())
+			}
+		}
+
+		proj.projState.SetAppliedPatches(r.Name(), applied[:i])
+	}
+
+	os.RemoveAll(proj.appliedPatchDir(r.Name()))
+	return nil
+}
+
+// Applies the patches listed for a repo in project.yml to its working tree.
+// Patches that are already applied are recorded as such.  Every patch that
+// can be applied is applied; an error listing the conflicting patches is
+// returned if any of them cannot be.  The project state is updated but not
+// saved.
+func (proj *Project) ApplyPatches(r *repo.Repo) error {
+	specs := proj.PatchSpecs(r.Name())
+
+	rps := make([]*RepoPatch, len(specs))
+	loadErrs := make([]error, len(specs))
+	for i, spec := range specs {
+		rps[i], loadErrs[i] = proj.loadPatch(r, spec)
+	}
+
+	// If the recorded patches are not a prefix of the listed ones (e.g., a
+	// patch was removed, reordered, or edited), start over.
+	recorded := proj.projState.GetAppliedPatches(r.Name())
+	for i, s := range recorded {
+		if i >= len(rps) || rps[i] == nil || rps[i].stateString() != s {
+			if err := proj.UnapplyPatches(r); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	if len(specs) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(proj.appliedPatchDir(r.Name()),
+		repo.REPO_DEFAULT_PERMS); err != nil {
+
+		return util.NewNewtError(err.Error())
+	}
+
+	applied := []string{}
+	conflicts := []string{}
+	for i, spec := range specs {
+		rp := rps[i]
+		if rp == nil {
+			util.StatusMessage(util.VERBOSITY_QUIET, "WARNING: %s\n",
+				loadErrs[i].Error())
+			conflicts = append(conflicts, spec)
+			continue
+		}
+
+		switch downloader.CheckPatch(r.Path(), rp.Diff) {
+		case downloader.PATCH_STATE_APPLICABLE:
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Applying patch %s to %s\n", spec, r.Name())
+			if err := downloader.ApplyPatch(r.Path(), rp.Diff,
+				false); err != nil {
+
+				return util.FmtNewtError(
+					"Cannot apply patch \"%s\" to repository %s: %s",
+					spec, r.Name(), err.Error())
+			}
+
+		case downloader.PATCH_STATE_APPLIED:
+			util.StatusMessage(util.VERBOSITY_VERBOSE,
+				"Patch %s already applied to %s\n", spec, r.Name())
+
+		default:
+			conflicts = append(conflicts, spec)
+			continue
+		}
+
+		err := ioutil.WriteFile(proj.appliedPatchPath(r.Name(), len(applied)),
+			rp.Diff, 0644)
+		if err != nil {
+			return util.NewNewtError(err.Error())
+		}
+		applied = append(applied, rp.stateString())
+	}
+
+	proj.projState.SetAppliedPatches(r.Name(), applied)
+
+	if len(conflicts) > 0 {
+		return util.FmtNewtError(
+			"Patches for repository %s could not be applied: %s",
+			r.Name(), strings.Join(conflicts, ", "))
+	}
+
+	return nil
+}
+
+// Lists the files modified by the patches recorded as applied to a repo.
+// Patches that cannot be read are skipped.
+func (proj *Project) PatchedFiles(r *repo.Repo) []string {
+	files := []string{}
+	for i := range proj.projState.GetAppliedPatches(r.Name()) {
+		diff, err := ioutil.ReadFile(proj.appliedPatchPath(r.Name(), i))
+		if err != nil {
+			continue
+		}
+
+		patchFiles, err := downloader.PatchFiles(r.Path(), diff)
+		if err != nil {
+			continue
+		}
+		files = append(files, patchFiles...)
+	}
+
+	return files
+}
+
+// Reports the status of each patch listed for a repo in project.yml, as well
+// as any recorded patches that are no longer listed.
+func (proj *Project) PatchStatuses(r *repo.Repo) []PatchStatus {
+	recorded := map[string]string{}
+	for _, s := range proj.projState.GetAppliedPatches(r.Name()) {
+		spec, hash := parsePatchStateString(s)
+		recorded[spec] = hash
+	}
+
+	statuses := []PatchStatus{}
+	listed := map[string]bool{}
+	for _, spec := range proj.PatchSpecs(r.Name()) {
+		listed[spec] = true
+		ps := PatchStatus{Spec: spec}
+
+		rp, err := proj.loadPatch(r, spec)
+		if err != nil {
+			ps.Status = PATCH_STATUS_UNRESOLVED
+			ps.Detail = err.Error()
+			statuses = append(statuses, ps)
+			continue
+		}
+
+		hash, isRecorded := recorded[spec]
+		switch {
+		case isRecorded && hash != rp.Hash:
+			ps.Status = PATCH_STATUS_CHANGED
+			ps.Detail = fmt.Sprintf("applied %s, current %s", hash, rp.Hash)
+		default:
+			switch downloader.CheckPatch(r.Path(), rp.Diff) {
+			case downloader.PATCH_STATE_APPLIED:
+				ps.Status = PATCH_STATUS_APPLIED
+			case downloader.PATCH_STATE_APPLICABLE:
+				ps.Status = PATCH_STATUS_PENDING
+			default:
+				ps.Status = PATCH_STATUS_CONFLICT
+			}
+		}
+
+		statuses = append(statuses, ps)
+	}
+
+	for _, s := range proj.projState.GetAppliedPatches(r.Name()) {
+		spec, _ := parsePatchStateString(s)
+		if !listed[spec] {
+			statuses = append(statuses, PatchStatus{
+				Spec:   spec,
+				Status: PATCH_STATUS_REMOVED,
+			})
+		}
+	}
+
+	return statuses
+}
+
+// Syncs an installed repo with the branch of its installed version.  The
+// repo's patches are reverted before the sync so that they are not treated as
+// local work, and reapplied afterwards.
+//
+// @return                      exists, updated, err
+func (proj *Project) SyncRepo(r *repo.Repo,
+	opts repo.SyncOptions) (bool, bool, error) {
+
+	if r.PathOverridden() {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Skipping %s; using workspace override at %s\n", r.Name(),
+			r.Path())
+		return true, true, nil
+	}
+
+	vers := proj.projState.GetInstalledVersion(r.Name())
+	if vers == nil {
+		return false, false, util.FmtNewtError(
+			"No installed version of %s found", r.Name())
+	}
+
+	numPatches := len(proj.projState.GetAppliedPatches(r.Name()))
+
+	// A dry run must not modify the working tree or the project state; the
+	// patches remain applied and the files they modify are not treated as
+	// local work.
+	if opts.DryRun {
+		opts.PatchedFiles = proj.PatchedFiles(r)
+		exists, _, err := r.Sync(vers, opts)
+		if err == nil && numPatches > 0 {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"    - revert %d patches before sync and reapply them "+
+					"afterwards\n", numPatches)
+		}
+		return exists, false, err
+	}
+
+	if err := proj.UnapplyPatches(r); err != nil {
+		return true, false, err
+	}
+
+	exists, updated, syncErr := r.Sync(vers, opts)
+	if syncErr == nil &&
+		(numPatches > 0 || len(proj.PatchSpecs(r.Name())) > 0) {
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    - reapply patches (%d reverted before sync)\n", numPatches)
+	}
+
+	// Reapply the patches even if the sync failed; this restores the
+	// repo's previous state.
+	patchErr := proj.ApplyPatches(r)
+	if err := proj.projState.Save(); err != nil {
+		return exists, updated, err
+	}
+
+	if syncErr != nil {
+		return exists, false, syncErr
+	}
+	return exists, updated, patchErr
+}
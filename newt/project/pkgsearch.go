@@ -0,0 +1,284 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/yaml"
+)
+
+// A package that matches a search query.
+type PackageSearchResult struct {
+	Repo  string
+	Entry *repo.PackageIndexEntry
+
+	// Whether the package's repo is installed.  Packages in repos that are
+	// not installed are found via the repo's published package index.
+	Installed bool
+
+	// The installed version of the repo, or the versions it offers if it is
+	// not installed.
+	Versions []*repo.Version
+
+	// Names of the fields that matched the query (e.g., "name", "apis").
+	Matches []string
+}
+
+func localPackageIndexEntry(lpkg *pkg.LocalPackage) *repo.PackageIndexEntry {
+	return &repo.PackageIndexEntry{
+		Name:        lpkg.Name(),
+		Type:        pkg.PackageTypeNames[lpkg.Type()],
+		Description: lpkg.Desc().Description,
+		Keywords:    lpkg.Desc().Keywords,
+		Apis:        lpkg.PkgV.GetStringSlice("pkg.apis"),
+	}
+}
+
+// Builds package index entries for every package in an installed repo.
+func (proj *Project) repoPackageIndex(rname string) []*repo.PackageIndexEntry {
+	entries := []*repo.PackageIndexEntry{}
+
+	plist := proj.packages[rname]
+	if plist == nil {
+		return entries
+	}
+
+	for _, p := range *plist {
+		// Don't list the special unittest target; it is used internally.
+		if strings.HasSuffix(p.Name(), "/unittest") {
+			continue
+		}
+		entries = append(entries, localPackageIndexEntry(p.(*pkg.LocalPackage)))
+	}
+
+	return entries
+}
+
+func containsFold(s string, substr string) bool {
+	return strings.Contains(strings.ToLower(s), substr)
+}
+
+func sliceContainsFold(ss []string, substr string) bool {
+	for _, s := range ss {
+		if containsFold(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Determines which fields of a package index entry match a query.  Every
+// word in the query must match at least one field.  Nil is returned if the
+// entry does not match.
+func matchPackageIndexEntry(entry *repo.PackageIndexEntry,
+	words []string) []string {
+
+	fields := []struct {
+		name  string
+		match func(word string) bool
+	}{
+		{"name", func(w string) bool { return containsFold(entry.Name, w) }},
+		{"description",
+			func(w string) bool { return containsFold(entry.Description, w) }},
+		{"keywords",
+			func(w string) bool { return sliceContainsFold(entry.Keywords, w) }},
+		{"apis", func(w string) bool { return sliceContainsFold(entry.Apis, w) }},
+	}
+
+	matched := map[string]bool{}
+	for _, word := range words {
+		wordMatched := false
+		for _, f := range fields {
+			if f.match(word) {
+				matched[f.name] = true
+				wordMatched = true
+			}
+		}
+		if !wordMatched {
+			return nil
+		}
+	}
+
+	names := []string{}
+	for _, f := range fields {
+		if matched[f.name] {
+			names = append(names, f.name)
+		}
+	}
+
+	return names
+}
+
+type packageSearchSorter []*PackageSearchResult
+
+func (s packageSearchSorter) Len() int {
+	return len(s)
+}
+func (s packageSearchSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s packageSearchSorter) Less(i, j int) bool {
+	// Name matches first, then installed packages, then alphabetically.
+	iname := s[i].Matches[0] == "name"
+	jname := s[j].Matches[0] == "name"
+	if iname != jname {
+		return iname
+	}
+	if s[i].Installed != s[j].Installed {
+		return s[i].Installed
+	}
+	if s[i].Repo != s[j].Repo {
+		return s[i].Repo < s[j].Repo
+	}
+	return s[i].Entry.Name < s[j].Entry.Name
+}
+
+// Searches package names, descriptions, keywords, and exported APIs for the
+// specified query.  Installed repos are searched directly.  If remote is
+// true, repos that are listed in project.yml but not installed are searched
+// via the package index they publish.
+func (proj *Project) SearchPackages(query string,
+	remote bool) ([]*PackageSearchResult, error) {
+
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return nil, util.NewNewtError("Empty search query")
+	}
+
+	rnames := []string{}
+	for rname, _ := range proj.repos {
+		rnames = append(rnames, rname)
+	}
+	sort.Strings(rnames)
+
+	results := []*PackageSearchResult{}
+	for _, rname := range rnames {
+		r := proj.repos[rname]
+
+		var entries []*repo.PackageIndexEntry
+		var versions []*repo.Version
+
+		installed := proj.packages[rname] != nil
+		if installed {
+			entries = proj.repoPackageIndex(rname)
+			if vers := proj.projState.GetInstalledVersion(rname); vers != nil {
+				versions = []*repo.Version{vers}
+			}
+		} else {
+			if !remote {
+				continue
+			}
+
+			if err := r.EnsureDesc(); err != nil {
+				util.StatusMessage(util.VERBOSITY_QUIET,
+					"WARNING: failed to read description of repository "+
+						"%s: %s\n", rname, err.Error())
+			}
+			versions = r.Versions()
+
+			ok, err := r.DownloadPackageIndex()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				util.StatusMessage(util.VERBOSITY_DEFAULT,
+					"Repository %s is not installed and does not publish a "+
+						"package index; not searched.\n", rname)
+				continue
+			}
+
+			entries, err = r.ReadPackageIndex()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, entry := range entries {
+			matches := matchPackageIndexEntry(entry, words)
+			if matches != nil {
+				results = append(results, &PackageSearchResult{
+					Repo:      rname,
+					Entry:     entry,
+					Installed: installed,
+					Versions:  versions,
+					Matches:   matches,
+				})
+			}
+		}
+	}
+
+	sort.Sort(packageSearchSorter(results))
+
+	return results, nil
+}
+
+func writeIndexStrings(file *os.File, key string, vals []string) {
+	if len(vals) == 0 {
+		return
+	}
+
+	file.WriteString("        " + key + ":\n")
+	for _, val := range vals {
+		file.WriteString("            - " + yaml.EscapeString(val) + "\n")
+	}
+}
+
+// Writes a package index describing every package in the local repo.  A
+// repository publishes its index by committing this file next to its
+// repository.yml.
+func (proj *Project) WritePackageIndex(path string) (int, error) {
+	entryMap := map[string]*repo.PackageIndexEntry{}
+	names := []string{}
+	for _, entry := range proj.repoPackageIndex(proj.localRepo.Name()) {
+		entryMap[entry.Name] = entry
+		names = append(names, entry.Name)
+	}
+	sort.Strings(names)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, util.NewNewtError(err.Error())
+	}
+	defer file.Close()
+
+	file.WriteString("### Package index for " + proj.Name() +
+		"; generated by \"newt pkg index\".\n\n")
+	file.WriteString("packages:\n")
+	for _, name := range names {
+		entry := entryMap[name]
+		file.WriteString("    " + yaml.EscapeString(entry.Name) + ":\n")
+		file.WriteString("        type: " + yaml.EscapeString(entry.Type) +
+			"\n")
+		if entry.Description != "" {
+			file.WriteString("        description: " +
+				yaml.EscapeString(entry.Description) + "\n")
+		}
+		writeIndexStrings(file, "keywords", entry.Keywords)
+		writeIndexStrings(file, "apis", entry.Apis)
+	}
+
+	return len(names), nil
+}
@@ -0,0 +1,322 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// Directory within a repo that contains package templates.  The leading dot
+// prevents newt from treating templates as packages.
+const PKG_TEMPLATE_DIR = ".templates"
+
+// Optional file in a template's root directory describing the template.  It
+// is not copied into new packages.
+const PKG_TEMPLATE_FILE_NAME = "template.yml"
+
+// Source of a template that is downloaded from one of the apache/mynewt
+// template repositories.
+const PKG_TEMPLATE_SRC_BUILTIN = "builtin"
+
+// A package skeleton that "newt pkg new" copies into the project.
+type PackageTemplate struct {
+	Name string
+
+	// Where the template was found: a repo designator (e.g., "@my-repo"),
+	// PKG_TEMPLATE_SRC_BUILTIN, or a directory.
+	Source string
+
+	// Directory containing the template; empty for built-in templates.
+	Path string
+
+	Description string
+}
+
+var pkgTemplateVarRe = regexp.MustCompile(`{{([A-Za-z_]+)}}`)
+var pkgTemplateIdentRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Converts a string into a valid C identifier.
+func cIdentifier(s string) string {
+	ident := pkgTemplateIdentRe.ReplaceAllString(s, "_")
+	if ident == "" || (ident[0] >= '0' && ident[0] <= '9') {
+		ident = "_" + ident
+	}
+	return ident
+}
+
+// Determines the values of the template variables for a new package.
+//
+// @param pkgName               The full name of the new package.
+func PkgTemplateVars(pkgName string, author string,
+	desc string) map[string]string {
+
+	base := filepath.Base(pkgName)
+	ident := cIdentifier(base)
+
+	return map[string]string{
+		"pkg_name":    pkgName,
+		"pkg_base":    base,
+		"author":      author,
+		"description": desc,
+		"c_ident":     ident,
+		"C_IDENT":     strings.ToUpper(ident),
+	}
+}
+
+func loadPackageTemplate(name string, source string,
+	path string) *PackageTemplate {
+
+	tmpl := &PackageTemplate{
+		Name:   name,
+		Source: source,
+		Path:   path,
+	}
+
+	if util.NodeExist(path + "/" + PKG_TEMPLATE_FILE_NAME) {
+		v, err := util.ReadConfig(path,
+			strings.TrimSuffix(PKG_TEMPLATE_FILE_NAME, ".yml"))
+		if err == nil {
+			tmpl.Description = v.GetString("template.description")
+		}
+	}
+
+	return tmpl
+}
+
+// Retrieves the templates in a single repo's template directory.
+func (proj *Project) repoPackageTemplates(rname string) []*PackageTemplate {
+	r := proj.repos[rname]
+	if r == nil {
+		return nil
+	}
+
+	dir := r.Path() + "/" + PKG_TEMPLATE_DIR
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	source := "@" + rname
+	if r.IsLocal() {
+		source = "local"
+	}
+
+	tmpls := []*PackageTemplate{}
+	for _, info := range infos {
+		if info.IsDir() {
+			tmpls = append(tmpls, loadPackageTemplate(info.Name(), source,
+				dir+"/"+info.Name()))
+		}
+	}
+
+	return tmpls
+}
+
+// Retrieves every available package template: those in the local project,
+// then those in each installed repo (alphabetically), then the built-in
+// templates.  Earlier templates take precedence over later ones with the same
+// name.
+func (proj *Project) PackageTemplates() []*PackageTemplate {
+	tmpls := proj.repoPackageTemplates(proj.localRepo.Name())
+
+	rnames := []string{}
+	for rname, r := range proj.repos {
+		if !r.IsLocal() {
+			rnames = append(rnames, rname)
+		}
+	}
+	sort.Strings(rnames)
+	for _, rname := range rnames {
+		tmpls = append(tmpls, proj.repoPackageTemplates(rname)...)
+	}
+
+	builtinNames := []string{}
+	for name, _ := range TemplateRepoMap {
+		builtinNames = append(builtinNames, strings.ToLower(name))
+	}
+	sort.Strings(builtinNames)
+	for _, name := range builtinNames {
+		tmpls = append(tmpls, &PackageTemplate{
+			Name:   name,
+			Source: PKG_TEMPLATE_SRC_BUILTIN,
+			Description: "github.com/" + PACKAGEWRITER_GITHUB_DOWNLOAD_USER +
+				"/" + TemplateRepoMap[strings.ToUpper(name)],
+		})
+	}
+
+	return tmpls
+}
+
+// Finds a package template by name, path, or repo.  The specifier is a
+// template name (searched for in every repo, then among the built-in
+// templates), a directory path, "@<repo>/<name>", or "<repo>@<name>".  A
+// repo-qualified name may also be a directory path within that repo.
+func (proj *Project) FindPackageTemplate(spec string) (
+	*PackageTemplate, error) {
+
+	if strings.Contains(spec, "@") && !strings.HasPrefix(spec, "@") &&
+		util.NodeNotExist(spec) {
+
+		parts := strings.SplitN(spec, "@", 2)
+		spec = "@" + parts[0] + "/" + parts[1]
+	}
+
+	if strings.HasPrefix(spec, "@") {
+		rname, name, err := newtutil.ParsePackageString(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		r := proj.repos[rname]
+		if r == nil {
+			return nil, util.FmtNewtError("Unknown repository: %s", rname)
+		}
+
+		for _, tmpl := range proj.repoPackageTemplates(rname) {
+			if tmpl.Name == name {
+				return tmpl, nil
+			}
+		}
+
+		dir := r.Path() + "/" + name
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return loadPackageTemplate(filepath.Base(name), "@"+rname,
+				dir), nil
+		}
+
+		return nil, util.FmtNewtError(
+			"No template \"%s\" in repository %s", name, rname)
+	}
+
+	if strings.ContainsAny(spec, "/\\") || strings.HasPrefix(spec, ".") {
+		dir, err := filepath.Abs(spec)
+		if err != nil {
+			return nil, util.NewNewtError(err.Error())
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, util.FmtNewtError(
+				"Template directory does not exist: %s", spec)
+		}
+
+		dir = filepath.ToSlash(dir)
+		return loadPackageTemplate(filepath.Base(dir), dir, dir), nil
+	}
+
+	for _, tmpl := range proj.PackageTemplates() {
+		if strings.ToLower(tmpl.Name) == strings.ToLower(spec) {
+			return tmpl, nil
+		}
+	}
+
+	return nil, util.FmtNewtError("Unknown package template: %s; run "+
+		"\"newt pkg templates\" for a list of available templates", spec)
+}
+
+func substTemplateVars(s string, vars map[string]string) string {
+	return pkgTemplateVarRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := m[2 : len(m)-2]
+		if val, ok := vars[name]; ok {
+			return val
+		}
+		return m
+	})
+}
+
+// Replaces template variables in the names and contents of every file in a
+// directory.  Binary files keep their contents.
+func ExpandPackageTemplate(dir string, vars map[string]string) error {
+	paths := []string{}
+	err := filepath.Walk(dir,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path != dir {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+	if err != nil {
+		return util.NewNewtError(err.Error())
+	}
+
+	// Process the deepest paths first so that renaming a directory does not
+	// invalidate the paths of its contents.
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return util.NewNewtError(err.Error())
+		}
+
+		if !info.IsDir() {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return util.NewNewtError(err.Error())
+			}
+			if bytes.IndexByte(data, 0) < 0 {
+				expanded := substTemplateVars(string(data), vars)
+				if expanded != string(data) {
+					if err := ioutil.WriteFile(path, []byte(expanded),
+						info.Mode()); err != nil {
+
+						return util.NewNewtError(err.Error())
+					}
+				}
+			}
+		}
+
+		base := filepath.Base(path)
+		if newBase := substTemplateVars(base, vars); newBase != base {
+			newPath := filepath.Dir(path) + "/" + newBase
+			if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+				return util.NewNewtError(err.Error())
+			}
+			if err := os.Rename(path, newPath); err != nil {
+				return util.NewNewtError(err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// Determines the author to substitute into new packages when none is
+// specified: the git user name if configured, otherwise the login name.
+func DefaultTemplateAuthor() string {
+	out, err := util.ShellCommand([]string{"git", "config", "user.name"}, nil)
+	if err == nil {
+		if name := strings.TrimSpace(string(out)); name != "" {
+			return name
+		}
+	}
+
+	return os.Getenv("USER")
+}
@@ -38,6 +38,10 @@ type PackageWriter struct {
 	template   string
 	fullName   string
 	project    *Project
+
+	// Directory of a non-built-in template; empty for built-in templates.
+	templateDir string
+	vars        map[string]string
 }
 
 var TemplateRepoMap = map[string]string{
@@ -72,6 +76,34 @@ func (pw *PackageWriter) ConfigurePackage(template string, loc string) error {
 	return nil
 }
 
+// Configures the writer to create a package at the specified location from
+// the given template.
+func (pw *PackageWriter) ConfigureTemplate(tmpl *PackageTemplate, loc string,
+	author string, desc string) error {
+
+	if tmpl.Source == PKG_TEMPLATE_SRC_BUILTIN {
+		if err := pw.ConfigurePackage(strings.ToUpper(tmpl.Name),
+			loc); err != nil {
+
+			return err
+		}
+	} else {
+		pw.fullName = path.Clean(loc)
+		pw.targetPath = pw.project.Path() + "/" + pw.fullName
+		if util.NodeExist(pw.targetPath) {
+			return util.NewNewtError(fmt.Sprintf("Cannot place a new "+
+				"package in %s, path already exists.", pw.targetPath))
+		}
+
+		pw.template = tmpl.Name
+		pw.templateDir = tmpl.Path
+	}
+
+	pw.vars = PkgTemplateVars(pw.fullName, author, desc)
+
+	return nil
+}
+
 func (pw *PackageWriter) cleanupPackageFile(pfile string) error {
 	f, err := os.Open(pfile)
 	if err != nil {
@@ -123,7 +155,46 @@ func (pw *PackageWriter) fixupPKG() error {
 	return nil
 }
 
+// Copies a non-built-in template into the target directory.
+func (pw *PackageWriter) writeTemplateDir() error {
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Copy package template %s from %s.\n", pw.template, pw.templateDir)
+
+	if err := util.CopyDir(pw.templateDir, pw.targetPath); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(pw.targetPath + "/" +
+		PKG_TEMPLATE_FILE_NAME); err != nil {
+
+		return util.NewNewtError(err.Error())
+	}
+
+	return nil
+}
+
 func (pw *PackageWriter) WritePackage() error {
+	if pw.templateDir != "" {
+		if err := pw.writeTemplateDir(); err != nil {
+			return err
+		}
+	} else if err := pw.writeBuiltinPackage(); err != nil {
+		return err
+	}
+
+	if pw.vars != nil {
+		if err := ExpandPackageTemplate(pw.targetPath, pw.vars); err != nil {
+			return err
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Package successfuly installed into %s.\n", pw.targetPath)
+
+	return nil
+}
+
+func (pw *PackageWriter) writeBuiltinPackage() error {
 	dl := pw.downloader
 
 	dl.User = PACKAGEWRITER_GITHUB_DOWNLOAD_USER
@@ -153,9 +224,6 @@ func (pw *PackageWriter) WritePackage() error {
 		}
 	}
 
-	util.StatusMessage(util.VERBOSITY_DEFAULT,
-		"Package successfuly installed into %s.\n", pw.targetPath)
-
 	return nil
 }
 
@@ -25,6 +25,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
@@ -65,6 +66,9 @@ type Project struct {
 
 	localRepo *repo.Repo
 
+	// Workspace overrides from project.override.yml, keyed by repo name.
+	overrides map[string]*RepoOverride
+
 	v *viper.Viper
 }
 
@@ -241,7 +245,12 @@ func (proj *Project) checkVersionRequirements(r *repo.Repo, upgrade bool, force
 
 	vers := proj.projState.GetInstalledVersion(rname)
 	if vers != nil {
-		ok := rdesc.SatisfiesVersion(vers, r.VersionRequirements())
+		var ok bool
+		if selVers := r.SelectedVersion(); selVers != nil {
+			ok = vers.CompareVersions(vers, selVers) == 0
+		} else {
+			ok = rdesc.SatisfiesVersion(vers, r.VersionRequirements())
+		}
 		if !ok && !upgrade {
 			util.StatusMessage(util.VERBOSITY_QUIET, "WARNING: Installed "+
 				"version %s of repository %s does not match desired "+
@@ -273,8 +282,9 @@ func (proj *Project) checkVersionRequirements(r *repo.Repo, upgrade bool, force
 	return false, nil
 }
 
-func (proj *Project) checkDeps(r *repo.Repo) error {
-	repos, updated, err := r.UpdateDesc()
+// @param solving               Whether the dependency solver runs afterwards.
+func (proj *Project) checkDeps(r *repo.Repo, solving bool) error {
+	repos, updated, err := r.UpdateDesc(solving)
 	if err != nil {
 		return err
 	}
@@ -286,8 +296,9 @@ func (proj *Project) checkDeps(r *repo.Repo) error {
 	for _, newRepo := range repos {
 		curRepo, ok := proj.repos[newRepo.Name()]
 		if !ok {
+			proj.applyOverride(newRepo)
 			proj.repos[newRepo.Name()] = newRepo
-			return proj.UpdateRepos()
+			return proj.updateRepos(solving)
 		} else {
 			// Add any dependencies we might have found here.
 			for _, dep := range newRepo.Deps() {
@@ -302,13 +313,17 @@ func (proj *Project) checkDeps(r *repo.Repo) error {
 }
 
 func (proj *Project) UpdateRepos() error {
+	return proj.updateRepos(false)
+}
+
+func (proj *Project) updateRepos(solving bool) error {
 	repoList := proj.Repos()
 	for _, r := range repoList {
 		if r.IsLocal() {
 			continue
 		}
 
-		err := proj.checkDeps(r)
+		err := proj.checkDeps(r, solving)
 		if err != nil {
 			return err
 		}
@@ -316,6 +331,69 @@ func (proj *Project) UpdateRepos() error {
 	return nil
 }
 
+// Selects a version of each repository that satisfies the requirements of
+// the project and of every selected repository version.  Unless upgrading,
+// installed versions are kept where possible.  Repositories that are not
+// required by any selected version are removed from the project.
+func (proj *Project) solveDeps(upgrade bool) error {
+	rootReqs := []*repo.RepoRequirement{}
+	projRepos := map[string]bool{}
+	for _, rd := range proj.localRepo.Deps() {
+		rootReqs = append(rootReqs, &repo.RepoRequirement{
+			Dependee: rd.Name(),
+			Reqs:     rd.Storerepo.VersionRequirements(),
+		})
+		projRepos[rd.Name()] = true
+	}
+
+	preferred := map[string]*repo.Version{}
+	if !upgrade {
+		for rname, _ := range proj.repos {
+			if vers := proj.projState.GetInstalledVersion(rname); vers != nil {
+				preferred[rname] = vers
+			}
+		}
+	}
+
+	newRepo := func(rname string,
+		repoVars map[string]string) (*repo.Repo, error) {
+
+		dl, err := downloader.LoadDownloader(rname, repoVars)
+		if err != nil {
+			return nil, err
+		}
+		r, err := repo.NewRepo(rname, repoVars["vers"], dl)
+		if err != nil {
+			return nil, err
+		}
+		proj.applyOverride(r)
+		if _, _, err := r.UpdateDesc(true); err != nil {
+			return nil, err
+		}
+
+		return r, nil
+	}
+
+	solution, err := repo.SolveDeps(rootReqs, proj.repos, preferred, newRepo)
+	if err != nil {
+		return err
+	}
+
+	for rname, r := range proj.repos {
+		if r.IsLocal() {
+			continue
+		}
+
+		if vers := solution[rname]; vers != nil {
+			r.SelectVersion(vers)
+		} else if !projRepos[rname] {
+			delete(proj.repos, rname)
+		}
+	}
+
+	return nil
+}
+
 func (proj *Project) Install(upgrade bool, force bool) error {
 	repoList := proj.Repos()
 
@@ -327,20 +405,39 @@ func (proj *Project) Install(upgrade bool, force bool) error {
 
 		// First thing we do is update repository description.  This
 		// will get us available branches and versions in the repository.
-		if err := proj.UpdateRepos(); err != nil {
+		if err := proj.updateRepos(true); err != nil {
 			return err
 		}
 	}
 
-	// Get repository list, and print every repo and it's dependencies.
-	if err := repo.CheckDeps(upgrade, proj.Repos()); err != nil {
+	// Select a version of every required repository.
+	if err := proj.solveDeps(upgrade); err != nil {
 		return err
 	}
 
+	lock, err := LoadProjectLock()
+	if err != nil {
+		return err
+	}
+
+	// Patch conflicts are reported after every repo is installed.
+	patchErrs := []string{}
+	applyPatches := func(r *repo.Repo) {
+		if err := proj.ApplyPatches(r); err != nil {
+			patchErrs = append(patchErrs, err.Error())
+		}
+	}
+
 	for rname, r := range proj.Repos() {
 		if r.IsLocal() {
 			continue
 		}
+		if r.PathOverridden() {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Skipping %s; using workspace override at %s\n", rname,
+				r.Path())
+			continue
+		}
 		// Check the version requirements on this repository, and see
 		// whether or not we need to install/upgrade it.
 		skip, err := proj.checkVersionRequirements(r, upgrade, force)
@@ -348,9 +445,45 @@ func (proj *Project) Install(upgrade bool, force bool) error {
 			return err
 		}
 		if skip {
+			vers := proj.projState.GetInstalledVersion(rname)
+			if vers == nil {
+				continue
+			}
+
+			// An upgrade brings the repo up to date with its branch and
+			// refreshes the lock even if the version is unchanged; a plain
+			// install only fills in missing lock entries.  A workspace
+			// override branch is always checked out, but never locked.
+			if upgrade || r.BranchOverride() != "" {
+				if err := proj.UnapplyPatches(r); err != nil {
+					return err
+				}
+				if r.BranchOverride() != "" {
+					util.StatusMessage(util.VERBOSITY_VERBOSE,
+						"Checking out workspace override branch %s of %s\n",
+						r.BranchOverride(), rname)
+				}
+				if err := r.Update(vers); err != nil {
+					util.StatusMessage(util.VERBOSITY_DEFAULT,
+						"WARNING: Failed to update repository %s\n", rname)
+				}
+			}
+			if r.BranchOverride() == "" &&
+				(upgrade || lock.Get(rname) == nil) {
+
+				if err := proj.lockRepo(lock, r, vers); err != nil {
+					return err
+				}
+			}
+			applyPatches(r)
 			continue
 		}
 
+		// Patches get reapplied to the new version.
+		if err := proj.UnapplyPatches(r); err != nil {
+			return err
+		}
+
 		// Do the hard work of actually copying and installing the repository.
 		rvers, err := r.Install(upgrade || force)
 		if err != nil {
@@ -367,6 +500,14 @@ func (proj *Project) Install(upgrade bool, force bool) error {
 
 		// Update the project state with the new repository version information.
 		proj.projState.Replace(rname, rvers)
+
+		// An override branch must not end up in the lock file.
+		if r.BranchOverride() == "" {
+			if err := proj.lockRepo(lock, r, rvers); err != nil {
+				return err
+			}
+		}
+		applyPatches(r)
 	}
 
 	// Save the project state, including any updates or changes to the project
@@ -375,6 +516,140 @@ func (proj *Project) Install(upgrade bool, force bool) error {
 		return err
 	}
 
+	if !lock.IsEmpty() {
+		if err := lock.Save(); err != nil {
+			return err
+		}
+	}
+
+	if len(patchErrs) > 0 {
+		return util.NewNewtError(strings.Join(patchErrs, "\n"))
+	}
+
+	return nil
+}
+
+// Records the installed commit of a repository in the project lock.
+func (proj *Project) lockRepo(lock *ProjectLock, r *repo.Repo,
+	vers *repo.Version) error {
+
+	if util.NodeNotExist(r.Path()) {
+		return nil
+	}
+
+	rdesc, err := r.GetRepoDesc()
+	if err != nil {
+		return err
+	}
+	branch, _, _ := rdesc.MatchVersion(vers)
+
+	commit, err := r.CurrentCommit()
+	if err != nil {
+		return err
+	}
+
+	descHash, err := r.DescHash()
+	if err != nil {
+		return err
+	}
+
+	lock.Replace(&LockedRepo{
+		Name: r.Name(),
+		Version: fmt.Sprintf("%d.%d.%d", vers.Major(), vers.Minor(),
+			vers.Revision()),
+		Branch:   branch,
+		Commit:   commit,
+		DescHash: descHash,
+	})
+
+	return nil
+}
+
+// Installs every repository at the exact commit recorded in the project lock
+// file.  Version requirements in project.yml are not consulted; every
+// repository must have a lock entry.
+func (proj *Project) InstallLocked(force bool) error {
+	lock, err := LoadProjectLock()
+	if err != nil {
+		return err
+	}
+	if lock.IsEmpty() {
+		return util.FmtNewtError("No %s file; run \"newt install\" to "+
+			"create one", PROJECT_LOCK_FILE)
+	}
+
+	// Download repository descriptions to discover repository dependencies.
+	if err := proj.UpdateRepos(); err != nil {
+		return err
+	}
+
+	rnames := []string{}
+	for rname, r := range proj.Repos() {
+		if !r.IsLocal() {
+			rnames = append(rnames, rname)
+		}
+	}
+	sort.Strings(rnames)
+
+	// Patch conflicts are reported after every repo is installed.
+	patchErrs := []string{}
+	for _, rname := range rnames {
+		r := proj.repos[rname]
+
+		if ro := proj.overrides[rname]; ro != nil {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Skipping %s; using workspace override (%s)\n", rname,
+				ro.String())
+			continue
+		}
+
+		lr := lock.Get(rname)
+		if lr == nil {
+			return util.FmtNewtError("Repository %s is not in %s; run "+
+				"\"newt upgrade\" to update the lock file", rname,
+				PROJECT_LOCK_FILE)
+		}
+
+		if descHash, err := r.DescHash(); err == nil &&
+			descHash != lr.DescHash {
+
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"WARNING: %s of repository %s has changed since it was "+
+					"locked\n", repo.REPO_FILE_NAME, rname)
+		}
+
+		rvers, err := repo.LoadVersion(lr.Version)
+		if err != nil {
+			return err
+		}
+
+		if err := proj.UnapplyPatches(r); err != nil {
+			return err
+		}
+
+		if err := r.InstallCommit(lr.Commit, force); err != nil {
+			return err
+		}
+
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"%s successfully installed version %s (commit %s)\n",
+			rname, lr.Version, lr.Commit)
+
+		proj.projState.Replace(rname, rvers)
+
+		if err := proj.ApplyPatches(r); err != nil {
+			patchErrs = append(patchErrs, err.Error())
+		}
+	}
+
+	if err := proj.projState.Save(); err != nil {
+		return err
+	}
+
+	if len(patchErrs) > 0 {
+		return util.NewNewtError(strings.Join(patchErrs, "\n"))
+	}
+
 	return nil
 }
 
@@ -382,6 +657,36 @@ func (proj *Project) Upgrade(force bool) error {
 	return proj.Install(true, force)
 }
 
+// Populates a mirror directory with every repository the project depends on,
+// including the transitive dependencies declared in each repository.yml
+// file.  Each repository is stored as a bare git repository named
+// "<repo-name>.git".
+func (proj *Project) Vendor(dir string) error {
+	if err := proj.UpdateRepos(); err != nil {
+		return err
+	}
+
+	rnames := []string{}
+	for rname, r := range proj.Repos() {
+		if !r.IsLocal() {
+			rnames = append(rnames, rname)
+		}
+	}
+	sort.Strings(rnames)
+
+	for _, rname := range rnames {
+		dst := dir + "/" + rname + ".git"
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Mirroring %s to %s\n",
+			rname, dst)
+
+		if err := proj.repos[rname].Mirror(dst); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (proj *Project) loadRepo(rname string, v *viper.Viper) error {
 	varName := fmt.Sprintf("repository.%s", rname)
 
@@ -417,6 +722,7 @@ func (proj *Project) loadRepo(rname string, v *viper.Viper) error {
 	rd.Storerepo = r
 
 	proj.localRepo.AddDependency(rd)
+	proj.applyOverride(r)
 
 	// Read the repo's descriptor file so that we have its newt version
 	// compatibility map.
@@ -487,6 +793,10 @@ func (proj *Project) loadConfig() error {
 
 	proj.name = v.GetString("project.name")
 
+	if err := proj.loadOverrides(); err != nil {
+		return err
+	}
+
 	// Local repository always included in initialization
 	r, err := repo.NewLocalRepo(proj.name)
 	if err != nil {
@@ -0,0 +1,150 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/util"
+)
+
+const PROJECT_LOCK_FILE = "project.lock"
+
+// The exact state of a single installed repository.
+type LockedRepo struct {
+	Name    string
+	Version string
+
+	// The branch or tag that the version resolved to.
+	Branch string
+
+	// The SHA of the commit that was checked out.
+	Commit string
+
+	// SHA256 of the repository.yml file at install time.
+	DescHash string
+}
+
+// Records the exact commit of every installed repository so that an install
+// can be reproduced.  Unlike the project state file, the lock file is meant to
+// be committed along with project.yml.
+type ProjectLock struct {
+	repos map[string]*LockedRepo
+}
+
+func (pl *ProjectLock) Get(rname string) *LockedRepo {
+	return pl.repos[rname]
+}
+
+func (pl *ProjectLock) Replace(lr *LockedRepo) {
+	pl.repos[lr.Name] = lr
+}
+
+func (pl *ProjectLock) IsEmpty() bool {
+	return len(pl.repos) == 0
+}
+
+func (pl *ProjectLock) LockFile() string {
+	return interfaces.GetProject().Path() + "/" + PROJECT_LOCK_FILE
+}
+
+func (pl *ProjectLock) Save() error {
+	file, err := os.Create(pl.LockFile())
+	if err != nil {
+		return util.NewNewtError(err.Error())
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "# Generated by newt; do not edit.\n")
+	fmt.Fprintf(file, "# Use \"newt install --locked\" to install these "+
+		"exact commits and\n")
+	fmt.Fprintf(file, "# \"newt upgrade\" to update them.\n")
+	fmt.Fprintf(file, "# <repo>,<version>,<branch>,<commit>,"+
+		"<repository.yml sha256>\n")
+
+	names := make([]string, 0, len(pl.repos))
+	for name, _ := range pl.repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		lr := pl.repos[name]
+		fmt.Fprintf(file, "%s,%s,%s,%s,%s\n",
+			lr.Name, lr.Version, lr.Branch, lr.Commit, lr.DescHash)
+	}
+
+	return nil
+}
+
+func (pl *ProjectLock) Init() error {
+	pl.repos = map[string]*LockedRepo{}
+
+	path := pl.LockFile()
+
+	// A missing lock file is equivalent to an empty one.
+	if util.NodeNotExist(path) {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return util.NewNewtError(err.Error())
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		line := strings.Split(text, ",")
+		if len(line) != 5 {
+			return util.FmtNewtError(
+				"Invalid format for line in %s file: %s",
+				PROJECT_LOCK_FILE, text)
+		}
+
+		pl.repos[line[0]] = &LockedRepo{
+			Name:     line[0],
+			Version:  line[1],
+			Branch:   line[2],
+			Commit:   line[3],
+			DescHash: line[4],
+		}
+	}
+
+	return nil
+}
+
+func LoadProjectLock() (*ProjectLock, error) {
+	pl := &ProjectLock{}
+	if err := pl.Init(); err != nil {
+		return nil, err
+	}
+	return pl, nil
+}
@@ -22,7 +22,9 @@ package project
 import (
 	"bufio"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"mynewt.apache.org/newt/newt/interfaces"
@@ -34,6 +36,9 @@ const PROJECT_STATE_FILE = "project.state"
 
 type ProjectState struct {
 	installedRepos map[string]*repo.Version
+
+	// Patches applied to each installed repo, in order of application.
+	appliedPatches map[string][]string
 }
 
 func (ps *ProjectState) GetInstalledVersion(rname string) *repo.Version {
@@ -45,10 +50,30 @@ func (ps *ProjectState) Replace(rname string, rvers *repo.Version) {
 	ps.installedRepos[rname] = rvers
 }
 
+func (ps *ProjectState) GetAppliedPatches(rname string) []string {
+	return ps.appliedPatches[rname]
+}
+
+func (ps *ProjectState) SetAppliedPatches(rname string, patches []string) {
+	if len(patches) == 0 {
+		delete(ps.appliedPatches, rname)
+	} else {
+		ps.appliedPatches[rname] = patches
+	}
+}
+
 func (ps *ProjectState) StateFile() string {
 	return interfaces.GetProject().Path() + "/" + PROJECT_STATE_FILE
 }
 
+// Applied patches are recorded outside of project.state so that the state
+// file remains readable by older versions of newt.  Each repo's patches are
+// listed one per line.
+func (ps *ProjectState) appliedPatchesFile(rname string) string {
+	return interfaces.GetProject().Path() + "/" + repo.REPOS_DIR +
+		"/.patches/" + rname + "/applied"
+}
+
 func (ps *ProjectState) Save() error {
 	file, err := os.Create(ps.StateFile())
 	if err != nil {
@@ -59,13 +84,65 @@ func (ps *ProjectState) Save() error {
 	for k, v := range ps.installedRepos {
 		str := fmt.Sprintf("%s,%d.%d.%d\n", k, v.Major(), v.Minor(), v.Revision())
 		file.WriteString(str)
+
+		if err := ps.saveAppliedPatches(k); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+func (ps *ProjectState) saveAppliedPatches(rname string) error {
+	path := ps.appliedPatchesFile(rname)
+
+	patches := ps.appliedPatches[rname]
+	if len(patches) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return util.NewNewtError(err.Error())
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path),
+		repo.REPO_DEFAULT_PERMS); err != nil {
+
+		return util.NewNewtError(err.Error())
+	}
+
+	contents := strings.Join(patches, "\n") + "\n"
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		return util.NewNewtError(err.Error())
+	}
+
+	return nil
+}
+
+func (ps *ProjectState) loadAppliedPatches(rname string) error {
+	path := ps.appliedPatchesFile(rname)
+	if util.NodeNotExist(path) {
+		return nil
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return util.NewNewtError(err.Error())
+	}
+
+	patches := []string{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		if line != "" {
+			patches = append(patches, line)
+		}
+	}
+	ps.SetAppliedPatches(rname, patches)
+
+	return nil
+}
+
 func (ps *ProjectState) Init() error {
 	ps.installedRepos = map[string]*repo.Version{}
+	ps.appliedPatches = map[string][]string{}
 
 	path := ps.StateFile()
 
@@ -96,6 +173,10 @@ func (ps *ProjectState) Init() error {
 		}
 
 		ps.installedRepos[repoName] = repoVers
+
+		if err := ps.loadAppliedPatches(repoName); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -0,0 +1,127 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Name of the package index that a repository may publish alongside its
+// repository.yml file.  The index lets newt search a repository's packages
+// without installing it.
+const PKG_INDEX_FILE_NAME = "package-index.yml"
+
+// Summary of a package as recorded in a package index.
+type PackageIndexEntry struct {
+	Name        string
+	Type        string
+	Description string
+	Keywords    []string
+	Apis        []string
+}
+
+func (r *Repo) packageIndexPath() string {
+	return r.repoFilePath() + PKG_INDEX_FILE_NAME
+}
+
+// Retrieves the versions declared in the repository description, newest
+// first.  Only concrete versions (i.e., not "latest", "dev", etc.) are
+// returned.
+func (r *Repo) Versions() []*Version {
+	if r.rdesc == nil {
+		return nil
+	}
+
+	return r.rdesc.concreteVersions()
+}
+
+// Ensures the repository description has been read, downloading it if no
+// cached copy exists.
+func (r *Repo) EnsureDesc() error {
+	if r.rdesc != nil {
+		return nil
+	}
+
+	if util.NodeNotExist(r.repoFilePath() + REPO_FILE_NAME) {
+		if err := r.DownloadDesc(); err != nil {
+			return err
+		}
+	}
+
+	_, _, err := r.ReadDesc()
+	return err
+}
+
+// Downloads the package index published by the repository.  A repository
+// that does not publish an index is not an error; in this case, false is
+// returned.
+func (r *Repo) DownloadPackageIndex() (bool, error) {
+	cpath := r.repoFilePath()
+	if util.NodeNotExist(cpath) {
+		if err := os.MkdirAll(cpath, REPO_DEFAULT_PERMS); err != nil {
+			return false, util.NewNewtError(err.Error())
+		}
+	}
+
+	dl := r.downloader
+	dl.SetBranch("master")
+	if err := dl.FetchFile(PKG_INDEX_FILE_NAME,
+		r.packageIndexPath()); err != nil {
+
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"No package index for repository %s\n", r.Name())
+		os.Remove(r.packageIndexPath())
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Reads the most recently downloaded package index.
+func (r *Repo) ReadPackageIndex() ([]*PackageIndexEntry, error) {
+	if util.NodeNotExist(r.packageIndexPath()) {
+		return nil, nil
+	}
+
+	v, err := util.ReadConfig(r.repoFilePath(),
+		strings.TrimSuffix(PKG_INDEX_FILE_NAME, ".yml"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*PackageIndexEntry{}
+	for name, itf := range cast.ToStringMap(v.Get("packages")) {
+		fields := cast.ToStringMap(itf)
+		entries = append(entries, &PackageIndexEntry{
+			Name:        name,
+			Type:        cast.ToString(fields["type"]),
+			Description: cast.ToString(fields["description"]),
+			Keywords:    cast.ToStringSlice(fields["keywords"]),
+			Apis:        cast.ToStringSlice(fields["apis"]),
+		})
+	}
+
+	return entries, nil
+}
@@ -20,12 +20,12 @@
 package repo
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/spf13/cast"
@@ -50,11 +50,18 @@ type Repo struct {
 	localPath  string
 	versreq    []interfaces.VersionReqInterface
 	rdesc      *RepoDesc
+	descV      *viper.Viper
+	selVers    *Version
 	deps       []*RepoDependency
 	ignDirs    []string
 	updated    bool
 	local      bool
 	ncMap      compat.NewtCompatMap
+
+	// Workspace overrides: a working tree used in place of the installed
+	// repo, or a branch checked out in place of the version's branch.
+	pathOverride   bool
+	branchOverride string
 }
 
 type RepoDesc struct {
@@ -157,46 +164,6 @@ func NewRepoDependency(rname string, verstr string) (*RepoDependency, error) {
 	return rd, nil
 }
 
-func CheckDeps(upgrade bool, checkRepos map[string]*Repo) error {
-	// For each dependency, get it's version
-	depArray := map[string][]*Version{}
-
-	for _, checkRepo := range checkRepos {
-		for _, rd := range checkRepo.Deps() {
-			lookupRepo := checkRepos[rd.Name()]
-
-			_, vers, ok := lookupRepo.rdesc.Match(rd.Storerepo)
-			if !ok {
-				return util.NewNewtError(fmt.Sprintf("No "+
-					"matching version for dependent repository %s", rd.name))
-			}
-			log.Debugf("Dependency for %s: %s (%s)", checkRepo.Name(), rd.Name(), vers.String())
-
-			_, ok = depArray[rd.Name()]
-			if !ok {
-				depArray[rd.Name()] = []*Version{}
-			}
-			depArray[rd.Name()] = append(depArray[rd.Name()], vers)
-		}
-	}
-
-	for repoName, depVersList := range depArray {
-		for _, depVers := range depVersList {
-			for _, curVers := range depVersList {
-				if depVers.CompareVersions(depVers, curVers) != 0 ||
-					depVers.Stability() != curVers.Stability() {
-					return util.NewNewtError(fmt.Sprintf(
-						"Conflict detected.  Repository %s has multiple dependency versions on %s. "+
-							"Notion of repository version is %s, whereas required is %s ",
-						repoName, curVers, depVers))
-				}
-			}
-		}
-	}
-
-	return nil
-}
-
 func (rd *RepoDesc) MatchVersion(searchVers *Version) (string, *Version, bool) {
 	for vers, curBranch := range rd.vers {
 		if vers.CompareVersions(vers, searchVers) == 0 &&
@@ -208,6 +175,10 @@ func (rd *RepoDesc) MatchVersion(searchVers *Version) (string, *Version, bool) {
 }
 
 func (rd *RepoDesc) Match(r *Repo) (string, *Version, bool) {
+	if r.selVers != nil {
+		return rd.MatchVersion(r.selVers)
+	}
+
 	for vers, branch := range rd.vers {
 		log.Debugf("Repository version requires for %s are %s\n", r.Name(), r.VersionRequirements())
 		if vers.SatisfiesVersion(r.VersionRequirements()) {
@@ -328,6 +299,46 @@ func (r *Repo) IsLocal() bool {
 	return r.local
 }
 
+// Fixes the version of the repository that gets installed, overriding the
+// repository's version requirements.  This is used to apply the result of
+// dependency resolution.
+func (r *Repo) SelectVersion(vers *Version) {
+	r.selVers = vers
+}
+
+func (r *Repo) SelectedVersion() *Version {
+	return r.selVers
+}
+
+// Uses the working tree at the specified path in place of the installed
+// repo.  Newt never modifies an overridden working tree.
+func (r *Repo) SetPathOverride(path string) {
+	r.localPath = filepath.ToSlash(filepath.Clean(path))
+	r.pathOverride = true
+}
+
+func (r *Repo) PathOverridden() bool {
+	return r.pathOverride
+}
+
+// Checks out the specified branch in place of the branch that the selected
+// version maps to.
+func (r *Repo) SetBranchOverride(branch string) {
+	r.branchOverride = branch
+}
+
+func (r *Repo) BranchOverride() string {
+	return r.branchOverride
+}
+
+// Applies the branch override, if any, to the branch that a version maps to.
+func (r *Repo) checkoutBranch(branchName string) string {
+	if r.branchOverride != "" {
+		return r.branchOverride
+	}
+	return branchName
+}
+
 func (r *Repo) VersionRequirements() []interfaces.VersionReqInterface {
 	return r.versreq
 }
@@ -394,42 +405,123 @@ func (r *Repo) cleanupRepo(branchName string) error {
 	return nil
 }
 
-func (r *Repo) saveLocalDiff() (string, error) {
+func (r *Repo) currentBranch() (string, error) {
 	dl := r.downloader
-	diff, err := dl.LocalDiff(r.Path())
+	branch, err := dl.CurrentBranch(r.Path())
 	if err != nil {
-		return "", util.NewNewtError(fmt.Sprintf(
-			"Error creating diff for \"%s\" : %s", r.Name(), err.Error()))
+		return "", util.NewNewtError(fmt.Sprintf("Error finding current branch for \"%s\" : %s",
+			r.Name(), err.Error()))
 	}
+	return filepath.Base(branch), nil
+}
 
-	// NOTE: date was not a typo: https://golang.org/pkg/time/#Time.Format
-	timenow := time.Now().Format("20060102_150405")
-	filename := r.patchesFilePath() + r.Name() + "_" + timenow + ".diff"
-
-	f, err := os.Create(filename)
+// Retrieves the SHA of the commit currently checked out in the repo.
+func (r *Repo) CurrentCommit() (string, error) {
+	commit, err := r.downloader.CurrentCommit(r.Path())
 	if err != nil {
-		return "", util.NewNewtError(fmt.Sprintf(
-			"Error creating repo diff file \"%s\"", filename))
+		return "", util.FmtNewtError(
+			"Error finding current commit for \"%s\" : %s",
+			r.Name(), err.Error())
 	}
-	defer f.Close()
+	return commit, nil
+}
 
-	_, err = f.Write(diff)
+// Calculates the SHA256 of the repo's most recently downloaded
+// repository.yml file.
+func (r *Repo) DescHash() (string, error) {
+	contents, err := ioutil.ReadFile(r.repoFilePath() + REPO_FILE_NAME)
 	if err != nil {
-		return "", util.NewNewtError(fmt.Sprintf(
-			"Error writing repo diff file \"%s\"", filename))
+		return "", util.NewNewtError(err.Error())
 	}
 
-	return filename, nil
+	return fmt.Sprintf("%x", sha256.Sum256(contents)), nil
 }
 
-func (r *Repo) currentBranch() (string, error) {
-	dl := r.downloader
-	branch, err := dl.CurrentBranch(r.Path())
+// Copies the repo's remote into a bare mirror repository.  A warning is
+// displayed for each version in repository.yml whose branch or tag is missing
+// from the mirror.
+func (r *Repo) Mirror(dst string) error {
+	if err := downloader.Mirror(r.downloader, dst); err != nil {
+		return util.FmtNewtError("Failed to mirror repository %s: %s",
+			r.Name(), err.Error())
+	}
+
+	if r.rdesc == nil {
+		return nil
+	}
+
+	branches := []string{}
+	for _, branch := range r.rdesc.vers {
+		branches = append(branches, branch)
+	}
+	for _, branch := range util.SortFields(util.UniqueStrings(branches)...) {
+		if !downloader.MirrorHasRef(dst, branch) {
+			// Some versions map to other versions rather than branches.
+			if _, err := LoadVersion(branch); err == nil {
+				continue
+			}
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"WARNING: Branch %s of repository %s not found in mirror\n",
+				branch, r.Name())
+		}
+	}
+
+	return nil
+}
+
+// Brings an installed repo up to date with the branch corresponding to the
+// specified version.  Local changes are preserved.
+func (r *Repo) Update(vers *Version) error {
+	branchName, _, found := r.rdesc.MatchVersion(vers)
+	if !found {
+		return util.FmtNewtError("Branch description for %s not found",
+			r.Name())
+	}
+
+	return r.updateRepo(r.checkoutBranch(branchName))
+}
+
+// Installs the repo with the specified commit checked out.  If the repo is
+// already installed, the commit is fetched and checked out in place; local
+// changes are preserved.  If that fails and force is specified, the repo is
+// downloaded again.
+func (r *Repo) InstallCommit(commit string, force bool) error {
+	if r.checkExists() {
+		if cur, err := r.CurrentCommit(); err == nil && cur == commit {
+			return nil
+		}
+
+		if err := r.updateRepo(commit); err != nil {
+			if !force {
+				return util.FmtNewtError(
+					"Failed to check out commit %s of repository %s; "+
+						"provide the -f option to download it again",
+					commit, r.Name())
+			}
+
+			if err := os.RemoveAll(r.Path()); err != nil {
+				return util.NewNewtError(err.Error())
+			}
+		}
+	}
+
+	if !r.checkExists() {
+		if err := r.downloadRepo(commit); err != nil {
+			return err
+		}
+	}
+
+	cur, err := r.CurrentCommit()
 	if err != nil {
-		return "", util.NewNewtError(fmt.Sprintf("Error finding current branch for \"%s\" : %s",
-			r.Name(), err.Error()))
+		return err
 	}
-	return filepath.Base(branch), nil
+	if cur != commit {
+		return util.FmtNewtError(
+			"Repository %s is at commit %s after install; expected %s",
+			r.Name(), cur, commit)
+	}
+
+	return nil
 }
 
 func (r *Repo) Install(force bool) (*Version, error) {
@@ -445,6 +537,7 @@ func (r *Repo) Install(force bool) (*Version, error) {
 		return nil, util.NewNewtError(fmt.Sprintf("No repository matching description %s found",
 			r.rdesc.String()))
 	}
+	branchName = r.checkoutBranch(branchName)
 
 	// if the repo is already cloned, try to cleanup and checkout the requested branch
 	if exists {
@@ -467,88 +560,11 @@ func (r *Repo) Install(force bool) (*Version, error) {
 	return vers, nil
 }
 
-func (r *Repo) Sync(vers *Version, force bool) (bool, bool, error) {
-	var exists bool
-	var err error
-	var currBranch string
-
-	exists = r.checkExists()
-
-	// Update the repo description
-	if _, updated, err := r.UpdateDesc(); updated != true || err != nil {
-		return exists, false, util.NewNewtError("Cannot update repository description.")
-	}
-
-	branchName, _, found := r.rdesc.MatchVersion(vers)
-	if found == false {
-		return exists, false, util.NewNewtError(fmt.Sprintf(
-			"Branch description for %s not found", r.Name()))
-	}
-
-	if exists {
-		// Here assuming that if the branch was changed by the user,
-		// the user must know what he's doing...
-		// but, if -f is passed let's just save the work and re-clone
-		currBranch, err = r.currentBranch()
-
-		// currBranch == HEAD means we're dettached from HEAD, so
-		// ignore and move to "new" tag
-		if err != nil {
-			return exists, false, err
-		} else if currBranch != "HEAD" && currBranch != branchName {
-			msg := "Unexpected local branch for %s: \"%s\" != \"%s\"\n"
-			if force {
-				util.StatusMessage(util.VERBOSITY_VERBOSE,
-					msg, r.rdesc.name, currBranch, branchName)
-			} else {
-				err = util.NewNewtError(
-					fmt.Sprintf(msg, r.rdesc.name, currBranch, branchName))
-				return exists, false, err
-			}
-		}
-
-		// Don't try updating if on an invalid branch...
-		if currBranch == "HEAD" || currBranch == branchName {
-			util.StatusMessage(util.VERBOSITY_VERBOSE, "Updating repository...\n")
-			err = r.updateRepo(branchName)
-			if err == nil {
-				util.StatusMessage(util.VERBOSITY_VERBOSE, "Update successful!\n")
-				return exists, true, err
-			} else {
-				util.StatusMessage(util.VERBOSITY_VERBOSE, "Update failed!\n")
-				if !force {
-					return exists, false, err
-				}
-			}
-		}
-
-		filename, err := r.saveLocalDiff()
-		if err != nil {
-			return exists, false, err
-		}
-		wd, _ := os.Getwd()
-		filename, _ = filepath.Rel(wd, filename)
-
-		util.StatusMessage(util.VERBOSITY_DEFAULT, "Saved local diff: "+
-			"\"%s\"\n", filename)
-
-		err = r.cleanupRepo(branchName)
-		if err != nil {
-			return exists, false, err
-		}
-
-	} else {
-		// fresh or updating was unsuccessfull and force was given...
-		err = r.downloadRepo(branchName)
-		if err != nil {
-			return exists, false, err
-		}
-	}
-
-	return exists, true, nil
-}
-
-func (r *Repo) UpdateDesc() ([]*Repo, bool, error) {
+// Downloads and reads the repository description.  Unless the dependency
+// solver selects the repository's version (solving), the lack of a branch
+// that satisfies the project's requirements is an error.  The solver explains
+// such conflicts itself.
+func (r *Repo) UpdateDesc(solving bool) ([]*Repo, bool, error) {
 	var err error
 
 	if r.updated {
@@ -561,7 +577,7 @@ func (r *Repo) UpdateDesc() ([]*Repo, bool, error) {
 		return nil, false, err
 	}
 
-	_, repos, err := r.ReadDesc()
+	_, repos, err := r.readDesc(solving)
 	if err != nil {
 		fmt.Printf("ReadDesc: %v\n", err)
 		return nil, false, err
@@ -607,12 +623,18 @@ func (r *Repo) DownloadDesc() error {
 	return nil
 }
 
-func (r *Repo) readDepRepos(v *viper.Viper) ([]*Repo, error) {
+func (r *Repo) readDepRepos(v *viper.Viper, solving bool) ([]*Repo, error) {
 	rdesc := r.rdesc
 	repos := []*Repo{}
 
 	branch, _, ok := rdesc.Match(r)
 	if !ok {
+		if solving {
+			// The dependency solver reports the conflict.
+			log.Debugf("No matching branch for %s repo", r.Name())
+			return repos, nil
+		}
+
 		// No matching branch, barf!
 		return nil, util.NewNewtError(fmt.Sprintf("No "+
 			"matching branch for %s repo", r.Name()))
@@ -649,6 +671,10 @@ func (r *Repo) readDepRepos(v *viper.Viper) ([]*Repo, error) {
 }
 
 func (r *Repo) ReadDesc() (*RepoDesc, []*Repo, error) {
+	return r.readDesc(false)
+}
+
+func (r *Repo) readDesc(solving bool) (*RepoDesc, []*Repo, error) {
 	if util.NodeNotExist(r.repoFilePath() + REPO_FILE_NAME) {
 		return nil, nil,
 			util.NewNewtError("No configuration exists for repository " + r.name)
@@ -668,8 +694,9 @@ func (r *Repo) ReadDesc() (*RepoDesc, []*Repo, error) {
 		return nil, nil, err
 	}
 	r.rdesc = rdesc
+	r.descV = v
 
-	repos, err := r.readDepRepos(v)
+	repos, err := r.readDepRepos(v, solving)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -0,0 +1,367 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/util"
+)
+
+// A version requirement that the project or a specific version of a
+// repository places on another repository.
+type RepoRequirement struct {
+	// Name and version of the requiring repository.  Depender is "" if the
+	// requirement comes from the project.
+	Depender     string
+	DependerVers *Version
+
+	Dependee string
+	Reqs     []interfaces.VersionReqInterface
+}
+
+// Creates a repository object for a repository that is first encountered as
+// a dependency of another repository.  The repository's description must be
+// downloaded before the function returns.
+type NewDepRepoFn func(name string, repoVars map[string]string) (*Repo, error)
+
+// Formats a version the way it is written in configuration files (e.g.,
+// "1.2.0" or "1-latest").
+func versString(vers *Version) string {
+	if vers.Stability() == VERSION_STABILITY_NONE {
+		return fmt.Sprintf("%d.%d.%d", vers.Major(), vers.Minor(),
+			vers.Revision())
+	}
+
+	str := fmt.Sprintf("%d.%d.%d", vers.Major(), vers.Minor(),
+		vers.Revision())
+	str = strings.TrimSuffix(strings.TrimSuffix(str, ".0"), ".0")
+	return str + "-" + vers.Stability()
+}
+
+func versReqString(reqs []interfaces.VersionReqInterface) string {
+	if len(reqs) == 0 {
+		return "(any version)"
+	}
+
+	parts := make([]string, len(reqs))
+	for i, req := range reqs {
+		vers := req.Version().(*Version)
+		if vers.Stability() != VERSION_STABILITY_NONE {
+			// Stability requirements (e.g., "1-latest") are always exact.
+			parts[i] = versString(vers)
+		} else {
+			parts[i] = req.CompareType() + versString(vers)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (req *RepoRequirement) String() string {
+	var depender string
+	if req.Depender == "" {
+		depender = "project"
+	} else {
+		depender = fmt.Sprintf("repo %s %s", req.Depender,
+			versString(req.DependerVers))
+	}
+
+	return fmt.Sprintf("%s requires %s %s", depender, req.Dependee,
+		versReqString(req.Reqs))
+}
+
+type versSorter struct {
+	vers []*Version
+}
+
+func (s versSorter) Len() int {
+	return len(s.vers)
+}
+func (s versSorter) Swap(i, j int) {
+	s.vers[i], s.vers[j] = s.vers[j], s.vers[i]
+}
+func (s versSorter) Less(i, j int) bool {
+	// Newest first.
+	return s.vers[i].CompareVersions(s.vers[i], s.vers[j]) > 0
+}
+
+// Retrieves the concrete versions of a repository, newest first.  Versions
+// with a stability (e.g., "1-latest") are aliases and are not included.
+func (rd *RepoDesc) concreteVersions() []*Version {
+	vers := []*Version{}
+	for v, _ := range rd.vers {
+		if v.Stability() == VERSION_STABILITY_NONE {
+			vers = append(vers, v)
+		}
+	}
+	sort.Sort(versSorter{vers})
+
+	return vers
+}
+
+// Retrieves the dependencies declared by the specified version of a
+// repository, keyed by repository name.
+func (r *Repo) versionDeps(vers *Version) map[string]map[string]string {
+	deps := map[string]map[string]string{}
+	if r.descV == nil {
+		return deps
+	}
+
+	branch, _, ok := r.rdesc.MatchVersion(vers)
+	if !ok {
+		return deps
+	}
+
+	for name, itf := range r.descV.GetStringMap(branch + ".repositories") {
+		deps[name] = cast.ToStringMapString(itf)
+	}
+
+	return deps
+}
+
+type depSolver struct {
+	repos     map[string]*Repo
+	newRepo   NewDepRepoFn
+	preferred map[string]*Version
+
+	// Explanations of each distinct conflict encountered, in order.
+	conflicts []string
+}
+
+func (s *depSolver) addConflict(conflict string) {
+	for _, c := range s.conflicts {
+		if c == conflict {
+			return
+		}
+	}
+	s.conflicts = append(s.conflicts, conflict)
+}
+
+// Filters a repository's versions down to those that satisfy every
+// requirement.  Preferred versions are placed first.
+func (s *depSolver) candidates(r *Repo, reqs []*RepoRequirement) []*Version {
+	cands := []*Version{}
+	for _, v := range r.rdesc.concreteVersions() {
+		ok := true
+		for _, req := range reqs {
+			if !r.rdesc.SatisfiesVersion(v, req.Reqs) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			cands = append(cands, v)
+		}
+	}
+
+	if pref := s.preferred[r.Name()]; pref != nil {
+		for i, v := range cands {
+			if v.CompareVersions(v, pref) == 0 {
+				cands = append([]*Version{v},
+					append(cands[:i:i], cands[i+1:]...)...)
+				break
+			}
+		}
+	}
+
+	return cands
+}
+
+// Produces a minimal explanation of why no version of a repository satisfies
+// a set of requirements: a single unsatisfiable requirement if there is one,
+// otherwise a pair of incompatible requirements.
+func (s *depSolver) explain(r *Repo, reqs []*RepoRequirement) string {
+	avail := []string{}
+	for _, v := range r.rdesc.concreteVersions() {
+		avail = append(avail, versString(v))
+	}
+
+	for _, req := range reqs {
+		if len(s.candidates(r, []*RepoRequirement{req})) == 0 {
+			return fmt.Sprintf("%s, but no such version exists "+
+				"(available: %s)", req.String(), strings.Join(avail, ", "))
+		}
+	}
+
+	for i, a := range reqs {
+		for _, b := range reqs[i+1:] {
+			if len(s.candidates(r, []*RepoRequirement{a, b})) == 0 {
+				return fmt.Sprintf("%s but %s", a.String(), b.String())
+			}
+		}
+	}
+
+	strs := make([]string, len(reqs))
+	for i, req := range reqs {
+		strs[i] = req.String()
+	}
+	return "no version of " + r.Name() + " satisfies all of: " +
+		strings.Join(strs, "; ")
+}
+
+func (s *depSolver) solve(reqs map[string][]*RepoRequirement,
+	assign map[string]*Version) (map[string]*Version, error) {
+
+	// Choose the next unassigned repository in alphabetical order.
+	names := []string{}
+	for name, _ := range reqs {
+		if assign[name] == nil {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return assign, nil
+	}
+	sort.Strings(names)
+	name := names[0]
+
+	r := s.repos[name]
+	if r == nil || r.rdesc == nil {
+		return nil, util.FmtNewtError(
+			"No description available for repository %s", name)
+	}
+
+	cands := s.candidates(r, reqs[name])
+	if len(cands) == 0 {
+		s.addConflict(s.explain(r, reqs[name]))
+	}
+
+	for _, vers := range cands {
+		log.Debugf("Trying %s %s", name, versString(vers))
+
+		newAssign := map[string]*Version{}
+		for n, v := range assign {
+			newAssign[n] = v
+		}
+		newAssign[name] = vers
+
+		newReqs := map[string][]*RepoRequirement{}
+		for n, rs := range reqs {
+			newReqs[n] = rs
+		}
+
+		deps := r.versionDeps(vers)
+		depNames := make([]string, 0, len(deps))
+		for depName, _ := range deps {
+			depNames = append(depNames, depName)
+		}
+		sort.Strings(depNames)
+
+		consistent := true
+		for _, depName := range depNames {
+			repoVars := deps[depName]
+			versreq, err := LoadVersionMatches(repoVars["vers"])
+			if err != nil {
+				return nil, err
+			}
+
+			if s.repos[depName] == nil {
+				depRepo, err := s.newRepo(depName, repoVars)
+				if err != nil {
+					return nil, err
+				}
+				s.repos[depName] = depRepo
+			}
+
+			req := &RepoRequirement{
+				Depender:     name,
+				DependerVers: vers,
+				Dependee:     depName,
+				Reqs:         versreq,
+			}
+			newReqs[depName] = append(
+				append([]*RepoRequirement{}, newReqs[depName]...), req)
+
+			// A dependency on an already-chosen version must be satisfied
+			// by that version.
+			if depVers := newAssign[depName]; depVers != nil &&
+				!s.repos[depName].rdesc.SatisfiesVersion(depVers, versreq) {
+
+				s.addConflict(s.explain(s.repos[depName], newReqs[depName]))
+				consistent = false
+				break
+			}
+		}
+		if !consistent {
+			continue
+		}
+
+		solution, err := s.solve(newReqs, newAssign)
+		if err != nil {
+			return nil, err
+		}
+		if solution != nil {
+			return solution, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Selects a version for every repository that the project depends on,
+// directly or indirectly.  The newest versions that satisfy every requirement
+// are chosen; a preferred version (e.g., the currently installed one) is
+// chosen over newer versions if it satisfies every requirement.  On failure,
+// the returned error explains each conflict.  Repositories created by newRepo
+// are added to the repos map.
+//
+// @param rootReqs              The project's requirements.
+// @param repos                 All known repositories, keyed by name.
+// @param preferred             Preferred versions, keyed by repository name.
+// @param newRepo               Creates newly encountered repositories.
+//
+// @return                      The selected versions, keyed by repo name.
+func SolveDeps(rootReqs []*RepoRequirement, repos map[string]*Repo,
+	preferred map[string]*Version,
+	newRepo NewDepRepoFn) (map[string]*Version, error) {
+
+	s := &depSolver{
+		repos:     repos,
+		newRepo:   newRepo,
+		preferred: preferred,
+	}
+
+	reqs := map[string][]*RepoRequirement{}
+	for _, req := range rootReqs {
+		reqs[req.Dependee] = append(reqs[req.Dependee], req)
+	}
+
+	solution, err := s.solve(reqs, map[string]*Version{})
+	if err != nil {
+		return nil, err
+	}
+	if solution == nil {
+		return nil, util.FmtNewtError(
+			"Cannot satisfy repository dependencies:\n    %s",
+			strings.Join(s.conflicts, "\n    "))
+	}
+
+	for name, vers := range solution {
+		log.Debugf("Selected %s %s", name, versString(vers))
+	}
+
+	return solution, nil
+}
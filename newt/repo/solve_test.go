@@ -0,0 +1,194 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/viper"
+)
+
+// Creates a repository from the contents of its repository.yml file.
+func testRepo(t *testing.T, name string, yml string) *Repo {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(yml)); err != nil {
+		t.Fatalf("repo %s: %s", name, err.Error())
+	}
+
+	rdesc, err := NewRepoDesc(name, v.GetStringMapString("repo.versions"))
+	if err != nil {
+		t.Fatalf("repo %s: %s", name, err.Error())
+	}
+
+	return &Repo{
+		name:  name,
+		rdesc: rdesc,
+		descV: v,
+	}
+}
+
+func testReq(t *testing.T, dependee string, versStr string) *RepoRequirement {
+	reqs, err := LoadVersionMatches(versStr)
+	if err != nil {
+		t.Fatalf("requirement %s %s: %s", dependee, versStr, err.Error())
+	}
+
+	return &RepoRequirement{
+		Dependee: dependee,
+		Reqs:     reqs,
+	}
+}
+
+func testSolve(t *testing.T, repos map[string]*Repo,
+	rootReqs ...*RepoRequirement) (map[string]*Version, error) {
+
+	newRepo := func(name string, repoVars map[string]string) (*Repo, error) {
+		t.Fatalf("unexpected new repo: %s", name)
+		return nil, nil
+	}
+
+	return SolveDeps(rootReqs, repos, nil, newRepo)
+}
+
+func expectVersion(t *testing.T, solution map[string]*Version, name string,
+	expected string) {
+
+	vers := solution[name]
+	if vers == nil {
+		t.Fatalf("no version selected for %s", name)
+	}
+	if versString(vers) != expected {
+		t.Errorf("%s: expected version %s, got %s", name, expected,
+			versString(vers))
+	}
+}
+
+func TestSolveNewestCompatible(t *testing.T) {
+	repos := map[string]*Repo{
+		// 1.2.0 depends on a version of b that does not exist, so the solver
+		// must fall back to 1.1.0.
+		"a": testRepo(t, "a", `
+repo.versions:
+    "1.0.0": v1_0
+    "1.1.0": v1_1
+    "1.2.0": v1_2
+    "2.0.0": v2_0
+v1_1.repositories:
+    b:
+        type: git
+        url: /b.git
+        vers: ">=1.0.0"
+v1_2.repositories:
+    b:
+        type: git
+        url: /b.git
+        vers: ">=3.0.0"
+`),
+		"b": testRepo(t, "b", `
+repo.versions:
+    "1.0.0": v1_0
+    "1.5.0": v1_5
+    "2.0.0": v2_0
+`),
+	}
+
+	solution, err := testSolve(t, repos, testReq(t, "a", ">=1.0.0 <2.0.0"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	expectVersion(t, solution, "a", "1.1.0")
+	expectVersion(t, solution, "b", "2.0.0")
+}
+
+func TestSolveStability(t *testing.T) {
+	yml := `
+repo.versions:
+    "0.0.0": master
+    "1.0.0": v1_0
+    "1.1.0": v1_1
+    "0-dev": "0.0.0"
+    "1-latest": "1.1.0"
+    "1-stable": "1.0.0"
+`
+
+	tests := []struct {
+		req      string
+		expected string
+	}{
+		{"1-stable", "1.0.0"},
+		{"1-latest", "1.1.0"},
+		{"0-dev", "0.0.0"},
+	}
+
+	for _, test := range tests {
+		repos := map[string]*Repo{"a": testRepo(t, "a", yml)}
+
+		solution, err := testSolve(t, repos, testReq(t, "a", test.req))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.req, err.Error())
+		}
+
+		expectVersion(t, solution, "a", test.expected)
+	}
+}
+
+func TestSolveConflictExplanation(t *testing.T) {
+	repos := map[string]*Repo{
+		"a": testRepo(t, "a", `
+repo.versions:
+    "1.0.0": v1_0
+v1_0.repositories:
+    c:
+        type: git
+        url: /c.git
+        vers: "==1.0.0"
+`),
+		"b": testRepo(t, "b", `
+repo.versions:
+    "1.0.0": v1_0
+v1_0.repositories:
+    c:
+        type: git
+        url: /c.git
+        vers: "==2.0.0"
+`),
+		"c": testRepo(t, "c", `
+repo.versions:
+    "1.0.0": v1_0
+    "2.0.0": v2_0
+`),
+	}
+
+	_, err := testSolve(t, repos,
+		testReq(t, "a", ">=1.0.0"), testReq(t, "b", ">=1.0.0"))
+	if err == nil {
+		t.Fatalf("expected a conflict")
+	}
+
+	expected := "repo a 1.0.0 requires c ==1.0.0 but " +
+		"repo b 1.0.0 requires c ==2.0.0"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected explanation \"%s\", got \"%s\"", expected,
+			err.Error())
+	}
+}
@@ -0,0 +1,163 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"strings"
+
+	"mynewt.apache.org/newt/newt/compat"
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// Describes the state of an installed repository's working tree relative to
+// the version recorded in the project state.
+type RepoStatus struct {
+	Name      string
+	Path      string
+	Required  string
+	Installed *Version
+
+	// False if the repo directory does not exist; the remaining fields are
+	// only populated if the repo exists.
+	Exists bool
+
+	// Branch checked out in the working tree; "HEAD" if detached.
+	Branch string
+	Commit string
+	Dirty  bool
+
+	// True if the working tree contains changes made by downstream patches.
+	// These changes do not make the tree dirty.
+	Patched bool
+
+	// Branch that the installed version maps to, and the number of commits
+	// the working tree is ahead of / behind it.  Ahead and behind are -1 if
+	// they could not be determined.
+	VersBranch string
+	Ahead      int
+	Behind     int
+
+	CompatCode compat.NewtCompatCode
+	CompatMsg  string
+
+	// Workspace override in effect, if any; see Repo.SetPathOverride and
+	// Repo.SetBranchOverride.
+	PathOverride   bool
+	BranchOverride string
+}
+
+// Indicates whether the working tree differs from the installed version in
+// any way.
+func (rs *RepoStatus) Drifted() bool {
+	return rs.Dirty || rs.Ahead > 0 || rs.Behind > 0 ||
+		(rs.VersBranch != "" && rs.Branch != "HEAD" &&
+			rs.Branch != rs.VersBranch)
+}
+
+// Inspects a repository's working tree.  This function does not access the
+// network; ahead / behind counts are relative to the most recent fetch.
+//
+// @param vers                  The installed version; nil if not installed.
+// @param patched               Files modified by applied downstream patches.
+func (r *Repo) Status(vers *Version, patched []string) (*RepoStatus, error) {
+	rs := &RepoStatus{
+		Name:       r.Name(),
+		Path:       r.Path(),
+		Required:   versReqString(r.VersionRequirements()),
+		Installed:  vers,
+		Ahead:      -1,
+		Behind:     -1,
+		CompatCode: compat.NEWT_COMPAT_GOOD,
+
+		PathOverride:   r.pathOverride,
+		BranchOverride: r.branchOverride,
+	}
+
+	if vers != nil {
+		rs.CompatCode, rs.CompatMsg = r.CheckNewtCompatibility(vers,
+			newtutil.NewtVersion)
+	}
+
+	if !r.checkExists() {
+		return rs, nil
+	}
+	rs.Exists = true
+
+	var err error
+	if rs.Branch, err = r.currentBranch(); err != nil {
+		return nil, err
+	}
+	if rs.Commit, err = r.CurrentCommit(); err != nil {
+		return nil, err
+	}
+
+	if len(patched) == 0 {
+		diff, err := r.downloader.LocalDiff(r.Path())
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"Error checking local changes in \"%s\": %s", r.Name(),
+				err.Error())
+		}
+		rs.Dirty = strings.TrimSpace(string(diff)) != ""
+	} else {
+		changed, err := downloader.ChangedFiles(r.Path())
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"Error checking local changes in \"%s\": %s", r.Name(),
+				err.Error())
+		}
+		unpatched := excludeFiles(changed, patched)
+		rs.Patched = len(unpatched) < len(changed)
+		rs.Dirty = len(unpatched) > 0
+	}
+
+	if vers != nil && r.rdesc != nil {
+		if branch, _, ok := r.rdesc.MatchVersion(vers); ok {
+			branch = r.checkoutBranch(branch)
+			rs.VersBranch = branch
+			ahead, behind, err := downloader.AheadBehind(r.Path(), branch)
+			if err == nil {
+				rs.Ahead = ahead
+				rs.Behind = behind
+			}
+		}
+	}
+
+	return rs, nil
+}
+
+// Removes the specified files from a list of files.
+func excludeFiles(files []string, exclude []string) []string {
+	excluded := make(map[string]bool, len(exclude))
+	for _, f := range exclude {
+		excluded[f] = true
+	}
+
+	rest := []string{}
+	for _, f := range files {
+		if !excluded[f] {
+			rest = append(rest, f)
+		}
+	}
+
+	return rest
+}
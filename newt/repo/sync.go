@@ -0,0 +1,262 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"fmt"
+	"time"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/util"
+)
+
+// Controls how a sync treats local work (commits, uncommitted changes, and
+// untracked files) in an installed repository.
+type SyncOptions struct {
+	// Save local work to named refs and check out the new version.
+	Force bool
+
+	// Rebase local commits onto the new version.
+	Rebase bool
+
+	// Only print the sync plan.
+	DryRun bool
+
+	// Files modified by downstream patches that remain applied during the
+	// sync; changes to them are not treated as local work.
+	PatchedFiles []string
+}
+
+// A single step of a sync.
+type syncStep struct {
+	desc string
+	fn   func() error
+}
+
+func pluralize(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, noun)
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
+
+func localWorkString(lw *downloader.LocalWork) string {
+	return fmt.Sprintf("%s, %s, %s",
+		pluralize(len(lw.Commits), "local commit"),
+		pluralize(len(lw.Modified), "modified file"),
+		pluralize(len(lw.Untracked), "untracked file"))
+}
+
+// Determines the steps required to bring an installed repo up to date with
+// the branch that the specified version maps to.  Local work is never
+// discarded: without the force or rebase options, a sync that would lose
+// local work is refused.
+func (r *Repo) syncPlan(branchName string,
+	opts SyncOptions) ([]syncStep, error) {
+
+	path := r.Path()
+
+	currBranch, err := r.currentBranch()
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := downloader.ResolveRef(path, branchName)
+	if err != nil {
+		return nil, err
+	}
+
+	lw, err := downloader.FindLocalWork(path, ref)
+	if err != nil {
+		return nil, err
+	}
+	lw.Modified = excludeFiles(lw.Modified, opts.PatchedFiles)
+	lw.Untracked = excludeFiles(lw.Untracked, opts.PatchedFiles)
+
+	// A detached HEAD is the result of a locked install; it is not a
+	// user-selected branch.
+	wrongBranch := currBranch != "HEAD" && currBranch != branchName
+
+	// NOTE: date was not a typo: https://golang.org/pkg/time/#Time.Format
+	timenow := time.Now().Format("20060102_150405")
+	syncRef := "refs/newt/sync/" + timenow
+	stashRef := "refs/newt/stash/" + timenow
+
+	stashStep := syncStep{
+		desc: fmt.Sprintf("stash %s and %s to %s",
+			pluralize(len(lw.Modified), "modified file"),
+			pluralize(len(lw.Untracked), "untracked file"), stashRef),
+		fn: func() error { return downloader.StashAll(path, stashRef) },
+	}
+	saveStep := syncStep{
+		desc: fmt.Sprintf("save current commit (%s) to %s", currBranch,
+			syncRef),
+		fn: func() error {
+			return downloader.SaveRef(path, syncRef, "HEAD")
+		},
+	}
+	checkoutStep := syncStep{
+		desc: fmt.Sprintf("check out %s as branch %s", ref, branchName),
+		fn: func() error {
+			return downloader.CheckoutBranch(path, branchName, ref)
+		},
+	}
+
+	steps := []syncStep{}
+	switch {
+	case lw.IsEmpty() && !wrongBranch:
+		steps = append(steps, checkoutStep)
+
+	case opts.Rebase && !wrongBranch:
+		if lw.HasChanges() {
+			steps = append(steps, stashStep)
+		}
+		steps = append(steps, saveStep)
+		steps = append(steps, syncStep{
+			desc: fmt.Sprintf("rebase %s onto %s",
+				pluralize(len(lw.Commits), "local commit"), ref),
+			fn: func() error {
+				if err := downloader.Rebase(path, ref); err != nil {
+					msg := fmt.Sprintf("Rebase of %s failed; local commits "+
+						"remain at %s and %s", r.Name(), currBranch, syncRef)
+					if lw.HasChanges() {
+						if err := downloader.StashPop(path); err != nil {
+							msg += fmt.Sprintf("; local changes remain at %s",
+								stashRef)
+						}
+					}
+					return util.NewNewtError(msg)
+				}
+				return nil
+			},
+		})
+		if lw.HasChanges() {
+			steps = append(steps, syncStep{
+				desc: "restore stashed changes",
+				fn:   func() error { return downloader.StashPop(path) },
+			})
+		}
+
+	case opts.Force:
+		if lw.HasChanges() {
+			steps = append(steps, stashStep)
+		}
+		if len(lw.Commits) > 0 || wrongBranch {
+			steps = append(steps, saveStep)
+		}
+		if wrongBranch {
+			// Checking out the version's branch resets it; preserve any
+			// commits that only exist on it.
+			branchCommits, err := downloader.BranchCommits(path, branchName,
+				ref)
+			if err != nil {
+				return nil, err
+			}
+			if len(branchCommits) > 0 {
+				branchRef := syncRef + "_" + branchName
+				steps = append(steps, syncStep{
+					desc: fmt.Sprintf("save %s on branch %s to %s",
+						pluralize(len(branchCommits), "local commit"),
+						branchName, branchRef),
+					fn: func() error {
+						return downloader.SaveRef(path, branchRef,
+							"refs/heads/"+branchName)
+					},
+				})
+			}
+		}
+		steps = append(steps, checkoutStep)
+
+	case wrongBranch:
+		return nil, util.FmtNewtError(
+			"Unexpected local branch for %s: \"%s\" != \"%s\" (%s); "+
+				"provide the -f option to save local work and check out %s",
+			r.Name(), currBranch, branchName, localWorkString(lw),
+			branchName)
+
+	default:
+		return nil, util.FmtNewtError(
+			"Sync of %s would discard local work (%s); provide the "+
+				"--rebase option to rebase local commits onto %s, or the "+
+				"-f option to save local work and check out %s",
+			r.Name(), localWorkString(lw), branchName, branchName)
+	}
+
+	return steps, nil
+}
+
+// Brings an installed repo up to date with the branch that the specified
+// version maps to, or downloads the repo if it is not installed.  The planned
+// steps are printed before they are executed.
+//
+// @return                      exists, updated, err
+func (r *Repo) Sync(vers *Version, opts SyncOptions) (bool, bool, error) {
+	exists := r.checkExists()
+
+	// Update the repo description
+	if _, updated, err := r.UpdateDesc(false); updated != true || err != nil {
+		return exists, false, util.NewNewtError("Cannot update repository description.")
+	}
+
+	branchName, _, found := r.rdesc.MatchVersion(vers)
+	if found == false {
+		return exists, false, util.NewNewtError(fmt.Sprintf(
+			"Branch description for %s not found", r.Name()))
+	}
+	branchName = r.checkoutBranch(branchName)
+
+	var steps []syncStep
+	if !exists {
+		steps = []syncStep{{
+			desc: fmt.Sprintf("download %s", branchName),
+			fn:   func() error { return r.downloadRepo(branchName) },
+		}}
+	} else {
+		// Fetching only updates remote-tracking refs; it is required to
+		// determine which work is local.
+		if err := downloader.Fetch(r.Path()); err != nil {
+			return exists, false, err
+		}
+
+		var err error
+		steps, err = r.syncPlan(branchName, opts)
+		if err != nil {
+			return exists, false, err
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Sync plan for %s:\n",
+		r.Name())
+	for _, step := range steps {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    - %s\n", step.desc)
+	}
+
+	if opts.DryRun {
+		return exists, false, nil
+	}
+
+	for _, step := range steps {
+		if err := step.fn(); err != nil {
+			return exists, false, err
+		}
+	}
+
+	return exists, true, nil
+}
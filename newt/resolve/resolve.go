@@ -49,7 +49,9 @@ type ResolveDep struct {
 	// Name of API that generated the dependency; "" if a hard dependency.
 	Api string
 
-	// XXX: slice of syscfg settings that generated this dependency.
+	// Syscfg setting whose conditional block (e.g., "pkg.deps.SETTING")
+	// generated the dependency; "" if the dependency is unconditional.
+	Feature string
 }
 
 type ResolvePackage struct {
@@ -59,6 +61,9 @@ type ResolvePackage struct {
 	// Keeps track of API requirements and whether they are satisfied.
 	reqApiMap map[string]bool
 
+	// Syscfg setting that enabled each API requirement; "" if unconditional.
+	reqApiFeatures map[string]string
+
 	depsResolved  bool
 	apisSatisfied bool
 }
@@ -125,9 +130,10 @@ func newResolution() *Resolution {
 
 func NewResolvePkg(lpkg *pkg.LocalPackage) *ResolvePackage {
 	return &ResolvePackage{
-		Lpkg:      lpkg,
-		reqApiMap: map[string]bool{},
-		Deps:      map[*ResolvePackage]*ResolveDep{},
+		Lpkg:           lpkg,
+		reqApiMap:      map[string]bool{},
+		reqApiFeatures: map[string]string{},
+		Deps:           map[*ResolvePackage]*ResolveDep{},
 	}
 }
 
@@ -145,18 +151,26 @@ func (r *Resolver) resolveDep(dep *pkg.Dependency, depender string) (*pkg.LocalP
 
 // @return                      true if rhe package's dependency list was
 //                                  modified.
-func (rpkg *ResolvePackage) AddDep(apiPkg *ResolvePackage, api string) bool {
+func (rpkg *ResolvePackage) AddDep(apiPkg *ResolvePackage, api string,
+	feature string) bool {
+
 	if dep := rpkg.Deps[apiPkg]; dep != nil {
 		if dep.Api != "" && api == "" {
 			dep.Api = api
+			dep.Feature = feature
 			return true
 		} else {
+			// An unconditional dependency supersedes a conditional one.
+			if dep.Api == api && feature == "" {
+				dep.Feature = ""
+			}
 			return false
 		}
 	} else {
 		rpkg.Deps[apiPkg] = &ResolveDep{
-			Rpkg: apiPkg,
-			Api:  api,
+			Rpkg:    apiPkg,
+			Api:     api,
+			Feature: feature,
 		}
 		return true
 	}
@@ -253,9 +267,13 @@ func (r *Resolver) satisfyApis(rpkg *ResolvePackage) bool {
 
 	// Determine if any of the package's API requirements can now be satisfied.
 	// If so, another full iteration is required.
-	reqApis := newtutil.GetStringSliceFeatures(rpkg.Lpkg.PkgV, features,
-		"pkg.req_apis")
-	for _, reqApi := range reqApis {
+	reqApis, srcs := newtutil.GetStringSliceFeaturesSrc(rpkg.Lpkg.PkgV,
+		features, "pkg.req_apis")
+	for i, reqApi := range reqApis {
+		if _, ok := rpkg.reqApiFeatures[reqApi]; !ok || srcs[i] == "" {
+			rpkg.reqApiFeatures[reqApi] = srcs[i]
+		}
+
 		reqStatus := rpkg.reqApiMap[reqApi]
 		if !reqStatus {
 			apiSatisfied := r.satisfyApi(rpkg, reqApi)
@@ -282,10 +300,10 @@ func (r *Resolver) loadDepsForPkg(rpkg *ResolvePackage) (bool, error) {
 	features := r.cfg.FeaturesForLpkg(rpkg.Lpkg)
 
 	changed := false
-	newDeps := newtutil.GetStringSliceFeatures(rpkg.Lpkg.PkgV, features,
-		"pkg.deps")
+	newDeps, srcs := newtutil.GetStringSliceFeaturesSrc(rpkg.Lpkg.PkgV,
+		features, "pkg.deps")
 	depender := rpkg.Lpkg.Name()
-	for _, newDepStr := range newDeps {
+	for i, newDepStr := range newDeps {
 		newDep, err := pkg.NewDependency(rpkg.Lpkg.Repo(), newDepStr)
 		if err != nil {
 			return false, err
@@ -297,7 +315,7 @@ func (r *Resolver) loadDepsForPkg(rpkg *ResolvePackage) (bool, error) {
 		}
 
 		depRpkg, _ := r.addPkg(lpkg)
-		if rpkg.AddDep(depRpkg, "") {
+		if rpkg.AddDep(depRpkg, "", srcs[i]) {
 			changed = true
 		}
 	}
@@ -465,7 +483,7 @@ func (r *Resolver) resolveApiDeps() error {
 		for api, _ := range rpkg.reqApiMap {
 			apiPkg := r.apis[api]
 			if apiPkg != nil {
-				rpkg.AddDep(apiPkg, api)
+				rpkg.AddDep(apiPkg, api, rpkg.reqApiFeatures[api])
 			}
 		}
 	}
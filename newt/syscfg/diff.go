@@ -0,0 +1,84 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package syscfg
+
+import (
+	"sort"
+)
+
+// Describes a single setting that differs between two configurations.  If the
+// setting is only present in one of the configurations, the other entry is
+// nil.
+type CfgDiffEntry struct {
+	Name   string
+	EntryA *CfgEntry
+	EntryB *CfgEntry
+}
+
+// Indicates whether the setting is present in both configurations (i.e., its
+// value differs).
+func (de *CfgDiffEntry) IsChange() bool {
+	return de.EntryA != nil && de.EntryB != nil
+}
+
+// Retrieves the point in the setting's history that determined its final
+// value.
+func (entry *CfgEntry) Setter() CfgPoint {
+	return mostRecentPoint(*entry)
+}
+
+// Compares two configurations.  The result contains one element for each
+// setting that has a different value in the two configurations or that is
+// only defined by one of them.  The result is sorted by setting name.
+func Diff(cfgA Cfg, cfgB Cfg) []CfgDiffEntry {
+	names := map[string]struct{}{}
+	for name, _ := range cfgA.Settings {
+		names[name] = struct{}{}
+	}
+	for name, _ := range cfgB.Settings {
+		names[name] = struct{}{}
+	}
+
+	sortedNames := make([]string, 0, len(names))
+	for name, _ := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	diffs := []CfgDiffEntry{}
+	for _, name := range sortedNames {
+		de := CfgDiffEntry{Name: name}
+
+		if entry, ok := cfgA.Settings[name]; ok {
+			de.EntryA = &entry
+		}
+		if entry, ok := cfgB.Settings[name]; ok {
+			de.EntryB = &entry
+		}
+
+		if de.IsChange() && de.EntryA.Value == de.EntryB.Value {
+			continue
+		}
+
+		diffs = append(diffs, de)
+	}
+
+	return diffs
+}
@@ -67,6 +67,10 @@ var cfgSettingNameTypeMap = map[string]CfgSettingType{
 type CfgPoint struct {
 	Value  string
 	Source *pkg.LocalPackage
+
+	// The feature whose conditional block (e.g., "syscfg.vals.FEATURE")
+	// supplied this value; "" if the value is unconditional.
+	Feature string
 }
 
 type CfgEntry struct {
@@ -182,13 +186,35 @@ func (point CfgPoint) IsInjected() bool {
 	return point.Source == nil
 }
 
+// Retrieves the name of the priority class of the package that supplied this
+// value (target, app, unittest, bsp, or lib).
+func (point CfgPoint) PriorityName() string {
+	if point.Source == nil {
+		return "injected"
+	}
+
+	return pkg.PackageTypeNames[normalizePkgType(point.Source.Type())]
+}
+
+// Retrieves the path of the configuration file that supplied this value; ""
+// if the value was injected.
+func (point CfgPoint) Filename() string {
+	if point.Source == nil {
+		return ""
+	}
+
+	return point.Source.BasePath() + "/" + pkg.SYSCFG_YAML_FILENAME
+}
+
 func (entry *CfgEntry) IsTrue() bool {
 	return ValueIsTrue(entry.Value)
 }
 
-func (entry *CfgEntry) appendValue(lpkg *pkg.LocalPackage, value interface{}) {
+func (entry *CfgEntry) appendValue(lpkg *pkg.LocalPackage, value interface{},
+	feature string) {
+
 	strval := stringValue(value)
-	point := CfgPoint{Value: strval, Source: lpkg}
+	point := CfgPoint{Value: strval, Source: lpkg, Feature: feature}
 	entry.History = append(entry.History, point)
 	entry.Value = strval
 }
@@ -273,7 +299,7 @@ func stringValue(val interface{}) string {
 }
 
 func readSetting(name string, lpkg *pkg.LocalPackage,
-	vals map[interface{}]interface{}) (CfgEntry, error) {
+	vals map[interface{}]interface{}, feature string) (CfgEntry, error) {
 
 	entry := CfgEntry{}
 
@@ -301,7 +327,7 @@ func readSetting(name string, lpkg *pkg.LocalPackage,
 				"setting %s specifies invalid type: %s", name, typename)
 		}
 	}
-	entry.appendValue(lpkg, entry.Value)
+	entry.appendValue(lpkg, entry.Value, feature)
 
 	entry.Restrictions = []CfgRestriction{}
 	restrictionStrings := cast.ToStringSlice(vals["restrictions"])
@@ -326,11 +352,12 @@ func (cfg *Cfg) readDefsOnce(lpkg *pkg.LocalPackage,
 		lfeatures[k] = true
 	}
 
-	settings := newtutil.GetStringMapFeatures(v, lfeatures, "syscfg.defs")
+	settings, srcs := newtutil.GetStringMapFeaturesSrc(v, lfeatures,
+		"syscfg.defs")
 	if settings != nil {
 		for k, v := range settings {
 			vals := v.(map[interface{}]interface{})
-			entry, err := readSetting(k, lpkg, vals)
+			entry, err := readSetting(k, lpkg, vals, srcs[k])
 			if err != nil {
 				return util.FmtNewtError("Config for package %s: %s",
 					lpkg.Name(), err.Error())
@@ -364,7 +391,8 @@ func (cfg *Cfg) readValsOnce(lpkg *pkg.LocalPackage,
 		lfeatures[k] = true
 	}
 
-	values := newtutil.GetStringMapFeatures(v, lfeatures, "syscfg.vals")
+	values, srcs := newtutil.GetStringMapFeaturesSrc(v, lfeatures,
+		"syscfg.vals")
 	for k, v := range values {
 		entry, ok := cfg.Settings[k]
 		if ok {
@@ -379,13 +407,14 @@ func (cfg *Cfg) readValsOnce(lpkg *pkg.LocalPackage,
 				}
 				cfg.PriorityViolations = append(cfg.PriorityViolations, priority)
 			} else {
-				entry.appendValue(lpkg, v)
+				entry.appendValue(lpkg, v, srcs[k])
 				cfg.Settings[k] = entry
 			}
 		} else {
 			orphan := CfgPoint{
-				Value:  stringValue(v),
-				Source: lpkg,
+				Value:   stringValue(v),
+				Source:  lpkg,
+				Feature: srcs[k],
 			}
 			cfg.Orphans[k] = append(cfg.Orphans[k], orphan)
 		}
@@ -478,7 +507,7 @@ func (cfg *Cfg) detectFlashConflicts(flashMap flash.FlashMap) {
 	}
 }
 
-func (cfg *Cfg) flashConflictErrorText(conflict CfgFlashConflict) string {
+func (cfg *Cfg) FlashConflictErrorText(conflict CfgFlashConflict) string {
 	entry := cfg.Settings[conflict.SettingNames[0]]
 
 	switch conflict.Code {
@@ -579,7 +608,7 @@ func (cfg *Cfg) ErrorText() string {
 				historyMap[name] = entry.History
 			}
 
-			str += "    " + cfg.flashConflictErrorText(conflict)
+			str += "    " + cfg.FlashConflictErrorText(conflict)
 		}
 	}
 
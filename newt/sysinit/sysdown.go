@@ -0,0 +1,49 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sysinit
+
+import (
+	"mynewt.apache.org/newt/newt/pkg"
+)
+
+// Shutdown functions are declared in "pkg.down" with the same syntax as
+// "pkg.init".  Stages are called in the reverse order: the highest stage
+// first.
+var downFuncType = funcType{
+	name:      "sysdown",
+	desc:      "down",
+	funcs:     (*pkg.LocalPackage).Down,
+	relations: (*pkg.LocalPackage).DownRelations,
+	reverse:   true,
+}
+
+// Determines the order in which the specified packages' down functions get
+// called.
+func ResolveDownOrder(pkgs []*pkg.LocalPackage) ([]Stage, error) {
+	return resolveOrder(pkgs, downFuncType)
+}
+
+// Generates the sysdown C file, containing sysdown_app() or sysdown_loader().
+// The file is only rewritten if its contents have changed.
+func EnsureSysdownWritten(pkgs []*pkg.LocalPackage, srcDir string,
+	targetName string, isLoader bool) error {
+
+	return ensureWritten(pkgs, downFuncType, srcDir, targetName, isLoader)
+}
@@ -27,6 +27,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 
@@ -35,59 +36,323 @@ import (
 	"mynewt.apache.org/newt/util"
 )
 
-type initFunc struct {
-	stage int
-	name  string
-	pkg   *pkg.LocalPackage
+// A single init or down function.
+type InitFunc struct {
+	Stage int
+	Name  string
+	Pkg   *pkg.LocalPackage
+
+	// Functions in the same stage that must run before this one.
+	After []*InitFunc
+}
+
+// The functions in a single stage, in the order they get called.
+type Stage struct {
+	Stage int
+	Funcs []*InitFunc
+}
+
+func (f *InitFunc) String() string {
+	return fmt.Sprintf("%s (%s)", f.Name, f.Pkg.FullName())
+}
+
+type initFuncSorter struct {
+	funcs []*InitFunc
+}
+
+func (s initFuncSorter) Len() int {
+	return len(s.funcs)
+}
+func (s initFuncSorter) Swap(i, j int) {
+	s.funcs[i], s.funcs[j] = s.funcs[j], s.funcs[i]
+}
+func (s initFuncSorter) Less(i, j int) bool {
+	a := s.funcs[i]
+	b := s.funcs[j]
+
+	if a.Pkg.FullName() != b.Pkg.FullName() {
+		return a.Pkg.FullName() < b.Pkg.FullName()
+	}
+	return a.Name < b.Name
+}
+
+func sortInitFuncs(funcs []*InitFunc) {
+	sort.Sort(initFuncSorter{funcs})
+}
+
+// Looks up the init functions that an "after" or "before" entry refers to.
+// Entries containing a slash name a package; others name an init function.
+func findInitFuncs(ref string, funcs []*InitFunc) []*InitFunc {
+	matches := []*InitFunc{}
+	for _, f := range funcs {
+		if strings.Contains(ref, "/") {
+			if ref == f.Pkg.FullName() || ref == f.Pkg.Name() {
+				matches = append(matches, f)
+			}
+		} else if ref == f.Name {
+			matches = append(matches, f)
+		}
+	}
+
+	return matches
+}
+
+// Records that function "first" must run before function "second".
+// Functions in different stages are already ordered by their stage numbers; a
+// constraint that contradicts the stage numbers is a conflict.
+func addInitEdge(first *InitFunc, second *InitFunc, reverse bool) error {
+	if first == second {
+		return nil
+	}
+
+	if (!reverse && first.Stage > second.Stage) ||
+		(reverse && first.Stage < second.Stage) {
+
+		return util.FmtNewtError(
+			"%s must run before %s, but is in a later stage (%d vs. %d)",
+			first.String(), second.String(), first.Stage, second.Stage)
+	}
+
+	if first.Stage == second.Stage {
+		for _, f := range second.After {
+			if f == first {
+				return nil
+			}
+		}
+		second.After = append(second.After, first)
+	}
+
+	return nil
+}
+
+// Finds a cycle among a set of init functions that could not be ordered.
+// Every function in the set has an unsatisfied predecessor in the set, so
+// following predecessors from any function eventually revisits a function.
+func findInitCycle(remaining map[*InitFunc]bool) []*InitFunc {
+	funcs := make([]*InitFunc, 0, len(remaining))
+	for f, _ := range remaining {
+		funcs = append(funcs, f)
+	}
+	sortInitFuncs(funcs)
+
+	visited := map[*InitFunc]int{}
+	path := []*InitFunc{}
+	f := funcs[0]
+	for {
+		if idx, ok := visited[f]; ok {
+			cycle := path[idx:]
+
+			// Reverse the cycle so that it reads in call order.
+			for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+				cycle[i], cycle[j] = cycle[j], cycle[i]
+			}
+			return append(cycle, cycle[0])
+		}
+
+		visited[f] = len(path)
+		path = append(path, f)
+
+		for _, pred := range f.After {
+			if remaining[pred] {
+				f = pred
+				break
+			}
+		}
+	}
+}
+
+// Sorts the init functions in a single stage such that every function runs
+// after its predecessors.  Ties are broken by package name, then by function
+// name.
+func sortStage(funcs []*InitFunc) ([]*InitFunc, error) {
+	remaining := map[*InitFunc]bool{}
+	for _, f := range funcs {
+		remaining[f] = true
+	}
+
+	sorted := []*InitFunc{}
+	for len(remaining) > 0 {
+		ready := []*InitFunc{}
+		for f, _ := range remaining {
+			isReady := true
+			for _, pred := range f.After {
+				if remaining[pred] {
+					isReady = false
+					break
+				}
+			}
+			if isReady {
+				ready = append(ready, f)
+			}
+		}
+
+		if len(ready) == 0 {
+			cycle := findInitCycle(remaining)
+			names := make([]string, len(cycle))
+			for i, f := range cycle {
+				names[i] = f.String()
+			}
+			return nil, util.FmtNewtError("dependency cycle in stage %d: %s",
+				cycle[0].Stage, strings.Join(names, " --> "))
+		}
+
+		sortInitFuncs(ready)
+		sorted = append(sorted, ready[0])
+		delete(remaining, ready[0])
+	}
+
+	return sorted, nil
 }
 
-func buildStageMap(pkgs []*pkg.LocalPackage) map[int][]*initFunc {
-	sm := map[int][]*initFunc{}
+// Describes a kind of generated stage function sequence (sysinit or sysdown).
+type funcType struct {
+	// Base name of the generated C function and source file.
+	name string
+
+	// Short description of a single function ("init" or "down").
+	desc string
 
+	// Retrieves a package's functions and ordering constraints.
+	funcs     func(p *pkg.LocalPackage) map[string]int
+	relations func(p *pkg.LocalPackage) map[string]pkg.InitRelations
+
+	// Whether stages get called in descending order.
+	reverse bool
+}
+
+var initFuncType = funcType{
+	name:      "sysinit",
+	desc:      "init",
+	funcs:     (*pkg.LocalPackage).Init,
+	relations: (*pkg.LocalPackage).InitRelations,
+	reverse:   false,
+}
+
+// Determines the order in which the specified packages' functions of the
+// given type get called.  Functions are grouped by stage; within a stage,
+// they are sorted according to their "after" and "before" relations.  An
+// error is returned if the relations contain a cycle or contradict the stage
+// numbers.
+func resolveOrder(pkgs []*pkg.LocalPackage, ft funcType) ([]Stage, error) {
+	funcs := []*InitFunc{}
 	for _, p := range pkgs {
-		for name, stage := range p.Init() {
-			initFunc := &initFunc{
-				stage: stage,
-				name:  name,
-				pkg:   p,
+		for name, stage := range ft.funcs(p) {
+			funcs = append(funcs, &InitFunc{
+				Stage: stage,
+				Name:  name,
+				Pkg:   p,
+			})
+		}
+	}
+	sortInitFuncs(funcs)
+
+	conflicts := []string{}
+	for _, f := range funcs {
+		relations := ft.relations(f.Pkg)[f.Name]
+
+		for _, ref := range relations.After {
+			matches := findInitFuncs(ref, funcs)
+			if len(matches) == 0 {
+				log.Debugf("Ignoring %s relation %s after %s; "+
+					"not in build", ft.desc, f.Name, ref)
+			}
+			for _, m := range matches {
+				if err := addInitEdge(m, f, ft.reverse); err != nil {
+					conflicts = append(conflicts, err.Error())
+				}
 			}
-			sm[stage] = append(sm[stage], initFunc)
 		}
+
+		for _, ref := range relations.Before {
+			matches := findInitFuncs(ref, funcs)
+			if len(matches) == 0 {
+				log.Debugf("Ignoring %s relation %s before %s; "+
+					"not in build", ft.desc, f.Name, ref)
+			}
+			for _, m := range matches {
+				if err := addInitEdge(f, m, ft.reverse); err != nil {
+					conflicts = append(conflicts, err.Error())
+				}
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		conflicts = util.UniqueStrings(conflicts)
+		sort.Strings(conflicts)
+		return nil, util.FmtNewtError("Conflicting %s function "+
+			"relations:\n    %s", ft.desc, strings.Join(conflicts, "\n    "))
 	}
 
-	return sm
+	stageMap := map[int][]*InitFunc{}
+	for _, f := range funcs {
+		stageMap[f.Stage] = append(stageMap[f.Stage], f)
+	}
+
+	stageNums := make([]int, 0, len(stageMap))
+	for num, _ := range stageMap {
+		stageNums = append(stageNums, num)
+	}
+	if ft.reverse {
+		sort.Sort(sort.Reverse(sort.IntSlice(stageNums)))
+	} else {
+		sort.Ints(stageNums)
+	}
+
+	stages := make([]Stage, len(stageNums))
+	for i, num := range stageNums {
+		sorted, err := sortStage(stageMap[num])
+		if err != nil {
+			return nil, util.FmtNewtError("Invalid %s function order: %s",
+				ft.desc, err.Error())
+		}
+		stages[i] = Stage{
+			Stage: num,
+			Funcs: sorted,
+		}
+	}
+
+	return stages, nil
 }
 
-func writePrototypes(pkgs []*pkg.LocalPackage, w io.Writer) {
+// Determines the order in which the specified packages' init functions get
+// called.
+func ResolveOrder(pkgs []*pkg.LocalPackage) ([]Stage, error) {
+	return resolveOrder(pkgs, initFuncType)
+}
+
+func writePrototypes(pkgs []*pkg.LocalPackage, ft funcType, w io.Writer) {
 	sorted := pkg.SortLclPkgs(pkgs)
 	for _, p := range sorted {
-		init := p.Init()
-		for name, _ := range init {
+		funcs := ft.funcs(p)
+		names := make([]string, 0, len(funcs))
+		for name, _ := range funcs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
 			fmt.Fprintf(w, "void %s(void);\n", name)
 		}
 	}
 }
 
-func writeStage(stage int, initFuncs []*initFunc, w io.Writer) {
-	fmt.Fprintf(w, "    /*** Stage %d */\n", stage)
-	for i, initFunc := range initFuncs {
-		fmt.Fprintf(w, "    /* %d.%d: %s */\n", stage, i, initFunc.pkg.Name())
-		fmt.Fprintf(w, "    %s();\n", initFunc.name)
+func writeStage(stage Stage, w io.Writer) {
+	fmt.Fprintf(w, "    /*** Stage %d */\n", stage.Stage)
+	for i, initFunc := range stage.Funcs {
+		fmt.Fprintf(w, "    /* %d.%d: %s */\n", stage.Stage, i,
+			initFunc.Pkg.Name())
+		fmt.Fprintf(w, "    %s();\n", initFunc.Name)
 	}
 }
 
-func write(pkgs []*pkg.LocalPackage, isLoader bool,
-	w io.Writer) {
-
-	stageMap := buildStageMap(pkgs)
+func write(pkgs []*pkg.LocalPackage, ft funcType, isLoader bool,
+	w io.Writer) error {
 
-	i := 0
-	stages := make([]int, len(stageMap))
-	for k, _ := range stageMap {
-		stages[i] = k
-		i++
+	stages, err := resolveOrder(pkgs, ft)
+	if err != nil {
+		return err
 	}
-	sort.Ints(stages)
 
 	fmt.Fprintf(w, newtutil.GeneratedPreamble())
 
@@ -97,13 +362,13 @@ func write(pkgs []*pkg.LocalPackage, isLoader bool,
 		fmt.Fprintf(w, "#if !SPLIT_LOADER\n\n")
 	}
 
-	writePrototypes(pkgs, w)
+	writePrototypes(pkgs, ft, w)
 
 	var fnName string
 	if isLoader {
-		fnName = "sysinit_loader"
+		fnName = ft.name + "_loader"
 	} else {
-		fnName = "sysinit_app"
+		fnName = ft.name + "_app"
 	}
 
 	fmt.Fprintf(w, "\n")
@@ -111,11 +376,13 @@ func write(pkgs []*pkg.LocalPackage, isLoader bool,
 
 	for _, s := range stages {
 		fmt.Fprintf(w, "\n")
-		writeStage(s, stageMap[s], w)
+		writeStage(s, w)
 	}
 
 	fmt.Fprintf(w, "}\n\n")
 	fmt.Fprintf(w, "#endif\n")
+
+	return nil
 }
 
 func writeRequired(contents []byte, path string) (bool, error) {
@@ -133,17 +400,19 @@ func writeRequired(contents []byte, path string) (bool, error) {
 	return rc != 0, nil
 }
 
-func EnsureWritten(pkgs []*pkg.LocalPackage, srcDir string, targetName string,
-	isLoader bool) error {
+func ensureWritten(pkgs []*pkg.LocalPackage, ft funcType, srcDir string,
+	targetName string, isLoader bool) error {
 
 	buf := bytes.Buffer{}
-	write(pkgs, isLoader, &buf)
+	if err := write(pkgs, ft, isLoader, &buf); err != nil {
+		return err
+	}
 
 	var path string
 	if isLoader {
-		path = fmt.Sprintf("%s/%s-sysinit-loader.c", srcDir, targetName)
+		path = fmt.Sprintf("%s/%s-%s-loader.c", srcDir, targetName, ft.name)
 	} else {
-		path = fmt.Sprintf("%s/%s-sysinit-app.c", srcDir, targetName)
+		path = fmt.Sprintf("%s/%s-%s-app.c", srcDir, targetName, ft.name)
 	}
 
 	writeReqd, err := writeRequired(buf.Bytes(), path)
@@ -152,11 +421,11 @@ func EnsureWritten(pkgs []*pkg.LocalPackage, srcDir string, targetName string,
 	}
 
 	if !writeReqd {
-		log.Debugf("sysinit unchanged; not writing src file (%s).", path)
+		log.Debugf("%s unchanged; not writing src file (%s).", ft.name, path)
 		return nil
 	}
 
-	log.Debugf("sysinit changed; writing src file (%s).", path)
+	log.Debugf("%s changed; writing src file (%s).", ft.name, path)
 
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return util.NewNewtError(err.Error())
@@ -168,3 +437,9 @@ func EnsureWritten(pkgs []*pkg.LocalPackage, srcDir string, targetName string,
 
 	return nil
 }
+
+func EnsureWritten(pkgs []*pkg.LocalPackage, srcDir string, targetName string,
+	isLoader bool) error {
+
+	return ensureWritten(pkgs, initFuncType, srcDir, targetName, isLoader)
+}
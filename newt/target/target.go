@@ -25,6 +25,8 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/spf13/cast"
+
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
 	"mynewt.apache.org/newt/newt/repo"
@@ -79,7 +81,7 @@ func (target *Target) Load(basePkg *pkg.LocalPackage) error {
 
 	settings := v.AllSettings()
 	for k, v := range settings {
-		target.Vars[k] = v.(string)
+		target.Vars[k] = cast.ToString(v)
 	}
 
 	target.BspName = target.Vars["target.bsp"]